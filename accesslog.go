@@ -0,0 +1,88 @@
+package main
+
+// access log module
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessRecord represents access log record of data objects, it is used to
+// account data access according to data-sharing agreements
+type AccessRecord struct {
+	Time       int64  `json:"time"`
+	User       string `json:"user"`
+	Action     string `json:"action"`
+	Site       string `json:"site"`
+	Bucket     string `json:"bucket"`
+	Object     string `json:"object"`
+	Range      string `json:"range,omitempty"`
+	Bytes      int    `json:"bytes"`
+	Status     int    `json:"status"`
+	Expires    int64  `json:"expires,omitempty"`
+	RemoteAddr string `json:"remote_addr"`
+	UserAgent  string `json:"user_agent"`
+}
+
+// AccessLog represents append-only access log file
+type AccessLog struct {
+	mu    sync.Mutex
+	fname string
+}
+
+// _accessLog holds access log used by data end-points
+var _accessLog AccessLog
+
+// Write appends given record to access log file
+func (a *AccessLog) Write(rec AccessRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	file, err := os.OpenFile(a.fname, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// helper function to record access to data object made by given request
+func logAccess(c *gin.Context, action, site, bucket, object string, expires int64) {
+	var user string
+	if val, ok := c.Get("user"); ok {
+		user = fmt.Sprintf("%v", val)
+	}
+	rec := AccessRecord{
+		Time:       time.Now().Unix(),
+		User:       user,
+		Action:     action,
+		Site:       site,
+		Bucket:     bucket,
+		Object:     object,
+		Range:      c.GetHeader("Range"),
+		Bytes:      c.Writer.Size(),
+		Status:     c.Writer.Status(),
+		Expires:    expires,
+		RemoteAddr: c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	}
+	if rec.Bytes < 0 {
+		rec.Bytes = 0
+	}
+	if err := _accessLog.Write(rec); err != nil {
+		log.Printf("ERROR: unable to write access record %+v, error %v", rec, err)
+	}
+}
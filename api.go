@@ -0,0 +1,204 @@
+package main
+
+// JSON API module
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+// Pages of sites, buckets, objects, meta-data records and datasets are also
+// available in JSON format. Clients either request them with
+// "Accept: application/json" header or use /api/v1 prefix, e.g.
+// /api/v1/storage/Cornell provides buckets of Cornell site. Successful
+// responses and errors use the same envelope as OreCast services:
+//
+//	{"status": "ok", "code": 200, "data": {...}}
+//	{"status": "error", "code": 404, "error": "..."}
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/minio/minio-go/v7"
+)
+
+// apiPrefix defines prefix of JSON API end-points
+const apiPrefix = "/api/v1"
+
+// apiPaths lists end-points which provide JSON representation of their pages,
+// they are registered under apiPrefix along with their HTML counterparts
+var apiPaths = map[string]bool{
+	"/sites":                         true,
+	"/site/:site":                    true,
+	"/site/:site/edit":               true,
+	"/site/:site/delete":             true,
+	"/site/edit":                     true,
+	"/site/credentials":              true,
+	"/site/delete":                   true,
+	"/storage/:site":                 true,
+	"/storage/:site/:bucket":         true,
+	"/storage/:site/:bucket/*object": true,
+	"/meta":                          true,
+	"/meta/:site":                    true,
+	"/meta/record/:mid/:site":        true,
+	"/datasets":                      true,
+	"/datasets/queries":              true,
+	"/datasets/queries/delete":       true,
+	"/dataset/*dataset":              true,
+	"/data/registration":             true,
+	"/provenance":                    true,
+}
+
+// APIResponse represents response envelope of JSON API
+type APIResponse struct {
+	Status      string            `json:"status"`
+	Code        int               `json:"code"`
+	Data        any               `json:"data,omitempty"`
+	Error       string            `json:"error,omitempty"`
+	Fields      map[string]string `json:"fields,omitempty"`      // validation errors of submitted fields
+	Unavailable []string          `json:"unavailable,omitempty"` // upstream services which were not available
+}
+
+// SiteRecord represents site on sites page, site credentials are never exposed
+type SiteRecord struct {
+	Name        string          `json:"name"`
+	URL         string          `json:"url"`
+	Description string          `json:"description"`
+	UseSSL      bool            `json:"use_ssl"`
+	NRecords    int             `json:"nrecords"`
+	Permissions map[string]bool `json:"permissions"`
+	Error       string          `json:"error,omitempty"`
+}
+
+// SiteMetaRecords represents meta-data records page of the site
+type SiteMetaRecords struct {
+	Site        string     `json:"site"`
+	Description string     `json:"description"`
+	UseSSL      bool       `json:"use_ssl"`
+	Records     []MetaData `json:"records"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// SiteBuckets represents buckets page of the site
+type SiteBuckets struct {
+	Site    string         `json:"site"`
+	Buckets []BucketObject `json:"buckets"`
+}
+
+// StorageObject represents bucket object on bucket listing page
+type StorageObject struct {
+	Name         string `json:"name"`
+	Size         int64  `json:"size"`
+	ETag         string `json:"etag"`
+	LastModified string `json:"last_modified"`
+}
+
+// BucketListing represents bucket listing page
+type BucketListing struct {
+	Site      string          `json:"site"`
+	Bucket    string          `json:"bucket"`
+	Prefix    string          `json:"prefix"`
+	Filter    string          `json:"filter,omitempty"`
+	Sort      string          `json:"sort"`
+	Order     string          `json:"order"`
+	SortScope string          `json:"sort_scope"` // page if sort order applies to the listed page only
+	Limit     int             `json:"limit"`
+	Folders   []string        `json:"folders"`
+	Objects   []StorageObject `json:"objects"`
+	NextToken string          `json:"next_token,omitempty"`
+}
+
+// ObjectRecord represents object page, it is provided instead of object content
+type ObjectRecord struct {
+	Site         string   `json:"site"`
+	Bucket       string   `json:"bucket"`
+	Object       string   `json:"object"`
+	Size         int64    `json:"size"`
+	ETag         string   `json:"etag"`
+	ContentType  string   `json:"content_type"`
+	LastModified string   `json:"last_modified"`
+	URL          string   `json:"url,omitempty"`     // presigned url
+	Expires      int64    `json:"expires,omitempty"` // lifetime of presigned url in seconds
+	Preview      *Preview `json:"preview,omitempty"`
+}
+
+// helper function to make object record from S3 object info
+func objectRecord(site, bucket, object string, info minio.ObjectInfo) ObjectRecord {
+	return ObjectRecord{
+		Site:         site,
+		Bucket:       bucket,
+		Object:       object,
+		Size:         info.Size,
+		ETag:         strings.Trim(info.ETag, "\""),
+		ContentType:  info.ContentType,
+		LastModified: info.LastModified.Format(time.RFC3339),
+	}
+}
+
+// helper function to check if client requested JSON representation of the page
+func wantJSON(c *gin.Context) bool {
+	if strings.HasPrefix(c.FullPath(), apiPrefix) {
+		return true
+	}
+	// browsers accept */* too, therefore HTML is preferred when both are acceptable
+	return c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON
+}
+
+// helper function to get upstream services which were not available
+func unavailableServices(c *gin.Context) []string {
+	if val, ok := c.Get("unavailable"); ok {
+		if services, ok := val.([]string); ok {
+			return services
+		}
+	}
+	return nil
+}
+
+// helper function to write JSON response with given data
+func apiData(c *gin.Context, data any) {
+	c.JSON(http.StatusOK, APIResponse{
+		Status:      "ok",
+		Code:        http.StatusOK,
+		Data:        data,
+		Unavailable: unavailableServices(c),
+	})
+}
+
+// helper function to write JSON error response
+func apiError(c *gin.Context, status int, msg string, err error) {
+	if err != nil {
+		msg = fmt.Sprintf("%s: %v", msg, err)
+	}
+	c.JSON(status, APIResponse{
+		Status:      "error",
+		Code:        status,
+		Error:       msg,
+		Unavailable: unavailableServices(c),
+	})
+}
+
+// helper function to write JSON error response with validation errors of
+// submitted fields
+func apiFieldErrors(c *gin.Context, msg string, errs map[string]string) {
+	c.JSON(http.StatusBadRequest, APIResponse{
+		Status:      "error",
+		Code:        http.StatusBadRequest,
+		Error:       msg,
+		Fields:      errs,
+		Unavailable: unavailableServices(c),
+	})
+}
+
+// helper function to write error page or error envelope for JSON requests
+func errorPage(c *gin.Context, status int, msg string, err error) {
+	if wantJSON(c) {
+		apiError(c, status, msg, err)
+		return
+	}
+	tmpl := makeTmpl(c, "Status")
+	top := tmplPage("top.tmpl", tmpl)
+	bottom := tmplPage("bottom.tmpl", tmpl)
+	content := errorTmpl(c, msg, err)
+	c.Data(status, "text/html; charset=utf-8", []byte(top+bannerTmpl(c)+content+bottom))
+}
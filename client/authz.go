@@ -0,0 +1,77 @@
+package client
+
+// Authz service client
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	authz "github.com/OreCast/common/authz"
+)
+
+// Token represents OAuth token issued by Authz service
+type Token struct {
+	authz.Token
+	RefreshToken string `json:"refresh_token"`
+}
+
+// User represents structure used by users DB in Authz service to handle incoming requests
+type User struct {
+	Login    string
+	Password string
+}
+
+// AuthzClient represents client of Authz service
+type AuthzClient struct {
+	*Client
+	ClientID     string // OAuth client id of the application
+	ClientSecret string // OAuth client secret of the application
+}
+
+// helper function to check status of Authz response
+func (c *AuthzClient) check(path string, r authz.Response) error {
+	if r.Status == "ok" {
+		return nil
+	}
+	msg := r.Error
+	if msg == "" {
+		msg = "status " + r.Status
+	}
+	return &Error{Service: c.Service, Method: "POST", URL: c.URL + path, StatusCode: http.StatusOK, Message: msg}
+}
+
+// Authorize checks that user with given login and (encrypted) password exists
+func (c *AuthzClient) Authorize(ctx context.Context, login, password string) error {
+	query := url.Values{}
+	query.Set("client_id", c.ClientID)
+	query.Set("response_type", "code")
+	user := User{Login: login, Password: password}
+	var r authz.Response
+	if err := c.PostJSON(ctx, "/oauth/authorize", query, user, &r); err != nil {
+		return err
+	}
+	return c.check("/oauth/authorize", r)
+}
+
+// AddUser registers new user in Authz service
+func (c *AuthzClient) AddUser(ctx context.Context, user any) error {
+	var r authz.Response
+	if err := c.PostJSON(ctx, "/user", nil, user, &r); err != nil {
+		return err
+	}
+	return c.check("/user", r)
+}
+
+// Token requests new token for given grant, e.g. password or refresh_token one
+func (c *AuthzClient) Token(ctx context.Context, form url.Values) (Token, error) {
+	var token Token
+	form.Set("client_id", c.ClientID)
+	form.Set("client_secret", c.ClientSecret)
+	form.Set("scope", "read")
+	err := c.PostForm(ctx, "/oauth/token", form, &token)
+	return token, err
+}
@@ -0,0 +1,102 @@
+package client
+
+// circuit breaker module
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when service calls are rejected by circuit breaker
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// list of circuit breaker states
+const (
+	StateClosed   = "closed"    // calls pass through
+	StateOpen     = "open"      // calls are rejected until cooldown period ends
+	StateHalfOpen = "half-open" // single probe call is allowed
+)
+
+// Breaker represents circuit breaker of single service. It opens after given
+// number of consecutive failures and rejects calls during cooldown period,
+// afterwards it lets single probe call through which either closes or re-opens it.
+type Breaker struct {
+	Threshold int           // number of consecutive failures to open the breaker
+	Cooldown  time.Duration // period during which calls are rejected
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewBreaker creates new circuit breaker
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{Threshold: threshold, Cooldown: cooldown, state: StateClosed}
+}
+
+// Allow checks if call is allowed by the breaker
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case StateOpen:
+		if time.Since(b.openedAt) < b.Cooldown {
+			return false
+		}
+		b.state = StateHalfOpen
+		b.probing = true
+		return true
+	case StateHalfOpen:
+		// only one probe call is allowed at a time
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// Success records successful call
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = StateClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// Failure records failed call
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.state == StateHalfOpen || b.failures >= b.Threshold {
+		b.state = StateOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// Release records call which outcome is unknown, e.g. cancelled by the caller
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// State returns current state of the breaker
+func (b *Breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateOpen && time.Since(b.openedAt) >= b.Cooldown {
+		return StateHalfOpen
+	}
+	return b.state
+}
@@ -0,0 +1,156 @@
+package client
+
+// circuit breaker tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestBreakerOpens tests that breaker opens after threshold of consecutive failures
+func TestBreakerOpens(t *testing.T) {
+	b := NewBreaker(3, time.Minute)
+	b.Failure()
+	b.Failure()
+	b.Success()
+	b.Failure()
+	b.Failure()
+	if b.State() != StateClosed || !b.Allow() {
+		t.Fatalf("breaker should be closed after success resets failures, state %s", b.State())
+	}
+	b.Failure()
+	if b.State() != StateOpen {
+		t.Fatalf("breaker state %s, want %s", b.State(), StateOpen)
+	}
+	if b.Allow() {
+		t.Error("open breaker allows calls during cooldown")
+	}
+}
+
+// TestBreakerHalfOpen tests probe calls of half-open breaker
+func TestBreakerHalfOpen(t *testing.T) {
+	tests := []struct {
+		name  string
+		probe func(b *Breaker)
+		state string
+	}{
+		{"successful probe closes breaker", (*Breaker).Success, StateClosed},
+		{"failed probe re-opens breaker", (*Breaker).Failure, StateOpen},
+		{"released probe keeps breaker half-open", (*Breaker).Release, StateHalfOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cooldown := 20 * time.Millisecond
+			b := NewBreaker(1, cooldown)
+			b.Failure()
+			if b.Allow() {
+				t.Fatal("open breaker allows calls during cooldown")
+			}
+			time.Sleep(cooldown)
+			if b.State() != StateHalfOpen {
+				t.Fatalf("breaker state %s, want %s", b.State(), StateHalfOpen)
+			}
+			if !b.Allow() {
+				t.Fatal("half-open breaker rejects probe call")
+			}
+			if b.Allow() {
+				t.Fatal("half-open breaker allows second concurrent probe call")
+			}
+			tt.probe(b)
+			if b.State() != tt.state {
+				t.Errorf("breaker state %s, want %s", b.State(), tt.state)
+			}
+			if allowed := b.Allow(); allowed != (tt.state != StateOpen) {
+				t.Errorf("breaker in %s state allows call: %v", tt.state, allowed)
+			}
+		})
+	}
+}
+
+// TestBreakerAccounting tests how results of calls are counted by circuit breaker
+func TestBreakerAccounting(t *testing.T) {
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		ctx     func() (context.Context, context.CancelFunc)
+		state   string
+	}{
+		{
+			name:    "server errors open breaker",
+			handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) },
+			ctx:     func() (context.Context, context.CancelFunc) { return context.WithCancel(context.Background()) },
+			state:   StateOpen,
+		},
+		{
+			name:    "client errors do not open breaker",
+			handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNotFound) },
+			ctx:     func() (context.Context, context.CancelFunc) { return context.WithCancel(context.Background()) },
+			state:   StateClosed,
+		},
+		{
+			name:    "expired caller deadline does not open breaker",
+			handler: slow,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 10*time.Millisecond)
+			},
+			state: StateClosed,
+		},
+		{
+			name:    "cancelled call does not open breaker",
+			handler: slow,
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(10*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			state: StateClosed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testClient(t, tt.handler, Config{BreakerThreshold: 2, BreakerCooldown: time.Minute})
+			for i := 0; i < 2; i++ {
+				ctx, cancel := tt.ctx()
+				if resp, err := c.Do(ctx, "POST", "/x", nil, nil, ""); err == nil {
+					resp.Body.Close()
+				}
+				cancel()
+			}
+			if got := c.Breaker.State(); got != tt.state {
+				t.Errorf("breaker state %s, want %s", got, tt.state)
+			}
+		})
+	}
+}
+
+// TestOpenBreakerRejectsCalls tests that open breaker does not reach the service
+func TestOpenBreakerRejectsCalls(t *testing.T) {
+	var calls atomic.Int32
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}, Config{BreakerThreshold: 1, BreakerCooldown: time.Minute})
+	for i := 0; i < 3; i++ {
+		c.Do(context.Background(), "POST", "/x", nil, nil, "")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("service is called %d times, want 1", calls.Load())
+	}
+	_, err := c.Do(context.Background(), "POST", "/x", nil, nil, "")
+	if !errors.Is(err, ErrCircuitOpen) || !errors.Is(err, ErrUnavailable) {
+		t.Errorf("unexpected error of open breaker %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package client
+
+// response cache module
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheStats represents statistics of response cache
+type CacheStats struct {
+	Hits          int64 `json:"hits"`          // responses served from fresh entries
+	Misses        int64 `json:"misses"`        // responses fetched from the service
+	Revalidations int64 `json:"revalidations"` // stale entries confirmed by the service via 304
+	Invalidations int64 `json:"invalidations"` // entries dropped after our own writes
+	Evictions     int64 `json:"evictions"`     // entries dropped due to size limit
+	Entries       int64 `json:"entries"`       // current number of entries
+}
+
+// cacheEntry represents single cached response
+type cacheEntry struct {
+	data    []byte    // response body
+	etag    string    // ETag of the response used for revalidation
+	expires time.Time // time after which entry should be revalidated
+	stored  time.Time // time when entry was stored or revalidated
+}
+
+// Cache represents in-process cache of GET responses of OreCast services.
+// Fresh entries are served without contacting the service, stale entries
+// which have ETag are revalidated with If-None-Match request.
+type Cache struct {
+	TTL        time.Duration // lifetime of fresh entries
+	MaxEntries int           // maximum number of entries, zero means no limit
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+
+	hits          atomic.Int64
+	misses        atomic.Int64
+	revalidations atomic.Int64
+	invalidations atomic.Int64
+	evictions     atomic.Int64
+}
+
+// NewCache creates new response cache
+func NewCache(ttl time.Duration, maxEntries int) *Cache {
+	return &Cache{TTL: ttl, MaxEntries: maxEntries, entries: make(map[string]cacheEntry)}
+}
+
+// helper function to make cache key of the request, the key starts with
+// service name and path which allows to invalidate entries by path prefix
+func cacheKey(service, path, query, user string) string {
+	key := service + " " + path
+	if query != "" {
+		key += "?" + query
+	}
+	if user != "" {
+		key += "\x00" + user
+	}
+	return key
+}
+
+// helper function to get user part of cache key from user name or token
+func cacheUser(user, token string) string {
+	if user != "" {
+		return user
+	}
+	if token == "" {
+		return ""
+	}
+	// never keep raw tokens in memory longer than needed
+	hash := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(hash[:8])
+}
+
+// helper function to get cache entry, it returns entry and its freshness
+func (c *Cache) get(key string) (cacheEntry, bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return entry, false, false
+	}
+	return entry, true, time.Now().Before(entry.expires)
+}
+
+// helper function to store response in the cache
+func (c *Cache) set(key string, data []byte, etag string) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok && c.MaxEntries > 0 && len(c.entries) >= c.MaxEntries {
+		c.evict(now)
+	}
+	c.entries[key] = cacheEntry{data: data, etag: etag, expires: now.Add(c.TTL), stored: now}
+}
+
+// helper function to extend lifetime of revalidated entry
+func (c *Cache) refresh(key string) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[key]; ok {
+		entry.expires = now.Add(c.TTL)
+		entry.stored = now
+		c.entries[key] = entry
+	}
+}
+
+// helper function to free space in the cache, it drops stale entries which
+// can not be revalidated and if it is not enough the oldest entry;
+// must be called with the lock held
+func (c *Cache) evict(now time.Time) {
+	var oldest string
+	var oldestTime time.Time
+	for key, entry := range c.entries {
+		if entry.etag == "" && now.After(entry.expires) {
+			delete(c.entries, key)
+			c.evictions.Add(1)
+			continue
+		}
+		if oldest == "" || entry.stored.Before(oldestTime) {
+			oldest, oldestTime = key, entry.stored
+		}
+	}
+	if len(c.entries) >= c.MaxEntries && oldest != "" {
+		delete(c.entries, oldest)
+		c.evictions.Add(1)
+	}
+}
+
+// Invalidate drops cached responses of given service whose path starts with
+// given prefix, it is used after writes made through the clients
+func (c *Cache) Invalidate(service, prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	start := service + " " + prefix
+	for key := range c.entries {
+		if !strings.HasPrefix(key, start) {
+			continue
+		}
+		// prefix should match whole path segment, e.g. /storage/site
+		// should not match /storage/site2
+		rest := key[len(start):]
+		if rest == "" || strings.HasSuffix(prefix, "/") || strings.ContainsAny(rest[:1], "/?\x00") {
+			delete(c.entries, key)
+			c.invalidations.Add(1)
+		}
+	}
+}
+
+// Stats returns statistics of the cache
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	entries := int64(len(c.entries))
+	c.mu.Unlock()
+	return CacheStats{
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Revalidations: c.revalidations.Load(),
+		Invalidations: c.invalidations.Load(),
+		Evictions:     c.evictions.Load(),
+		Entries:       entries,
+	}
+}
@@ -0,0 +1,203 @@
+package client
+
+// response cache tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// helper function to create client of test service with response cache,
+// the service responds with ETag and honours If-None-Match requests
+func cachedClient(t *testing.T, ttl time.Duration, version *atomic.Int32, calls *atomic.Int32) *Client {
+	t.Helper()
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		etag := fmt.Sprintf(`"v%d"`, version.Load())
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		fmt.Fprintf(w, `{"status":"ok","data":"%s%s"}`, r.URL.Path, etag[1:len(etag)-1])
+	}, Config{})
+	c.Cache = NewCache(ttl, 0)
+	return c
+}
+
+// helper function to get data of cached response
+func cachedData(t *testing.T, c *Client, ctx context.Context, path string) string {
+	t.Helper()
+	var r Response
+	if err := c.Get(ctx, path, nil, &r); err != nil {
+		t.Fatal(err)
+	}
+	return string(r.Data)
+}
+
+// TestCacheTTL tests that fresh entries are served without calling the service
+func TestCacheTTL(t *testing.T) {
+	var version, calls atomic.Int32
+	ttl := 50 * time.Millisecond
+	c := cachedClient(t, ttl, &version, &calls)
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if got := cachedData(t, c, ctx, "/sites"); got != `"/sitesv0"` {
+			t.Fatalf("got %s", got)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("service is called %d times, want 1", calls.Load())
+	}
+	stats := c.Cache.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Errorf("unexpected cache stats %+v", stats)
+	}
+	// different users do not share cached entries
+	cachedData(t, c, WithUser(ctx, "alice"), "/sites")
+	if calls.Load() != 2 {
+		t.Errorf("service is called %d times, want 2", calls.Load())
+	}
+}
+
+// TestCacheRevalidation tests that stale entries are revalidated with their ETag
+func TestCacheRevalidation(t *testing.T) {
+	var version, calls atomic.Int32
+	ttl := 20 * time.Millisecond
+	c := cachedClient(t, ttl, &version, &calls)
+	ctx := context.Background()
+	cachedData(t, c, ctx, "/sites")
+
+	// unchanged resource is confirmed by 304 response
+	time.Sleep(ttl)
+	if got := cachedData(t, c, ctx, "/sites"); got != `"/sitesv0"` {
+		t.Fatalf("got %s", got)
+	}
+	if stats := c.Cache.Stats(); stats.Revalidations != 1 || calls.Load() != 2 {
+		t.Errorf("unexpected cache stats %+v after %d calls", stats, calls.Load())
+	}
+	// revalidated entry is fresh again
+	cachedData(t, c, ctx, "/sites")
+	if calls.Load() != 2 {
+		t.Errorf("service is called %d times, want 2", calls.Load())
+	}
+
+	// changed resource replaces stale entry
+	version.Store(1)
+	time.Sleep(ttl)
+	if got := cachedData(t, c, ctx, "/sites"); got != `"/sitesv1"` {
+		t.Errorf("got %s, want new version", got)
+	}
+}
+
+// TestCacheInvalidate tests invalidation of cached entries by path prefix
+func TestCacheInvalidate(t *testing.T) {
+	tests := []struct {
+		prefix  string
+		dropped []string
+	}{
+		{"/storage/site", []string{"/storage/site", "/storage/site/bucket"}},
+		{"/storage/", []string{"/storage/site", "/storage/site/bucket", "/storage/site2"}},
+		{"/storage/site2", []string{"/storage/site2"}},
+		{"/meta", []string{"/meta"}},
+		{"/datasets", nil},
+	}
+	paths := []string{"/storage/site", "/storage/site/bucket", "/storage/site2", "/meta"}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			cache := NewCache(time.Minute, 0)
+			for _, path := range paths {
+				cache.set(cacheKey("DataManagement", path, "", ""), []byte("{}"), "")
+			}
+			// entries of other services are not affected
+			cache.set(cacheKey("MetaData", tt.prefix, "", ""), []byte("{}"), "")
+			cache.Invalidate("DataManagement", tt.prefix)
+			dropped := make(map[string]bool)
+			for _, path := range tt.dropped {
+				dropped[path] = true
+			}
+			for _, path := range paths {
+				_, found, _ := cache.get(cacheKey("DataManagement", path, "", ""))
+				if found == dropped[path] {
+					t.Errorf("entry %s is found %v after invalidation of %s", path, found, tt.prefix)
+				}
+			}
+			if _, found, _ := cache.get(cacheKey("MetaData", tt.prefix, "", "")); !found {
+				t.Error("entry of other service is invalidated")
+			}
+		})
+	}
+}
+
+// TestCacheWriteInvalidates tests that writes made through the client drop cached responses
+func TestCacheWriteInvalidates(t *testing.T) {
+	var calls atomic.Int32
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		io.WriteString(w, `[{"name":"Cornell"}]`)
+	}, Config{})
+	c.Cache = NewCache(time.Minute, 0)
+	d := &DiscoveryClient{c}
+	ctx := context.Background()
+	d.Sites(ctx)
+	d.Sites(ctx)
+	if calls.Load() != 1 {
+		t.Fatalf("service is called %d times, want 1", calls.Load())
+	}
+	d.DeleteSite(ctx, "Cornell")
+	d.Sites(ctx)
+	if calls.Load() != 3 {
+		t.Errorf("service is called %d times, want 3", calls.Load())
+	}
+}
+
+// TestCacheInvalidateObjects tests that cached objects of the bucket are
+// dropped after they are changed in site storage
+func TestCacheInvalidateObjects(t *testing.T) {
+	var calls atomic.Int32
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		fmt.Fprintf(w, `{"status":"ok","data":{"objects":[{"name":"n%d"}]}}`, calls.Load())
+	}, Config{})
+	c.Cache = NewCache(time.Minute, 0)
+	dm := &DataManagementClient{c}
+	ctx := context.Background()
+	dm.Objects(ctx, "Cornell", "b1")
+	dm.Objects(ctx, "Cornell", "b10")
+	dm.InvalidateObjects("Cornell", "b1")
+	objects, err := dm.Objects(ctx, "Cornell", "b1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || objects[0].Name != "n3" {
+		t.Errorf("got stale objects %+v", objects)
+	}
+	dm.Objects(ctx, "Cornell", "b10")
+	if calls.Load() != 3 {
+		t.Errorf("service is called %d times, want 3", calls.Load())
+	}
+}
+
+// TestCacheEviction tests size limit of the cache
+func TestCacheEviction(t *testing.T) {
+	cache := NewCache(time.Minute, 2)
+	for i := 0; i < 3; i++ {
+		cache.set(cacheKey("Test", fmt.Sprintf("/%d", i), "", ""), []byte("{}"), "")
+		time.Sleep(time.Millisecond)
+	}
+	stats := cache.Stats()
+	if stats.Entries != 2 || stats.Evictions != 1 {
+		t.Errorf("unexpected cache stats %+v", stats)
+	}
+	if _, found, _ := cache.get(cacheKey("Test", "/0", "", "")); found {
+		t.Error("oldest entry is not evicted")
+	}
+}
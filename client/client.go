@@ -0,0 +1,520 @@
+// Package client provides typed clients of OreCast backend services
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+// Each OreCast service (Discovery, DataManagement, MetaData, DataBookkeeping
+// and Authz) has its own client which is built on top of generic Client. All
+// clients share the same conventions:
+//   - methods accept context which carries user token, see WithToken
+//   - non 2xx HTTP responses and failed service statuses are returned as *Error
+//     which can be matched against ErrNotFound, ErrUnauthorized, etc.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// list of errors returned by OreCast services
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrUnavailable  = errors.New("service unavailable")
+	ErrFailed       = errors.New("service request failed")
+)
+
+// Error represents error of OreCast service call
+type Error struct {
+	Service    string // service name
+	Method     string // HTTP method of the request
+	URL        string // url of the request
+	StatusCode int    // HTTP status code, zero if service was not reached
+	Message    string // error message reported by the service
+	Err        error  // underlying error
+}
+
+// Error implements error interface
+func (e *Error) Error() string {
+	msg := e.Message
+	if msg == "" && e.Err != nil {
+		msg = e.Err.Error()
+	}
+	if e.StatusCode > 0 {
+		return fmt.Sprintf("%s service %s %s responded with %d: %s", e.Service, e.Method, e.URL, e.StatusCode, msg)
+	}
+	return fmt.Sprintf("%s service %s %s failed: %s", e.Service, e.Method, e.URL, msg)
+}
+
+// Unwrap returns underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches error against errors of OreCast services
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnavailable:
+		return e.StatusCode == 0 || e.StatusCode >= http.StatusInternalServerError
+	case ErrFailed:
+		return true
+	}
+	return false
+}
+
+// Response represents common response envelope of OreCast services
+type Response struct {
+	Status string          `json:"status"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// tokenKey is context key of user token
+type tokenKey struct{}
+
+// WithToken returns context which carries user token used by service calls
+func WithToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+// TokenFromContext returns user token of given context
+func TokenFromContext(ctx context.Context) string {
+	if token, ok := ctx.Value(tokenKey{}).(string); ok {
+		return token
+	}
+	return ""
+}
+
+// userKey is context key of user name
+type userKey struct{}
+
+// WithUser returns context which carries name of the user, it separates
+// cached responses of services which apply per-user permissions
+func WithUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFromContext returns user name of given context
+func UserFromContext(ctx context.Context) string {
+	if user, ok := ctx.Value(userKey{}).(string); ok {
+		return user
+	}
+	return ""
+}
+
+// Client represents generic HTTP client of OreCast service
+type Client struct {
+	Service    string       // service name used in errors and logs
+	URL        string       // service url
+	HTTPClient *http.Client // underlying HTTP client
+	Retries    int          // number of retries of idempotent GET requests
+	Breaker    *Breaker     // circuit breaker of the service
+	Cache      *Cache       // cache of GET responses, nil disables caching
+	Shared     bool         // responses do not depend on the user and cached entries are shared
+	Verbose    int          // verbosity level
+}
+
+// NewClient creates new client of given service
+func NewClient(service, rurl string, cfg Config) *Client {
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = NewHTTPClient(cfg)
+	}
+	var breaker *Breaker
+	if cfg.BreakerThreshold > 0 {
+		breaker = NewBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown)
+	}
+	return &Client{
+		Service:    service,
+		URL:        strings.TrimSuffix(rurl, "/"),
+		HTTPClient: httpClient,
+		Retries:    cfg.Retries,
+		Breaker:    breaker,
+		Verbose:    cfg.Verbose,
+	}
+}
+
+// NewHTTPClient creates HTTP client with connect and read timeouts of given configuration
+func NewHTTPClient(cfg Config) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   cfg.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   cfg.ConnectTimeout,
+		ResponseHeaderTimeout: cfg.Timeout,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+	}
+	return &http.Client{Transport: transport, Timeout: cfg.Timeout}
+}
+
+// backoff parameters of retried requests
+const (
+	backoffBase = 200 * time.Millisecond
+	backoffMax  = 2 * time.Second
+)
+
+// helper function to get jittered exponential backoff of given retry attempt
+func backoff(attempt int) time.Duration {
+	delay := backoffBase << (attempt - 1)
+	if delay <= 0 || delay > backoffMax {
+		delay = backoffMax
+	}
+	// full jitter, see https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+	return time.Duration(rand.Int63n(int64(delay)))
+}
+
+// helper function to check if request should be retried
+func retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Do performs HTTP request to the service with user token from given context,
+// the caller is responsible to close body of returned response. GET requests
+// are retried with jittered backoff on network errors and gateway errors, and
+// all requests are rejected while circuit breaker of the service is open.
+func (c *Client) Do(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	return c.send(ctx, method, path, query, body, contentType, nil)
+}
+
+// helper function to perform request with additional headers, see Do
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string, header http.Header) (*http.Response, error) {
+	rurl := c.URL + path
+	if len(query) > 0 {
+		rurl += "?" + query.Encode()
+	}
+	if c.Breaker != nil && !c.Breaker.Allow() {
+		return nil, &Error{Service: c.Service, Method: method, URL: rurl, Err: ErrCircuitOpen}
+	}
+	attempts := 1
+	if method == "GET" {
+		attempts += c.Retries
+	}
+	var resp *http.Response
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			delay := backoff(attempt)
+			if c.Verbose > 0 {
+				log.Printf("retry %s service %s %s in %v, attempt %d", c.Service, method, rurl, delay, attempt)
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(delay):
+			}
+		}
+		resp, err = c.do(ctx, method, rurl, body, contentType, header)
+		if attempt == attempts-1 || !retryable(ctx, resp, err) {
+			break
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	}
+	if c.Breaker != nil {
+		switch {
+		case err != nil && ctx.Err() != nil:
+			// the caller gave up or its own deadline expired, e.g. deadline of
+			// the page fan-out, it does not tell anything about the service
+			c.Breaker.Release()
+		case err != nil || resp.StatusCode >= http.StatusInternalServerError:
+			c.Breaker.Failure()
+		default:
+			c.Breaker.Success()
+		}
+	}
+	if err != nil {
+		return nil, &Error{Service: c.Service, Method: method, URL: rurl, Err: err}
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		msg := strings.TrimSpace(string(data))
+		var r Response
+		if err := json.Unmarshal(data, &r); err == nil && r.Error != "" {
+			msg = r.Error
+		}
+		return nil, &Error{Service: c.Service, Method: method, URL: rurl, StatusCode: resp.StatusCode, Message: msg}
+	}
+	return resp, nil
+}
+
+// helper function to perform single HTTP request
+func (c *Client) do(ctx context.Context, method, rurl string, body io.Reader, contentType string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rurl, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if token := TokenFromContext(ctx); token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.Verbose > 0 {
+		log.Printf("query %s service %s %s", c.Service, method, rurl)
+	}
+	if c.Verbose > 1 {
+		dump, err := httputil.DumpRequestOut(req, true)
+		log.Println("request", string(dump), err)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if c.Verbose > 1 {
+		dump, err := httputil.DumpResponse(resp, true)
+		log.Println("response", string(dump), err)
+	}
+	return resp, nil
+}
+
+// helper function to perform request and decode its JSON response into out,
+// nil out discards the response
+func (c *Client) call(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string, out any) error {
+	if method == "GET" && c.Cache != nil && out != nil {
+		return c.cachedGet(ctx, path, query, out)
+	}
+	resp, err := c.Do(ctx, method, path, query, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	// empty response body is allowed, e.g. services may respond to writes without content
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil && err != io.EOF {
+		return &Error{Service: c.Service, Method: method, URL: c.URL + path, StatusCode: resp.StatusCode, Err: err}
+	}
+	return nil
+}
+
+// helper function to perform GET request through the response cache, fresh
+// entries are served from the cache while stale entries are revalidated by
+// the service using their ETag
+func (c *Client) cachedGet(ctx context.Context, path string, query url.Values, out any) error {
+	user := ""
+	if !c.Shared {
+		user = cacheUser(UserFromContext(ctx), TokenFromContext(ctx))
+	}
+	key := cacheKey(c.Service, path, query.Encode(), user)
+	entry, found, fresh := c.Cache.get(key)
+	if fresh {
+		c.Cache.hits.Add(1)
+		return c.decode(path, http.StatusOK, entry.data, out)
+	}
+	var header http.Header
+	if found && entry.etag != "" {
+		header = http.Header{"If-None-Match": []string{entry.etag}}
+	}
+	resp, err := c.send(ctx, "GET", path, query, nil, "", header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && header != nil {
+		io.Copy(io.Discard, resp.Body)
+		c.Cache.refresh(key)
+		c.Cache.revalidations.Add(1)
+		return c.decode(path, http.StatusOK, entry.data, out)
+	}
+	c.Cache.misses.Add(1)
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &Error{Service: c.Service, Method: "GET", URL: c.URL + path, StatusCode: resp.StatusCode, Err: err}
+	}
+	if err := c.decode(path, resp.StatusCode, data, out); err != nil {
+		return err
+	}
+	// failed service statuses and responses which should not be stored are not cached
+	if r, ok := out.(*Response); ok && r.Status != "" && r.Status != "ok" {
+		return nil
+	}
+	if strings.Contains(resp.Header.Get("Cache-Control"), "no-store") {
+		return nil
+	}
+	c.Cache.set(key, data, resp.Header.Get("ETag"))
+	return nil
+}
+
+// helper function to decode JSON response into out
+func (c *Client) decode(path string, status int, data []byte, out any) error {
+	if err := json.Unmarshal(data, out); err != nil {
+		return &Error{Service: c.Service, Method: "GET", URL: c.URL + path, StatusCode: status, Err: err}
+	}
+	return nil
+}
+
+// helper function to drop cached responses of the service with given path
+// prefix, it should be called after writes which change them
+func (c *Client) invalidate(prefix string) {
+	if c.Cache != nil {
+		c.Cache.Invalidate(c.Service, prefix)
+	}
+}
+
+// Get performs GET request and decodes JSON response into out
+func (c *Client) Get(ctx context.Context, path string, query url.Values, out any) error {
+	return c.call(ctx, "GET", path, query, nil, "", out)
+}
+
+// PostJSON performs POST request with JSON encoded input and decodes JSON response into out
+func (c *Client) PostJSON(ctx context.Context, path string, query url.Values, in, out any) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return c.call(ctx, "POST", path, query, bytes.NewReader(data), "application/json", out)
+}
+
+// PutJSON performs PUT request with JSON encoded input and decodes JSON response into out
+func (c *Client) PutJSON(ctx context.Context, path string, in, out any) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return c.call(ctx, "PUT", path, nil, bytes.NewReader(data), "application/json", out)
+}
+
+// PostForm performs POST request with url-encoded form and decodes JSON response into out
+func (c *Client) PostForm(ctx context.Context, path string, form url.Values, out any) error {
+	body := strings.NewReader(form.Encode())
+	return c.call(ctx, "POST", path, nil, body, "application/x-www-form-urlencoded", out)
+}
+
+// Delete performs DELETE request and decodes JSON response into out
+func (c *Client) Delete(ctx context.Context, path string, out any) error {
+	return c.call(ctx, "DELETE", path, nil, nil, "", out)
+}
+
+// helper function to check status of service response envelope and decode
+// its data into out
+func (c *Client) envelope(method, path string, r Response, out any) error {
+	if r.Status != "" && r.Status != "ok" {
+		msg := r.Error
+		if msg == "" {
+			msg = fmt.Sprintf("status %s", r.Status)
+		}
+		return &Error{Service: c.Service, Method: method, URL: c.URL + path, StatusCode: http.StatusOK, Message: msg}
+	}
+	if out == nil || len(r.Data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(r.Data, out); err != nil {
+		return &Error{Service: c.Service, Method: method, URL: c.URL + path, StatusCode: http.StatusOK, Err: err}
+	}
+	return nil
+}
+
+// Config represents configuration of OreCast service clients
+type Config struct {
+	DiscoveryURL       string
+	DataManagementURL  string
+	MetaDataURL        string
+	DataBookkeepingURL string
+	AuthzURL           string
+	ClientID           string        // OAuth client id of the application
+	ClientSecret       string        // OAuth client secret of the application
+	HTTPClient         *http.Client  // shared HTTP client, by default it is created by NewHTTPClient
+	Timeout            time.Duration // read timeout of service calls
+	ConnectTimeout     time.Duration // connect timeout of service calls
+	Retries            int           // number of retries of idempotent GET requests
+	BreakerThreshold   int           // number of consecutive failures to open circuit breaker, zero disables it
+	BreakerCooldown    time.Duration // period during which circuit breaker rejects calls
+	CacheTTL           time.Duration // lifetime of cached responses, zero disables caching
+	CacheMaxEntries    int           // maximum number of cached responses, zero means no limit
+	Verbose            int
+}
+
+// Services represents clients of all OreCast services
+type Services struct {
+	Discovery       *DiscoveryClient
+	DataManagement  *DataManagementClient
+	MetaData        *MetaDataClient
+	DataBookkeeping *DataBookkeepingClient
+	Authz           *AuthzClient
+	Cache           *Cache // response cache shared by all clients, nil if caching is disabled
+}
+
+// New creates clients of OreCast services, all clients share the same HTTP
+// transport and response cache while each service has its own circuit breaker.
+// Responses of Authz service are never cached and Discovery responses are
+// shared between users since site records do not depend on user permissions.
+func New(cfg Config) *Services {
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = NewHTTPClient(cfg)
+	}
+	srv := &Services{
+		Discovery:       &DiscoveryClient{NewClient("Discovery", cfg.DiscoveryURL, cfg)},
+		DataManagement:  &DataManagementClient{NewClient("DataManagement", cfg.DataManagementURL, cfg)},
+		MetaData:        &MetaDataClient{NewClient("MetaData", cfg.MetaDataURL, cfg)},
+		DataBookkeeping: &DataBookkeepingClient{NewClient("DataBookkeeping", cfg.DataBookkeepingURL, cfg)},
+		Authz: &AuthzClient{
+			Client:       NewClient("Authz", cfg.AuthzURL, cfg),
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+		},
+	}
+	if cfg.CacheTTL > 0 {
+		srv.Cache = NewCache(cfg.CacheTTL, cfg.CacheMaxEntries)
+		for _, c := range []*Client{srv.Discovery.Client, srv.DataManagement.Client, srv.MetaData.Client, srv.DataBookkeeping.Client} {
+			c.Cache = srv.Cache
+		}
+		srv.Discovery.Shared = true
+	}
+	return srv
+}
+
+// States returns circuit breaker states of all services
+func (s *Services) States() map[string]string {
+	states := make(map[string]string)
+	for _, c := range []*Client{s.Discovery.Client, s.DataManagement.Client, s.MetaData.Client, s.DataBookkeeping.Client, s.Authz.Client} {
+		states[c.Service] = StateClosed
+		if c.Breaker != nil {
+			states[c.Service] = c.Breaker.State()
+		}
+	}
+	return states
+}
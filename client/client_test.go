@@ -0,0 +1,204 @@
+package client
+
+// generic client tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// helper function to create client of test service
+func testClient(t *testing.T, handler http.HandlerFunc, cfg Config) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return NewClient("Test", srv.URL, cfg)
+}
+
+// TestErrorIs tests matching of service errors against OreCast errors
+func TestErrorIs(t *testing.T) {
+	targets := []error{ErrBadRequest, ErrUnauthorized, ErrForbidden, ErrNotFound, ErrUnavailable, ErrFailed}
+	tests := []struct {
+		status int
+		want   []error
+	}{
+		{0, []error{ErrUnavailable, ErrFailed}},
+		{http.StatusBadRequest, []error{ErrBadRequest, ErrFailed}},
+		{http.StatusUnauthorized, []error{ErrUnauthorized, ErrFailed}},
+		{http.StatusForbidden, []error{ErrForbidden, ErrFailed}},
+		{http.StatusNotFound, []error{ErrNotFound, ErrFailed}},
+		{http.StatusConflict, []error{ErrFailed}},
+		{http.StatusInternalServerError, []error{ErrUnavailable, ErrFailed}},
+		{http.StatusServiceUnavailable, []error{ErrUnavailable, ErrFailed}},
+	}
+	for _, tt := range tests {
+		var err error = &Error{Service: "Test", Method: "GET", URL: "/x", StatusCode: tt.status}
+		for _, target := range targets {
+			want := false
+			for _, w := range tt.want {
+				want = want || w == target
+			}
+			if got := errors.Is(err, target); got != want {
+				t.Errorf("status %d: errors.Is(%v) = %v, want %v", tt.status, target, got, want)
+			}
+		}
+	}
+	// underlying error is unwrapped
+	err := &Error{Service: "Test", Err: ErrCircuitOpen}
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Error("underlying error is not matched")
+	}
+}
+
+// TestErrorResponse tests errors of non 2xx responses
+func TestErrorResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		msg    string
+		target error
+	}{
+		{"envelope", http.StatusNotFound, `{"status":"fail","error":"no such site"}`, "no such site", ErrNotFound},
+		{"plain", http.StatusForbidden, "access denied\n", "access denied", ErrForbidden},
+		{"server", http.StatusInternalServerError, "boom", "boom", ErrUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}, Config{})
+			err := c.Get(context.Background(), "/x", nil, &Response{})
+			var e *Error
+			if !errors.As(err, &e) {
+				t.Fatalf("expected *Error, got %v", err)
+			}
+			if e.StatusCode != tt.status || e.Message != tt.msg {
+				t.Errorf("got status %d message %q, want %d %q", e.StatusCode, e.Message, tt.status, tt.msg)
+			}
+			if !errors.Is(err, tt.target) {
+				t.Errorf("error %v does not match %v", err, tt.target)
+			}
+		})
+	}
+}
+
+// TestEnvelope tests decoding of service response envelope
+func TestEnvelope(t *testing.T) {
+	c := &Client{Service: "Test", URL: "http://service"}
+	type record struct {
+		Name string `json:"name"`
+	}
+	tests := []struct {
+		name    string
+		resp    Response
+		want    string
+		wantErr bool
+	}{
+		{"data", Response{Status: "ok", Data: []byte(`{"name":"Cornell"}`)}, "Cornell", false},
+		{"no status", Response{Data: []byte(`{"name":"Cornell"}`)}, "Cornell", false},
+		{"no data", Response{Status: "ok"}, "", false},
+		{"failed status", Response{Status: "fail", Error: "duplicate record"}, "", true},
+		{"failed status without error", Response{Status: "error"}, "", true},
+		{"invalid data", Response{Status: "ok", Data: []byte(`[1, 2]`)}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rec record
+			err := c.envelope("POST", "/x", tt.resp, &rec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			var e *Error
+			if err != nil && !errors.As(err, &e) {
+				t.Errorf("expected *Error, got %T", err)
+			}
+			if rec.Name != tt.want {
+				t.Errorf("got name %q, want %q", rec.Name, tt.want)
+			}
+		})
+	}
+}
+
+// TestRetries tests that only GET requests are retried on gateway errors
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		method string
+		status int
+		calls  int32
+	}{
+		{"GET", http.StatusServiceUnavailable, 3},
+		{"GET", http.StatusBadGateway, 3},
+		{"GET", http.StatusNotFound, 1},
+		{"GET", http.StatusInternalServerError, 1},
+		{"POST", http.StatusServiceUnavailable, 1},
+		{"PUT", http.StatusServiceUnavailable, 1},
+		{"DELETE", http.StatusServiceUnavailable, 1},
+	}
+	for _, tt := range tests {
+		var calls atomic.Int32
+		c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(tt.status)
+		}, Config{Retries: 2})
+		resp, err := c.Do(context.Background(), tt.method, "/x", nil, nil, "")
+		if err == nil {
+			resp.Body.Close()
+			t.Errorf("%s %d: expected error", tt.method, tt.status)
+		}
+		if got := calls.Load(); got != tt.calls {
+			t.Errorf("%s %d: service is called %d times, want %d", tt.method, tt.status, got, tt.calls)
+		}
+	}
+}
+
+// TestRetrySuccess tests that retried GET request succeeds once service recovers
+func TestRetrySuccess(t *testing.T) {
+	var calls atomic.Int32
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return
+		}
+		io.WriteString(w, `{"status":"ok","data":[]}`)
+	}, Config{Retries: 2})
+	var r Response
+	if err := c.Get(context.Background(), "/x", nil, &r); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 2 || r.Status != "ok" {
+		t.Errorf("got %d calls and status %q", calls.Load(), r.Status)
+	}
+}
+
+// TestBackoff tests that backoff delays are bounded
+func TestBackoff(t *testing.T) {
+	for attempt := 1; attempt < 70; attempt++ {
+		if d := backoff(attempt); d < 0 || d > backoffMax {
+			t.Fatalf("attempt %d: backoff %v is out of range", attempt, d)
+		}
+	}
+}
+
+// TestToken tests that user token is sent to the service
+func TestToken(t *testing.T) {
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"status":"ok","data":"`+r.Header.Get("Authorization")+`"}`)
+	}, Config{})
+	var r Response
+	if err := c.Get(WithToken(context.Background(), "abc"), "/x", nil, &r); err != nil {
+		t.Fatal(err)
+	}
+	if string(r.Data) != `"Bearer abc"` {
+		t.Errorf("got authorization %s", r.Data)
+	}
+}
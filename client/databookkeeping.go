@@ -0,0 +1,67 @@
+package client
+
+// DataBookkeeping service client
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// DBSRecord represents dataset record of DataBookkeeping service, e.g.
+// {"create_by":"OreCast-workflow","creation_date":1696853600,"dataset":"/a/b/c","last_modification_date":1696853600,"last_modified_by":"OreCast-workflow","meta_id":"123xyz","parent":null,"processing":"glibc","site":"Cornell"}
+type DBSRecord struct {
+	Dataset              string `json:"dataset"`
+	MetaId               string `json:"meta_id"`
+	Parent               string `json:"parent"`
+	Processing           string `json:"processing"`
+	Site                 string `json:"site"`
+	CreateBy             string `json:"create_by"`
+	CreationDate         int64  `json:"creation_date"`
+	LastModifiedBy       string `json:"last_modified_by"`
+	LastModificationdate int64  `json:"last_modification_date"`
+}
+
+// DataBookkeepingClient represents client of DataBookkeeping service
+type DataBookkeepingClient struct {
+	*Client
+}
+
+// Datasets returns all datasets known to DataBookkeeping service
+func (c *DataBookkeepingClient) Datasets(ctx context.Context) ([]DBSRecord, error) {
+	var records []DBSRecord
+	err := c.Get(ctx, "/datasets", nil, &records)
+	return records, err
+}
+
+// SearchDatasets returns datasets matching given query parameters, e.g.
+// site=Cornell&dataset=/drill/*
+func (c *DataBookkeepingClient) SearchDatasets(ctx context.Context, query url.Values) ([]DBSRecord, error) {
+	var records []DBSRecord
+	err := c.Get(ctx, "/datasets", query, &records)
+	return records, err
+}
+
+// Dataset returns records of given dataset
+func (c *DataBookkeepingClient) Dataset(ctx context.Context, dataset string) ([]DBSRecord, error) {
+	var records []DBSRecord
+	// dataset names start with slash, e.g. /a/b/c
+	err := c.Get(ctx, fmt.Sprintf("/dataset/%s", strings.TrimPrefix(dataset, "/")), nil, &records)
+	return records, err
+}
+
+// AddDataset registers new dataset record
+func (c *DataBookkeepingClient) AddDataset(ctx context.Context, rec DBSRecord) error {
+	var r Response
+	err := c.PostJSON(ctx, "/dataset", nil, rec, &r)
+	c.invalidate("/datasets")
+	c.invalidate("/dataset")
+	if err != nil {
+		return err
+	}
+	return c.envelope("POST", "/dataset", r, nil)
+}
@@ -0,0 +1,83 @@
+package client
+
+// DataManagement service client
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"context"
+	"fmt"
+)
+
+// Bucket represents site bucket returned by DataManagement service
+type Bucket struct {
+	Name         string `json:"name"`
+	CreationDate string `json:"creationDate"`
+}
+
+// Object represents bucket object returned by DataManagement service
+type Object struct {
+	Name         string `json:"name"`
+	ETag         string `json:"etag"`
+	Size         int64  `json:"size"`
+	LastModified string `json:"lastModified"`
+}
+
+// DataManagementClient represents client of DataManagement service
+type DataManagementClient struct {
+	*Client
+}
+
+// Buckets returns buckets of given site
+func (c *DataManagementClient) Buckets(ctx context.Context, site string) ([]Bucket, error) {
+	path := fmt.Sprintf("/storage/%s", site)
+	var r Response
+	if err := c.Get(ctx, path, nil, &r); err != nil {
+		return nil, err
+	}
+	var data struct {
+		Site    string   `json:"site"`
+		Buckets []Bucket `json:"buckets"`
+	}
+	err := c.envelope("GET", path, r, &data)
+	return data.Buckets, err
+}
+
+// Objects returns objects of given site bucket
+func (c *DataManagementClient) Objects(ctx context.Context, site, bucket string) ([]Object, error) {
+	path := fmt.Sprintf("/storage/%s/%s", site, bucket)
+	var r Response
+	if err := c.Get(ctx, path, nil, &r); err != nil {
+		return nil, err
+	}
+	var data struct {
+		Site    string   `json:"site"`
+		Bucket  string   `json:"bucket"`
+		Objects []Object `json:"objects"`
+	}
+	err := c.envelope("GET", path, r, &data)
+	return data.Objects, err
+}
+
+// CreateBucket creates new bucket at given site
+func (c *DataManagementClient) CreateBucket(ctx context.Context, site, bucket string) error {
+	path := fmt.Sprintf("/storage/%s/%s", site, bucket)
+	err := c.PostForm(ctx, path, nil, nil)
+	c.invalidate(fmt.Sprintf("/storage/%s", site))
+	return err
+}
+
+// DeleteBucket deletes bucket at given site
+func (c *DataManagementClient) DeleteBucket(ctx context.Context, site, bucket string) error {
+	path := fmt.Sprintf("/storage/%s/%s", site, bucket)
+	err := c.Delete(ctx, path, nil)
+	c.invalidate(fmt.Sprintf("/storage/%s", site))
+	return err
+}
+
+// InvalidateObjects drops cached objects of given site bucket, it should be
+// called after objects are changed directly in site storage
+func (c *DataManagementClient) InvalidateObjects(site, bucket string) {
+	c.invalidate(fmt.Sprintf("/storage/%s/%s", site, bucket))
+}
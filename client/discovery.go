@@ -0,0 +1,77 @@
+package client
+
+// Discovery service client
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Site represents site record of Discovery service, site access key and secret
+// are stored encrypted in Discovery service
+type Site struct {
+	Name         string `json:"name" form:"name" binding:"required"`
+	URL          string `json:"url" form:"url" binding:"required"`
+	Endpoint     string `json:"endpoint" form:"endpoint" binding:"required"`
+	AccessKey    string `json:"access_key" form:"access_key" binding:"required"`
+	AccessSecret string `json:"access_secret" form:"access_secret" binding:"required"`
+	UseSSL       bool   `json:"use_ssl" form:"use_ssl"`
+	Description  string `json:"description" form:"description"`
+}
+
+// DiscoveryClient represents client of Discovery service
+type DiscoveryClient struct {
+	*Client
+}
+
+// Sites returns all sites registered in Discovery service
+func (c *DiscoveryClient) Sites(ctx context.Context) ([]Site, error) {
+	var sites []Site
+	err := c.Get(ctx, "/sites", nil, &sites)
+	return sites, err
+}
+
+// Site returns record of given site
+func (c *DiscoveryClient) Site(ctx context.Context, name string) (Site, error) {
+	sites, err := c.Sites(ctx)
+	if err != nil {
+		return Site{}, err
+	}
+	for _, site := range sites {
+		if site.Name == name {
+			return site, nil
+		}
+	}
+	return Site{}, &Error{
+		Service:    c.Service,
+		Method:     "GET",
+		URL:        c.URL + "/sites",
+		StatusCode: http.StatusNotFound,
+		Message:    fmt.Sprintf("site %s is not found in Discovery records", name),
+	}
+}
+
+// AddSite registers new site in Discovery service
+func (c *DiscoveryClient) AddSite(ctx context.Context, site Site) error {
+	err := c.PostJSON(ctx, "/sites", nil, site, nil)
+	c.invalidate("/sites")
+	return err
+}
+
+// UpdateSite updates record of given site in Discovery service
+func (c *DiscoveryClient) UpdateSite(ctx context.Context, site Site) error {
+	err := c.PutJSON(ctx, fmt.Sprintf("/site/%s", site.Name), site, nil)
+	c.invalidate("/sites")
+	return err
+}
+
+// DeleteSite removes record of given site from Discovery service
+func (c *DiscoveryClient) DeleteSite(ctx context.Context, name string) error {
+	err := c.Delete(ctx, fmt.Sprintf("/site/%s", name), nil)
+	c.invalidate("/sites")
+	return err
+}
@@ -0,0 +1,118 @@
+package client
+
+// MetaData service client
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// MetaData represents meta-data record of MetaData service, records of
+// projects with registered schemas carry attributes described by the schema
+type MetaData struct {
+	ID          string         `json:"id"`
+	Site        string         `json:"site"`
+	Description string         `json:"description"`
+	Tags        []string       `json:"tags"`
+	Bucket      string         `json:"bucket"`
+	Project     string         `json:"project,omitempty"`
+	Attributes  map[string]any `json:"attributes,omitempty"`
+}
+
+// MetaDataClient represents client of MetaData service
+type MetaDataClient struct {
+	*Client
+}
+
+// Records returns meta-data records of given site
+func (c *MetaDataClient) Records(ctx context.Context, site string) ([]MetaData, error) {
+	path := fmt.Sprintf("/meta/%s", site)
+	var r Response
+	if err := c.Get(ctx, path, nil, &r); err != nil {
+		return nil, err
+	}
+	var records []MetaData
+	err := c.envelope("GET", path, r, &records)
+	return records, err
+}
+
+// Record returns meta-data record with given id
+func (c *MetaDataClient) Record(ctx context.Context, mid string) (MetaData, error) {
+	path := fmt.Sprintf("/meta/record/%s", mid)
+	var r Response
+	if err := c.Get(ctx, path, nil, &r); err != nil {
+		return MetaData{}, err
+	}
+	var records []MetaData
+	if err := c.envelope("GET", path, r, &records); err != nil {
+		return MetaData{}, err
+	}
+	if len(records) == 0 {
+		return MetaData{}, &Error{
+			Service:    c.Service,
+			Method:     "GET",
+			URL:        c.URL + path,
+			StatusCode: http.StatusNotFound,
+			Message:    fmt.Sprintf("meta-data record %s is not found", mid),
+		}
+	}
+	return records[0], nil
+}
+
+// AddRecord creates new meta-data record, the record id is assigned by
+// MetaData service and it is provided by returned record
+func (c *MetaDataClient) AddRecord(ctx context.Context, rec MetaData) (MetaData, error) {
+	var r Response
+	err := c.PostJSON(ctx, "/meta", nil, rec, &r)
+	c.invalidate("/meta")
+	if err != nil {
+		return rec, err
+	}
+	// service may provide created record either as object or as list of records
+	var created []MetaData
+	if data := bytes.TrimSpace(r.Data); len(data) > 0 && data[0] != '[' {
+		r.Data = append(append([]byte{'['}, data...), ']')
+	}
+	if err := c.envelope("POST", "/meta", r, &created); err != nil {
+		return rec, err
+	}
+	if len(created) == 0 || created[0].ID == "" {
+		return rec, &Error{
+			Service:    c.Service,
+			Method:     "POST",
+			URL:        c.URL + "/meta",
+			StatusCode: http.StatusOK,
+			Message:    "id of created meta-data record is not provided",
+		}
+	}
+	return created[0], nil
+}
+
+// UpdateRecord updates existing meta-data record
+func (c *MetaDataClient) UpdateRecord(ctx context.Context, rec MetaData) error {
+	path := fmt.Sprintf("/meta/%s", rec.ID)
+	var r Response
+	err := c.PutJSON(ctx, path, rec, &r)
+	c.invalidate("/meta")
+	if err != nil {
+		return err
+	}
+	return c.envelope("PUT", path, r, nil)
+}
+
+// DeleteRecord deletes meta-data record with given id
+func (c *MetaDataClient) DeleteRecord(ctx context.Context, mid string) error {
+	path := fmt.Sprintf("/meta/%s", mid)
+	var r Response
+	err := c.Delete(ctx, path, &r)
+	c.invalidate("/meta")
+	if err != nil {
+		return err
+	}
+	return c.envelope("DELETE", path, r, nil)
+}
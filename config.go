@@ -0,0 +1,146 @@
+package main
+
+// configuration module
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"log"
+
+	oreConfig "github.com/OreCast/common/config"
+	"github.com/spf13/viper"
+)
+
+// FrontendConfig represents frontend specific configuration parameters.
+// They are not part of OreCast common configuration and therefore we read them
+// from frontend section of the same configuration file.
+type FrontendConfig struct {
+	// session parts
+	SessionBackend     string `mapstructure:"session_backend"`      // session backend: memory, file or redis
+	SessionFile        string `mapstructure:"session_file"`         // BoltDB file used by file backend
+	SessionRedis       string `mapstructure:"session_redis"`        // address of redis-compatible server
+	SessionSecret      string `mapstructure:"session_secret"`       // secret to sign session ids
+	SessionIdleTimeout int64  `mapstructure:"session_idle_timeout"` // session idle timeout in seconds
+	SessionMaxAge      int64  `mapstructure:"session_max_age"`      // session absolute timeout in seconds
+
+	// storage parts
+	UploadMaxSize     int64  `mapstructure:"upload_max_size"`     // maximum size of uploaded object in bytes
+	UploadExpire      int64  `mapstructure:"upload_expire"`       // lifetime of resumable uploads in seconds
+	UploadFile        string `mapstructure:"upload_file"`         // BoltDB file with pending resumable uploads
+	PresignMaxExpires int64  `mapstructure:"presign_max_expires"` // maximum lifetime of presigned urls in seconds
+	AccessLog         string `mapstructure:"access_log"`          // access log file of data downloads
+	PreviewSize       int64  `mapstructure:"preview_size"`        // number of bytes read to preview objects
+	PreviewImageSize  int64  `mapstructure:"preview_image_size"`  // maximum size of images to make thumbnails
+
+	// upstream services parts
+	ServiceTimeout        int64 `mapstructure:"service_timeout"`         // read timeout of upstream service calls in seconds
+	ServiceConnectTimeout int64 `mapstructure:"service_connect_timeout"` // connect timeout of upstream service calls in seconds
+	ServiceRetries        int   `mapstructure:"service_retries"`         // number of retries of GET calls, negative value disables retries
+	BreakerThreshold      int   `mapstructure:"breaker_threshold"`       // failures to open circuit breaker, negative value disables it
+	BreakerCooldown       int64 `mapstructure:"breaker_cooldown"`        // circuit breaker cooldown period in seconds
+	FanoutWorkers         int   `mapstructure:"fanout_workers"`          // number of concurrent calls per page
+	FanoutTimeout         int64 `mapstructure:"fanout_timeout"`          // deadline of concurrent calls per page in seconds
+	CacheTTL              int64 `mapstructure:"cache_ttl"`               // lifetime of cached service responses in seconds, negative value disables cache
+	CacheMaxEntries       int   `mapstructure:"cache_max_entries"`       // maximum number of cached service responses
+
+	// meta-data parts
+	SchemaDir   string `mapstructure:"schema_dir"`   // directory with JSON schemas of projects
+	HistoryFile string `mapstructure:"history_file"` // BoltDB file with revisions of meta-data records
+
+	// dataset parts
+	QueryFile string `mapstructure:"query_file"` // BoltDB file with saved dataset queries of users
+
+	// access control parts
+	PolicyFile string `mapstructure:"policy_file"` // local policy file with user roles
+}
+
+// frontendConfig holds frontend specific configuration
+var frontendConfig FrontendConfig
+
+// helper function to read frontend specific configuration
+func initConfig() {
+	if err := viper.UnmarshalKey("frontend", &frontendConfig); err != nil {
+		log.Fatal("ERROR: unable to parse frontend configuration ", err)
+	}
+	if frontendConfig.SessionBackend == "" {
+		frontendConfig.SessionBackend = "memory"
+	}
+	if frontendConfig.SessionFile == "" {
+		frontendConfig.SessionFile = "/tmp/orecast_sessions.db"
+	}
+	if frontendConfig.SessionIdleTimeout == 0 {
+		frontendConfig.SessionIdleTimeout = 3600
+	}
+	if frontendConfig.SessionMaxAge == 0 {
+		frontendConfig.SessionMaxAge = 86400
+	}
+	if frontendConfig.UploadMaxSize == 0 {
+		frontendConfig.UploadMaxSize = 5 * 1024 * 1024 * 1024
+	}
+	if frontendConfig.UploadMaxSize > maxUploadParts*uploadPartSize {
+		log.Fatalf("ERROR: upload_max_size %d exceeds limit of %d parts of %d bytes",
+			frontendConfig.UploadMaxSize, maxUploadParts, uploadPartSize)
+	}
+	if frontendConfig.UploadExpire == 0 {
+		frontendConfig.UploadExpire = 86400
+	}
+	if frontendConfig.UploadFile == "" {
+		frontendConfig.UploadFile = "/tmp/orecast_uploads.db"
+	}
+	if frontendConfig.PresignMaxExpires == 0 {
+		frontendConfig.PresignMaxExpires = 3600
+	}
+	if frontendConfig.AccessLog == "" {
+		frontendConfig.AccessLog = "/tmp/orecast_access.log"
+	}
+	if frontendConfig.PreviewSize == 0 {
+		frontendConfig.PreviewSize = 256 * 1024
+	}
+	if frontendConfig.PreviewImageSize == 0 {
+		frontendConfig.PreviewImageSize = 10 * 1024 * 1024
+	}
+	if frontendConfig.ServiceTimeout == 0 {
+		frontendConfig.ServiceTimeout = 10
+	}
+	if frontendConfig.ServiceConnectTimeout == 0 {
+		frontendConfig.ServiceConnectTimeout = 3
+	}
+	if frontendConfig.ServiceRetries == 0 {
+		frontendConfig.ServiceRetries = 2
+	}
+	if frontendConfig.BreakerThreshold == 0 {
+		frontendConfig.BreakerThreshold = 5
+	}
+	if frontendConfig.BreakerCooldown == 0 {
+		frontendConfig.BreakerCooldown = 30
+	}
+	if frontendConfig.FanoutWorkers == 0 {
+		frontendConfig.FanoutWorkers = 8
+	}
+	if frontendConfig.FanoutTimeout == 0 {
+		frontendConfig.FanoutTimeout = 5
+	}
+	if frontendConfig.CacheTTL == 0 {
+		frontendConfig.CacheTTL = 60
+	}
+	if frontendConfig.CacheMaxEntries == 0 {
+		frontendConfig.CacheMaxEntries = 1000
+	}
+	if frontendConfig.SchemaDir == "" {
+		frontendConfig.SchemaDir = "/tmp/orecast_schemas"
+	}
+	if frontendConfig.HistoryFile == "" {
+		frontendConfig.HistoryFile = "/tmp/orecast_history.db"
+	}
+	if frontendConfig.QueryFile == "" {
+		frontendConfig.QueryFile = "/tmp/orecast_queries.db"
+	}
+	if frontendConfig.SessionSecret == "" {
+		frontendConfig.SessionSecret = oreConfig.Config.Encryption.Secret
+	}
+	if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
+		log.Printf("frontend configuration: session backend=%s idle=%ds max-age=%ds",
+			frontendConfig.SessionBackend, frontendConfig.SessionIdleTimeout, frontendConfig.SessionMaxAge)
+	}
+}
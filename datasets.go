@@ -1,46 +1,270 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"regexp"
+	"sort"
 
-	oreConfig "github.com/OreCast/common/config"
+	"github.com/OreCast/Frontend/client"
+	"github.com/gin-gonic/gin"
 )
 
-// {"create_by":"OreCast-workflow","creation_date":1696853600,"dataset":"/a/b/c","last_modification_date":1696853600,"last_modified_by":"OreCast-workflow","meta_id":"123xyz","parent":null,"processing":"glibc","site":"Cornell"}
-type DBSRecord struct {
-	Dataset              string `json:"dataset"`
-	MetaId               string `json:"meta_id"`
-	Parent               string `json:"parent"`
-	Processing           string `json:"processing"`
-	Site                 string `json:"site"`
-	CreateBy             string `json:"create_by"`
-	CreationDate         int64  `json:"creation_date"`
-	LastModifiedBy       string `json:"last_modified_by"`
-	LastModificationdate int64  `json:"last_modification_date"`
-}
-
-func getDatasets(ds string) []DBSRecord {
-	var datasets []DBSRecord
-	rurl := fmt.Sprintf("%s/datasets", oreConfig.Config.Services.DataBookkeepingURL)
+// DBSRecord represents dataset record of DataBookkeeping service
+type DBSRecord = client.DBSRecord
+
+// helper function to fetch datasets from DataBookkeeping service, empty dataset
+// name implies all datasets
+func getDatasets(c *gin.Context, ds string) ([]DBSRecord, error) {
 	if ds != "" {
-		rurl = fmt.Sprintf("%s/dataset/%s", oreConfig.Config.Services.DataBookkeepingURL, ds)
+		records, err := _services.DataBookkeeping.Dataset(serviceContext(c), ds)
+		return records, serviceError(c, err)
 	}
-	resp, err := httpGet(rurl)
-	if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
-		log.Println("query DataBookkeeping service rurl", rurl, err)
+	records, err := _services.DataBookkeeping.Datasets(serviceContext(c))
+	return records, serviceError(c, err)
+}
+
+// helper function to get sorted unique names of datasets, dataset may have
+// several DataBookkeeping records
+func datasetNames(records []DBSRecord) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, r := range records {
+		if r.Dataset != "" && !seen[r.Dataset] {
+			names = append(names, r.Dataset)
+			seen[r.Dataset] = true
+		}
 	}
-	if err != nil {
+	sort.Strings(names)
+	return names
+}
+
+// datasetPath defines dataset path convention /project/campaign/tier
+var datasetPath = regexp.MustCompile(`^/[A-Za-z0-9][A-Za-z0-9_.-]*/[A-Za-z0-9][A-Za-z0-9_.-]*/[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// DatasetForm represents dataset registration form on web UI and JSON body of
+// dataset registration requests
+type DatasetForm struct {
+	Dataset    string `form:"dataset" json:"dataset"`
+	Site       string `form:"site" json:"site"`
+	MetaId     string `form:"meta_id" json:"meta_id"`
+	Parent     string `form:"parent" json:"parent"`
+	Processing string `form:"processing" json:"processing"`
+}
+
+// DatasetOptions represents choices of dataset registration form
+type DatasetOptions struct {
+	Sites       []string   `json:"sites"`
+	MetaRecords []MetaData `json:"meta_records"` // meta-data records of selected site
+	Datasets    []string   `json:"datasets"`     // existing datasets which can be parents
+}
+
+// helper function to get choices of dataset registration form, services
+// which are not available leave their choices empty
+func datasetOptions(c *gin.Context, site string) DatasetOptions {
+	var opts DatasetOptions
+	if sites, err := getSites(c); err == nil {
+		for _, s := range sites {
+			opts.Sites = append(opts.Sites, s.Name)
+		}
+	} else {
 		log.Println("ERROR:", err)
-		return datasets
 	}
-	defer resp.Body.Close()
-	dec := json.NewDecoder(resp.Body)
-	if err := dec.Decode(&datasets); err != nil {
+	if site != "" {
+		if records, err := metadata(c, site); err == nil {
+			opts.MetaRecords = records
+		} else {
+			log.Println("ERROR:", err)
+		}
+	}
+	if records, err := getDatasets(c, ""); err == nil {
+		opts.Datasets = datasetNames(records)
+	} else {
 		log.Println("ERROR:", err)
-		return datasets
 	}
-	return datasets
+	return opts
+}
+
+// helper function to validate dataset registration form against dataset
+// path convention and existing sites, meta-data records and datasets,
+// errors are reported per form field
+func validateDataset(c *gin.Context, form DatasetForm) (map[string]string, error) {
+	errs := make(map[string]string)
+	switch {
+	case form.Dataset == "":
+		errs["dataset"] = "this field is required"
+	case !datasetPath.MatchString(form.Dataset):
+		errs["dataset"] = "dataset should follow /project/campaign/tier convention, e.g. /drill/campaign2023/raw"
+	}
+	if form.Processing == "" {
+		errs["processing"] = "this field is required"
+	}
+	if form.Parent != "" && form.Parent == form.Dataset {
+		errs["parent"] = "dataset can not be its own parent"
+	} else if form.Parent != "" && !datasetPath.MatchString(form.Parent) {
+		errs["parent"] = "parent should follow /project/campaign/tier convention"
+	}
 
+	sites, err := getSites(c)
+	if err != nil {
+		return errs, err
+	}
+	found := false
+	for _, s := range sites {
+		found = found || s.Name == form.Site
+	}
+	if form.Site == "" {
+		errs["site"] = "this field is required"
+	} else if !found {
+		errs["site"] = fmt.Sprintf("site %s is not registered", form.Site)
+	}
+
+	if form.MetaId == "" {
+		errs["meta_id"] = "this field is required"
+	} else if found {
+		records, err := metadata(c, form.Site)
+		if err != nil {
+			return errs, err
+		}
+		known := false
+		for _, r := range records {
+			known = known || r.ID == form.MetaId
+		}
+		if !known {
+			errs["meta_id"] = fmt.Sprintf("meta-data record %s does not exist at site %s", form.MetaId, form.Site)
+		}
+	}
+
+	records, err := getDatasets(c, "")
+	if err != nil {
+		return errs, err
+	}
+	parentFound := false
+	for _, r := range records {
+		if r.Dataset == form.Dataset && errs["dataset"] == "" {
+			errs["dataset"] = fmt.Sprintf("dataset %s is already registered", form.Dataset)
+		}
+		parentFound = parentFound || r.Dataset == form.Parent
+	}
+	if form.Parent != "" && !parentFound && errs["parent"] == "" {
+		errs["parent"] = fmt.Sprintf("parent dataset %s is not registered", form.Parent)
+	}
+	return errs, nil
+}
+
+// helper function to register dataset in DataBookkeeping service
+func addDataset(c *gin.Context, rec DBSRecord) error {
+	err := _services.DataBookkeeping.AddDataset(serviceContext(c), rec)
+	return serviceError(c, err)
+}
+
+// datasetMaxObjects defines number of bucket objects shown on dataset page
+const datasetMaxObjects = 100
+
+// DatasetDetails represents dataset detail page which joins DataBookkeeping
+// record of the dataset with its meta-data record, storage bucket and
+// lineage
+type DatasetDetails struct {
+	Dataset   string          `json:"dataset"`
+	Record    DBSRecord       `json:"record"`
+	Meta      *MetaData       `json:"meta,omitempty"`
+	Bucket    string          `json:"bucket,omitempty"`
+	Exists    bool            `json:"bucket_exists"`
+	NObjects  int             `json:"nobjects"`
+	TotalSize int64           `json:"total_size"`        // total size of bucket objects in bytes
+	Objects   []client.Object `json:"objects,omitempty"` // first datasetMaxObjects objects of the bucket
+	Parent    string          `json:"parent,omitempty"`
+	Ancestors []string        `json:"ancestors,omitempty"` // parents of the dataset starting from its root
+	Children  []string        `json:"children,omitempty"`
+	Orphaned  bool            `json:"orphaned"`
+	Problems  []string        `json:"problems,omitempty"` // reasons why dataset is orphaned
+	Warnings  []string        `json:"warnings,omitempty"` // checks which could not be done
+}
+
+// helper function to get dataset details, the dataset is orphaned if its
+// meta-data record, bucket or parent dataset does not exist. Checks of
+// services which are not available are reported as warnings.
+func datasetDetails(c *gin.Context, dataset string) (DatasetDetails, error) {
+	details := DatasetDetails{Dataset: dataset}
+	records, err := getDatasets(c, dataset)
+	if err != nil {
+		return details, err
+	}
+	found := false
+	for _, r := range records {
+		if r.Dataset == dataset {
+			details.Record = r
+			found = true
+			break
+		}
+	}
+	if !found {
+		return details, fmt.Errorf("dataset %s is not found: %w", dataset, client.ErrNotFound)
+	}
+	rec := details.Record
+	details.Parent = rec.Parent
+	ctx := serviceContext(c)
+
+	// meta-data record points to storage bucket of the dataset
+	site := rec.Site
+	if rec.MetaId == "" {
+		details.Problems = append(details.Problems, "dataset has no meta-data record")
+	} else if meta, err := getMetaRecord(c, rec.MetaId); err == nil {
+		details.Meta = &meta
+		details.Bucket = meta.Bucket
+		if site == "" {
+			site = meta.Site
+		}
+	} else if errors.Is(err, client.ErrNotFound) {
+		details.Problems = append(details.Problems, fmt.Sprintf("meta-data record %s does not exist", rec.MetaId))
+	} else {
+		details.Warnings = append(details.Warnings, fmt.Sprintf("unable to check meta-data record %s: %v", rec.MetaId, err))
+	}
+	if details.Bucket != "" {
+		exists, err := bucketExists(c, site, details.Bucket)
+		switch {
+		case err != nil:
+			details.Warnings = append(details.Warnings, fmt.Sprintf("unable to check bucket %s: %v", details.Bucket, err))
+		case !exists:
+			details.Problems = append(details.Problems, fmt.Sprintf("bucket %s does not exist at site %s", details.Bucket, site))
+		default:
+			details.Exists = true
+			objects, err := _services.DataManagement.Objects(ctx, site, details.Bucket)
+			if err = serviceError(c, err); err != nil {
+				details.Warnings = append(details.Warnings, fmt.Sprintf("unable to list objects of bucket %s: %v", details.Bucket, err))
+			}
+			details.NObjects = len(objects)
+			for _, obj := range objects {
+				details.TotalSize += obj.Size
+			}
+			if len(objects) > datasetMaxObjects {
+				objects = objects[:datasetMaxObjects]
+			}
+			details.Objects = objects
+		}
+	}
+
+	// parents and children of the dataset are provided by lineage graph
+	all, err := getDatasets(c, "")
+	if err != nil {
+		details.Warnings = append(details.Warnings, fmt.Sprintf("unable to obtain lineage of the dataset: %v", err))
+	} else if graph, err := buildLineage(all, dataset); err == nil {
+		nodes := make(map[string]LineageNode)
+		for _, n := range graph.Nodes {
+			nodes[n.Dataset] = n
+		}
+		details.Children = nodes[dataset].Children
+		sort.Strings(details.Children)
+		seen := map[string]bool{dataset: true}
+		for name := rec.Parent; name != "" && !seen[name]; name = nodes[name].Parent {
+			seen[name] = true
+			details.Ancestors = append([]string{name}, details.Ancestors...)
+			if name == rec.Parent && nodes[name].Missing {
+				details.Problems = append(details.Problems, fmt.Sprintf("parent dataset %s is not registered", name))
+			}
+		}
+	}
+	details.Orphaned = len(details.Problems) > 0
+	return details, nil
 }
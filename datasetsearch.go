@@ -0,0 +1,465 @@
+package main
+
+// dataset search module
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+// Datasets are searched by small query language, the query is list of
+// space separated terms <key><op><value>, e.g.
+//
+//	site=Cornell processing=glibc dataset=/drill/* created>2024-01-01 parent=
+//
+// Keys are dataset, site, processing, parent, meta_id, user, created and
+// modified. String keys support = and != operators and * and ? wildcards,
+// dates support =, !=, >, >=, < and <= operators with YYYY-MM-DD, RFC3339
+// or unix time values. Empty value matches empty field, e.g. parent= finds
+// datasets without parent, and values with spaces are quoted. Term without
+// operator matches part of dataset name. All terms should match.
+//
+// Equality terms are translated to DataBookkeeping query parameters while
+// all terms are applied to obtained records as well, therefore results are
+// correct even if DataBookkeeping does not support some of the filters. If
+// DataBookkeeping rejects the query all datasets are filtered by frontend.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OreCast/Frontend/client"
+	oreConfig "github.com/OreCast/common/config"
+	"github.com/gin-gonic/gin"
+	bolt "go.etcd.io/bbolt"
+)
+
+// datasetQueryKeys lists keys of dataset query language
+var datasetQueryKeys = []string{"dataset", "site", "processing", "parent", "meta_id", "user", "created", "modified"}
+
+// dbsQueryKeys lists keys which are passed to DataBookkeeping service
+var dbsQueryKeys = map[string]bool{"dataset": true, "site": true, "processing": true, "parent": true, "meta_id": true}
+
+// datasetQueryOps lists operators of dataset query language, longer
+// operators come first
+var datasetQueryOps = []string{">=", "<=", "!=", "=", ">", "<"}
+
+// datasetSortKeys lists allowed sort keys of dataset search
+var datasetSortKeys = []string{"dataset", "site", "processing", "created", "modified"}
+
+// DatasetTerm represents term of dataset query
+type DatasetTerm struct {
+	Key   string `json:"key"`
+	Op    string `json:"op"`
+	Value string `json:"value"`
+
+	pattern *regexp.Regexp // pattern of string value
+	from    int64          // time range [from, to) of date value
+	to      int64
+}
+
+// helper function to split dataset query into terms, double quotes keep
+// spaces within values
+func splitDatasetQuery(query string) ([]string, error) {
+	var tokens []string
+	var token strings.Builder
+	quoted, started := false, false
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			started = true
+		case !quoted && (r == ' ' || r == '\t' || r == '\n'):
+			if started {
+				tokens = append(tokens, token.String())
+				token.Reset()
+				started = false
+			}
+		default:
+			token.WriteRune(r)
+			started = true
+		}
+	}
+	if quoted {
+		return nil, errors.New("unterminated quote in dataset query")
+	}
+	if started {
+		tokens = append(tokens, token.String())
+	}
+	return tokens, nil
+}
+
+// helper function to compile wildcard pattern of string value
+func globPattern(value string) (*regexp.Regexp, error) {
+	expr := regexp.QuoteMeta(value)
+	expr = strings.ReplaceAll(expr, `\*`, ".*")
+	expr = strings.ReplaceAll(expr, `\?`, ".")
+	return regexp.Compile("(?i)^" + expr + "$")
+}
+
+// helper function to parse date value into time range it covers
+func dateRange(value string) (int64, int64, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t.Unix(), t.AddDate(0, 0, 1).Unix(), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.Unix(), t.Unix() + 1, nil
+	}
+	if ts, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return ts, ts + 1, nil
+	}
+	return 0, 0, fmt.Errorf("invalid date %q, use YYYY-MM-DD, RFC3339 or unix time", value)
+}
+
+// helper function to parse dataset query into its terms
+func parseDatasetQuery(query string) ([]DatasetTerm, error) {
+	tokens, err := splitDatasetQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	var terms []DatasetTerm
+	for _, token := range tokens {
+		term := DatasetTerm{Key: "dataset", Op: "=", Value: "*" + token + "*"}
+		pos := -1
+		for _, op := range datasetQueryOps {
+			// the first operator in the token wins, longer operators at the
+			// same position come first
+			if idx := strings.Index(token, op); idx > 0 && (pos < 0 || idx < pos) {
+				pos = idx
+				term = DatasetTerm{Key: strings.ToLower(token[:idx]), Op: op, Value: token[idx+len(op):]}
+			}
+		}
+		known := false
+		for _, key := range datasetQueryKeys {
+			known = known || key == term.Key
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown key %q in dataset query, supported keys: %s", term.Key, strings.Join(datasetQueryKeys, ", "))
+		}
+		if term.Key == "created" || term.Key == "modified" {
+			if term.from, term.to, err = dateRange(term.Value); err != nil {
+				return nil, err
+			}
+		} else {
+			if term.Op != "=" && term.Op != "!=" {
+				return nil, fmt.Errorf("operator %s is not supported by %s, use = or !=", term.Op, term.Key)
+			}
+			if term.pattern, err = globPattern(term.Value); err != nil {
+				return nil, err
+			}
+		}
+		terms = append(terms, term)
+	}
+	return terms, nil
+}
+
+// helper function to check if dataset record matches the term
+func (t DatasetTerm) match(rec DBSRecord) bool {
+	switch t.Key {
+	case "created", "modified":
+		ts := rec.CreationDate
+		if t.Key == "modified" {
+			ts = rec.LastModificationdate
+		}
+		switch t.Op {
+		case "=":
+			return ts >= t.from && ts < t.to
+		case "!=":
+			return ts < t.from || ts >= t.to
+		case ">":
+			return ts >= t.to
+		case ">=":
+			return ts >= t.from
+		case "<":
+			return ts < t.from
+		case "<=":
+			return ts < t.to
+		}
+		return false
+	}
+	value := map[string]string{
+		"dataset":    rec.Dataset,
+		"site":       rec.Site,
+		"processing": rec.Processing,
+		"parent":     rec.Parent,
+		"meta_id":    rec.MetaId,
+		"user":       rec.CreateBy,
+	}[t.Key]
+	matched := t.pattern.MatchString(value)
+	if t.Op == "!=" {
+		return !matched
+	}
+	return matched
+}
+
+// helper function to translate query terms into DataBookkeeping query
+// parameters, only equality terms with non-empty values are translated
+func dbsQuery(terms []DatasetTerm) url.Values {
+	query := url.Values{}
+	for _, t := range terms {
+		if !dbsQueryKeys[t.Key] || t.Op != "=" || t.Value == "" {
+			continue
+		}
+		// DataBookkeeping supports wildcards only in dataset names
+		if t.Key != "dataset" && strings.ContainsAny(t.Value, "*?") {
+			continue
+		}
+		query.Add(t.Key, t.Value)
+	}
+	return query
+}
+
+// DatasetSearchParams represents query parameters of datasets page
+type DatasetSearchParams struct {
+	Query string `form:"q" json:"q"`         // dataset query
+	Sort  string `form:"sort" json:"sort"`   // one of datasetSortKeys
+	Order string `form:"order" json:"order"` // asc or desc
+	Limit int    `form:"limit" json:"limit"` // number of results per page
+	Page  int    `form:"page" json:"page"`   // page number starting from 1
+}
+
+// helper function to set default values of search parameters
+func (p *DatasetSearchParams) normalize() {
+	p.Query = strings.TrimSpace(p.Query)
+	known := false
+	for _, key := range datasetSortKeys {
+		known = known || key == p.Sort
+	}
+	if !known {
+		p.Sort = "dataset"
+	}
+	if p.Order != "desc" {
+		p.Order = "asc"
+	}
+	if p.Limit <= 0 || p.Limit > 500 {
+		p.Limit = 50
+	}
+	if p.Page <= 0 {
+		p.Page = 1
+	}
+}
+
+// helper function to build bookmarkable url of the search with given
+// overrides, empty overrides remove parameters
+func (p DatasetSearchParams) url(overrides url.Values) string {
+	vals := url.Values{}
+	vals.Set("q", p.Query)
+	vals.Set("sort", p.Sort)
+	vals.Set("order", p.Order)
+	vals.Set("limit", fmt.Sprintf("%d", p.Limit))
+	vals.Set("page", fmt.Sprintf("%d", p.Page))
+	for key, val := range overrides {
+		vals[key] = val
+	}
+	for key, val := range vals {
+		if len(val) == 0 || val[0] == "" {
+			vals.Del(key)
+		}
+	}
+	base := oreConfig.Config.Frontend.WebServer.Base
+	return fmt.Sprintf("%s/datasets?%s", base, vals.Encode())
+}
+
+// DatasetSearchResult represents datasets page
+type DatasetSearchResult struct {
+	Params   DatasetSearchParams `json:"params"`
+	Terms    []DatasetTerm       `json:"terms"`
+	Total    int                 `json:"total"`
+	Records  []DBSRecord         `json:"records"`
+	Fallback bool                `json:"fallback"` // query was not accepted by DataBookkeeping and records were filtered by frontend
+	Saved    []SavedQuery        `json:"saved_queries"`
+}
+
+// helper function to sort dataset records by given key and order
+func sortDatasets(records []DBSRecord, key, order string) {
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		var less, equal bool
+		switch key {
+		case "site":
+			less, equal = a.Site < b.Site, a.Site == b.Site
+		case "processing":
+			less, equal = a.Processing < b.Processing, a.Processing == b.Processing
+		case "created":
+			less, equal = a.CreationDate < b.CreationDate, a.CreationDate == b.CreationDate
+		case "modified":
+			less, equal = a.LastModificationdate < b.LastModificationdate, a.LastModificationdate == b.LastModificationdate
+		default:
+			less, equal = a.Dataset < b.Dataset, a.Dataset == b.Dataset
+		}
+		if equal {
+			return a.Dataset < b.Dataset
+		}
+		return less == (order == "asc")
+	})
+}
+
+// helper function to search datasets
+func searchDatasets(c *gin.Context, params DatasetSearchParams) (DatasetSearchResult, error) {
+	out := DatasetSearchResult{Params: params}
+	terms, err := parseDatasetQuery(params.Query)
+	if err != nil {
+		return out, err
+	}
+	out.Terms = terms
+
+	ctx := serviceContext(c)
+	query := dbsQuery(terms)
+	var records []DBSRecord
+	if len(query) > 0 {
+		records, err = _services.DataBookkeeping.SearchDatasets(ctx, query)
+		if err != nil && !errors.Is(err, client.ErrUnavailable) {
+			log.Println("ERROR: DataBookkeeping query is not accepted, datasets are filtered by frontend", err)
+			out.Fallback = true
+			records, err = _services.DataBookkeeping.Datasets(ctx)
+		}
+	} else {
+		records, err = _services.DataBookkeeping.Datasets(ctx)
+	}
+	if err = serviceError(c, err); err != nil {
+		return out, err
+	}
+
+	for _, rec := range records {
+		matched := true
+		for _, t := range terms {
+			if !t.match(rec) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			out.Records = append(out.Records, rec)
+		}
+	}
+	sortDatasets(out.Records, params.Sort, params.Order)
+	out.Total = len(out.Records)
+	start := (params.Page - 1) * params.Limit
+	if start > len(out.Records) {
+		start = len(out.Records)
+	}
+	end := start + params.Limit
+	if end > len(out.Records) {
+		end = len(out.Records)
+	}
+	out.Records = out.Records[start:end]
+	return out, nil
+}
+
+//
+// saved dataset queries
+//
+
+// queryBucket defines name of BoltDB bucket with saved dataset queries,
+// queries of every user are kept in nested bucket
+var queryBucket = []byte("dataset_queries")
+
+// SavedQuery represents dataset query saved by the user
+type SavedQuery struct {
+	Name  string `json:"name" form:"name"`
+	Query string `json:"q" form:"q"`
+	Sort  string `json:"sort" form:"sort"`
+	Order string `json:"order" form:"order"`
+	Time  int64  `json:"time" form:"-"`
+}
+
+// URL returns url of datasets page with the saved query
+func (q SavedQuery) URL() string {
+	params := DatasetSearchParams{Query: q.Query, Sort: q.Sort, Order: q.Order}
+	params.normalize()
+	return params.url(url.Values{"limit": nil, "page": nil})
+}
+
+// QueryStore keeps saved dataset queries of users in BoltDB file
+type QueryStore struct {
+	db *bolt.DB
+}
+
+// _queries holds saved dataset queries
+var _queries *QueryStore
+
+// helper function to initialize store of saved dataset queries
+func initQueries() error {
+	var err error
+	_queries, err = NewQueryStore(frontendConfig.QueryFile)
+	return err
+}
+
+// NewQueryStore creates new instance of QueryStore
+func NewQueryStore(fname string) (*QueryStore, error) {
+	db, err := bolt.Open(fname, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(queryBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &QueryStore{db: db}, nil
+}
+
+// List returns saved queries of the user ordered by their names
+func (s *QueryStore) List(user string) ([]SavedQuery, error) {
+	var queries []SavedQuery
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(queryBucket).Bucket([]byte(user))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var q SavedQuery
+			if err := json.Unmarshal(v, &q); err != nil {
+				return err
+			}
+			queries = append(queries, q)
+			return nil
+		})
+	})
+	return queries, err
+}
+
+// Save stores query of the user, query with the same name is replaced
+func (s *QueryStore) Save(user string, q SavedQuery) error {
+	data, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(queryBucket).CreateBucketIfNotExists([]byte(user))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(q.Name), data)
+	})
+}
+
+// Delete removes query of the user with given name
+func (s *QueryStore) Delete(user, name string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket(queryBucket).Bucket([]byte(user)); bucket != nil {
+			return bucket.Delete([]byte(name))
+		}
+		return nil
+	})
+}
+
+// helper function to get saved queries of the user
+func savedQueries(c *gin.Context) []SavedQuery {
+	if _queries == nil {
+		return nil
+	}
+	queries, err := _queries.List(c.GetString("user"))
+	if err != nil {
+		log.Println("ERROR:", err)
+	}
+	return queries
+}
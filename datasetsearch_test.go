@@ -0,0 +1,151 @@
+package main
+
+// dataset search tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestParseDatasetQuery tests parsing of dataset queries
+func TestParseDatasetQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		terms   []DatasetTerm
+		wantErr bool
+	}{
+		{query: "", terms: nil},
+		{query: "drill", terms: []DatasetTerm{{Key: "dataset", Op: "=", Value: "*drill*"}}},
+		{query: "site=Cornell processing!=glibc", terms: []DatasetTerm{
+			{Key: "site", Op: "=", Value: "Cornell"},
+			{Key: "processing", Op: "!=", Value: "glibc"},
+		}},
+		{query: "Site=Cornell", terms: []DatasetTerm{{Key: "site", Op: "=", Value: "Cornell"}}},
+		{query: "parent=", terms: []DatasetTerm{{Key: "parent", Op: "=", Value: ""}}},
+		{query: `user="John Doe"  dataset=/a=b`, terms: []DatasetTerm{
+			{Key: "user", Op: "=", Value: "John Doe"},
+			{Key: "dataset", Op: "=", Value: "/a=b"},
+		}},
+		{query: "created>=2024-01-01 modified<1700000000", terms: []DatasetTerm{
+			{Key: "created", Op: ">=", Value: "2024-01-01"},
+			{Key: "modified", Op: "<", Value: "1700000000"},
+		}},
+		{query: "created>2024-01-01T10:00:00Z", terms: []DatasetTerm{
+			{Key: "created", Op: ">", Value: "2024-01-01T10:00:00Z"},
+		}},
+		{query: `user="John`, wantErr: true},
+		{query: "owner=alice", wantErr: true},
+		{query: "site>Cornell", wantErr: true},
+		{query: "created=yesterday", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			terms, err := parseDatasetQuery(tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if len(terms) != len(tt.terms) {
+				t.Fatalf("got terms %+v, want %+v", terms, tt.terms)
+			}
+			for i, term := range terms {
+				want := tt.terms[i]
+				if term.Key != want.Key || term.Op != want.Op || term.Value != want.Value {
+					t.Errorf("term %d: got %s%s%s, want %s%s%s", i, term.Key, term.Op, term.Value, want.Key, want.Op, want.Value)
+				}
+			}
+		})
+	}
+}
+
+// TestDatasetTermMatch tests matching of dataset records against query terms
+func TestDatasetTermMatch(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+	rec := DBSRecord{
+		Dataset:              "/drill/run1/raw",
+		Site:                 "Cornell",
+		Processing:           "glibc",
+		CreateBy:             "John Doe",
+		CreationDate:         day + 3600,
+		LastModificationdate: day + 2*86400,
+	}
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"run1", true},
+		{"RUN1", true},
+		{"run2", false},
+		{"dataset=/drill/*", true},
+		{"dataset=/drill/run?/raw", true},
+		{"dataset=/drill", false},
+		{"site=cornell", true},
+		{"site!=Cornell", false},
+		{"site=MIT", false},
+		{"parent=", true},
+		{"parent!=", false},
+		{"meta_id=", true},
+		{`user="John Doe"`, true},
+		{"user=john*", true},
+		{"created=2024-01-01", true},
+		{"created!=2024-01-01", false},
+		{"created>2024-01-01", false},
+		{"created>=2024-01-01", true},
+		{"created<2024-01-02", true},
+		{"created<2024-01-01", false},
+		{"created<=2024-01-01", true},
+		{"created>2023-12-31", true},
+		{"modified>2024-01-02", true},
+		{"modified=2024-01-03", true},
+		{"site=Cornell processing=glibc created>2023-12-31", true},
+		{"site=Cornell processing=gcc", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			terms, err := parseDatasetQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			matched := true
+			for _, term := range terms {
+				matched = matched && term.match(rec)
+			}
+			if matched != tt.want {
+				t.Errorf("match = %v, want %v", matched, tt.want)
+			}
+		})
+	}
+}
+
+// TestDBSQuery tests translation of query terms into DataBookkeeping parameters
+func TestDBSQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  url.Values
+	}{
+		{"", url.Values{}},
+		{"site=Cornell processing=glibc", url.Values{"site": {"Cornell"}, "processing": {"glibc"}}},
+		{"dataset=/drill/*", url.Values{"dataset": {"/drill/*"}}},
+		{"site=Corn*", url.Values{}},
+		{"site!=Cornell", url.Values{}},
+		{"parent=", url.Values{}},
+		{"user=alice created>2024-01-01", url.Values{}},
+		{"drill", url.Values{"dataset": {"*drill*"}}},
+		{"meta_id=123 site=Cornell site=MIT", url.Values{"meta_id": {"123"}, "site": {"Cornell", "MIT"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			terms, err := parseDatasetQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := dbsQuery(terms); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
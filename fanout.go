@@ -0,0 +1,77 @@
+package main
+
+// fan-out module
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// helper function to call fn for every index in [0, n) using bounded number of
+// workers, it returns when all calls are finished or context is done. Calls
+// which were not started before context is done are skipped.
+func fanOut(ctx context.Context, n, workers int, fn func(ctx context.Context, idx int)) {
+	if workers <= 0 {
+		workers = 1
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				// job may be received together with context expiration
+				if ctx.Err() != nil {
+					continue
+				}
+				fn(ctx, idx)
+			}
+		}()
+	}
+	for idx := 0; idx < n; idx++ {
+		select {
+		case jobs <- idx:
+		case <-ctx.Done():
+			idx = n
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// MetaResult represents meta-data records of single site obtained by fan-out calls
+type MetaResult struct {
+	Site    string
+	Records []MetaData
+	Error   error
+}
+
+// helper function to fetch meta-data records of given sites concurrently, every
+// site gets its result even if MetaData service did not respond for it before
+// request deadline
+func sitesMetadata(c *gin.Context, sites []string) []MetaResult {
+	results := make([]MetaResult, len(sites))
+	for idx, site := range sites {
+		results[idx] = MetaResult{Site: site, Error: context.DeadlineExceeded}
+	}
+	deadline := time.Duration(frontendConfig.FanoutTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(serviceContext(c), deadline)
+	defer cancel()
+	fanOut(ctx, len(sites), frontendConfig.FanoutWorkers, func(ctx context.Context, idx int) {
+		records, err := _services.MetaData.Records(ctx, sites[idx])
+		results[idx] = MetaResult{Site: sites[idx], Records: records, Error: err}
+	})
+	// gin context should not be used concurrently, therefore we record
+	// unavailable services once all calls are done
+	for _, r := range results {
+		serviceError(c, r.Error)
+	}
+	return results
+}
@@ -0,0 +1,126 @@
+package main
+
+// fan-out tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/OreCast/Frontend/client"
+)
+
+// TestFanOut tests that every index is processed with bounded concurrency
+func TestFanOut(t *testing.T) {
+	tests := []struct {
+		n, workers, limit int
+	}{
+		{10, 3, 3},
+		{2, 8, 2},
+		{5, 0, 1},
+		{0, 4, 0},
+	}
+	for _, tt := range tests {
+		var mu sync.Mutex
+		seen := make(map[int]int)
+		var running, peak atomic.Int32
+		fanOut(context.Background(), tt.n, tt.workers, func(ctx context.Context, idx int) {
+			cur := running.Add(1)
+			for {
+				old := peak.Load()
+				if cur <= old || peak.CompareAndSwap(old, cur) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			running.Add(-1)
+			mu.Lock()
+			seen[idx]++
+			mu.Unlock()
+		})
+		if len(seen) != tt.n {
+			t.Errorf("n=%d workers=%d: %d indexes are processed", tt.n, tt.workers, len(seen))
+		}
+		for idx, count := range seen {
+			if count != 1 {
+				t.Errorf("n=%d workers=%d: index %d is processed %d times", tt.n, tt.workers, idx, count)
+			}
+		}
+		if int(peak.Load()) > tt.limit {
+			t.Errorf("n=%d workers=%d: %d concurrent calls, limit %d", tt.n, tt.workers, peak.Load(), tt.limit)
+		}
+	}
+}
+
+// TestFanOutDeadline tests that calls are not started after context deadline
+func TestFanOutDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var started atomic.Int32
+	start := time.Now()
+	fanOut(ctx, 100, 2, func(ctx context.Context, idx int) {
+		started.Add(1)
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+	})
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("fan-out returned after %v", elapsed)
+	}
+	if n := started.Load(); n != 2 {
+		t.Errorf("%d calls are started, want 2", n)
+	}
+}
+
+// TestSitesMetadataDeadline tests that slow sites get deadline errors while
+// other sites get their records
+func TestSitesMetadataDeadline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/meta/Slow" {
+			<-r.Context().Done()
+			return
+		}
+		data, _ := json.Marshal([]MetaData{{ID: "1", Site: "Cornell"}})
+		json.NewEncoder(w).Encode(client.Response{Status: "ok", Data: data})
+	}))
+	defer srv.Close()
+	services := _services
+	t.Cleanup(func() { _services = services })
+	_services = client.New(client.Config{MetaDataURL: srv.URL})
+	config := frontendConfig
+	t.Cleanup(func() { frontendConfig = config })
+	frontendConfig.FanoutTimeout = 1
+	frontendConfig.FanoutWorkers = 1
+
+	c := testContext()
+	start := time.Now()
+	results := sitesMetadata(c, []string{"Cornell", "Slow", "MIT"})
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("sites meta-data are obtained after %v", elapsed)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	if r := results[0]; r.Site != "Cornell" || r.Error != nil || len(r.Records) != 1 {
+		t.Errorf("unexpected result %+v", r)
+	}
+	// slow site exhausts the deadline and remaining site is never called
+	for _, r := range results[1:] {
+		if !errors.Is(r.Error, context.DeadlineExceeded) {
+			t.Errorf("site %s: got error %v, want deadline error", r.Site, r.Error)
+		}
+	}
+	if val, ok := c.Get("unavailable"); !ok || len(val.([]string)) != 1 || val.([]string)[0] != "MetaData" {
+		t.Errorf("unavailable services %v", val)
+	}
+}
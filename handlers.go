@@ -10,9 +10,12 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"path"
+	"strconv"
 	"strings"
+	"time"
 
-	authz "github.com/OreCast/common/authz"
+	"github.com/OreCast/Frontend/client"
 	oreConfig "github.com/OreCast/common/config"
 	"github.com/dchest/captcha"
 	"github.com/gin-gonic/gin"
@@ -26,23 +29,7 @@ import (
 //
 
 // BucketObject represents bucket object returned by DataManagement service
-type BucketObject struct {
-	Name         string `json:"name"`
-	CreationDate string `json:"creationDate"`
-}
-
-// BucketsData represents buckets data returned as data from DataManagement service
-type BucketsData struct {
-	Site    string         `json:"site"`
-	Buckets []BucketObject `json:"buckets"`
-}
-
-// SiteBucketsData represents site buckets data returned by DataManagement service
-type SiteBucketsData struct {
-	Status string      `json:"status"`
-	Data   BucketsData `json:"data"`
-	Error  string      `json:"error"`
-}
+type BucketObject = client.Bucket
 
 // StorageParams represents URI storage params in /storage/:site/:bucket end-point
 type StorageParams struct {
@@ -57,20 +44,13 @@ type Dataset struct {
 	ETag         string
 	ShortETag    string
 	LastModified string
+	Label        string
 }
 
-// StorageData represents storage data structure returned as data from DataManagement service
-type StorageData struct {
-	Site    string           `json:"site"`
-	Bucket  string           `json:"bucket"`
-	Objects []map[string]any `json:"objects"`
-}
-
-// BucketData represents storage info structure returned by DataManagement service
-type BucketData struct {
-	Status string      `json:"status"`
-	Data   StorageData `json:"data"`
-	Error  string      `json:"error"`
+// Link represents named link on web UI
+type Link struct {
+	Name string
+	URL  string
 }
 
 // UserRegistationForm represents site registration form on web UI
@@ -90,17 +70,20 @@ type LoginForm struct {
 	Password string `form:"password" binding:"required"`
 }
 
-// User represents structure used by users DB in Authz service to handle incoming requests
-type User struct {
-	Login    string
-	Password string
-}
-
 // ProjectRegistationForm represents project registration form on web UI
 type ProjectRegistrationForm struct {
 	Project     string `form:"project"`
 	Site        string `form:"site"`
 	Description string `form:"description"`
+	Schema      string `form:"schema"` // optional JSON Schema of meta-data attributes
+}
+
+// ProjectSchemaForm represents project schema form on web UI
+type ProjectSchemaForm struct {
+	Project     string `form:"project" binding:"required"`
+	Site        string `form:"site"`
+	Description string `form:"description"`
+	Schema      string `form:"schema" binding:"required"`
 }
 
 // CreateBucketForm represents create bucket registration form on web UI
@@ -109,11 +92,56 @@ type CreateBucketForm struct {
 	Bucket string `form:"bucket"`
 }
 
+// BulkForm represents bulk operation form on web UI, the operation is applied
+// to explicitly selected objects and to all objects under given prefix
+type BulkForm struct {
+	Site    string   `form:"site" binding:"required"`
+	Bucket  string   `form:"bucket" binding:"required"`
+	Objects []string `form:"objects"`
+	Prefix  string   `form:"prefix"`
+	Target  string   `form:"target"`
+	Action  string   `form:"action"`
+	Confirm bool     `form:"confirm"`
+}
+
 // MetaSiteParams represents URI storage params in /meta/:site end-point
 type MetaSiteParams struct {
 	Site string `uri:"site" binding:"required"`
 }
 
+// MetaForm represents meta-data record form on web UI, tags are comma separated
+// and record without id is created as new record
+type MetaForm struct {
+	ID          string `form:"id"`
+	Site        string `form:"site" binding:"required"`
+	Bucket      string `form:"bucket"`
+	Description string `form:"description"`
+	Tags        string `form:"tags"`
+	Project     string `form:"project"` // project whose schema defines attributes of the record
+}
+
+// MetaRevertForm represents form to revert meta-data record to its revision
+type MetaRevertForm struct {
+	ID       string `form:"id" binding:"required"`
+	Site     string `form:"site" binding:"required"`
+	Revision int    `form:"revision" binding:"required"`
+}
+
+// MetaImportForm represents meta-data import form on web UI, content of
+// imported file is carried by data field between dry-runs
+type MetaImportForm struct {
+	Format  string `form:"format"`
+	Data    string `form:"data"`
+	Confirm bool   `form:"confirm"`
+}
+
+// MetaDeleteForm represents meta-data record delete form on web UI
+type MetaDeleteForm struct {
+	ID      string `form:"id" binding:"required"`
+	Site    string `form:"site" binding:"required"`
+	Confirm bool   `form:"confirm"`
+}
+
 // DocsParams represents URI storage params in /docs/:page end-point
 type DocsParams struct {
 	Page string `uri:"page" binding:"required"`
@@ -125,7 +153,25 @@ type MetaIdParams struct {
 	Site   string `uri:"site" binding:"required"`
 }
 
-// DsParams represents URI storage params in /docs/:page end-point
+// ObjectParams represents URI storage params in /storage/:site/:bucket/*object end-point
+type ObjectParams struct {
+	Site   string `uri:"site" binding:"required"`
+	Bucket string `uri:"bucket" binding:"required"`
+	Object string `uri:"object" binding:"required"`
+}
+
+// SavedQueryForm represents form to delete saved dataset query
+type SavedQueryForm struct {
+	Name string `form:"name" json:"name" binding:"required"`
+}
+
+// ProvenanceParams represents query parameters of provenance page
+type ProvenanceParams struct {
+	Dataset string `form:"dataset"` // dataset whose lineage is provided
+	Format  string `form:"format"`  // dot or prov exports lineage graph
+}
+
+// DsParams represents URI params of /dataset/*dataset end-point
 type DsParams struct {
 	Dataset string `uri:"dataset" binding:"required"`
 }
@@ -137,11 +183,190 @@ type DsParams struct {
 // helper function to provides error template message
 func errorTmpl(c *gin.Context, msg string, err error) string {
 	tmpl := makeTmpl(c, "Status")
-	tmpl["Content"] = template.HTML(fmt.Sprintf("<div>%s</div>\n<br/><h3>ERROR</h3>%v", msg, err))
+	// error messages carry names and values provided by the user, therefore
+	// they are escaped before they become part of HTML content
+	tmpl["Content"] = template.HTML(fmt.Sprintf("<div>%s</div>\n<br/><h3>ERROR</h3>%s",
+		template.HTMLEscapeString(msg), template.HTMLEscapeString(fmt.Sprintf("%v", err))))
 	content := tmplPage("error.tmpl", tmpl)
 	return content
 }
 
+// helper function to provide banners of unavailable services
+func bannerTmpl(c *gin.Context) string {
+	services, ok := c.Get("unavailable")
+	if !ok {
+		return ""
+	}
+	tmpl := makeTmpl(c, "Status")
+	tmpl["Services"] = services
+	return tmplPage("banner.tmpl", tmpl)
+}
+
+// helper function to build bucket listing url with given listing parameters,
+// the overrides replace parameters of the current listing and nil values
+// remove them from the url
+func listingURL(c *gin.Context, params ListingParams, overrides url.Values) string {
+	vals := url.Values{}
+	vals.Set("prefix", params.Prefix)
+	vals.Set("filter", params.Filter)
+	vals.Set("sort", params.Sort)
+	vals.Set("order", params.Order)
+	vals.Set("token", params.Token)
+	vals.Set("limit", fmt.Sprintf("%d", params.Limit))
+	for key, val := range overrides {
+		vals[key] = val
+	}
+	for key, val := range vals {
+		if len(val) == 0 || val[0] == "" {
+			vals.Del(key)
+		}
+	}
+	base := oreConfig.Config.Frontend.WebServer.Base
+	return fmt.Sprintf("%s/storage/%s/%s?%s", base, c.Param("site"), c.Param("bucket"), vals.Encode())
+}
+
+// helper function to get list of site buckets from DataManagement service
+func getBuckets(c *gin.Context, site string) ([]BucketObject, error) {
+	buckets, err := _services.DataManagement.Buckets(serviceContext(c), site)
+	return buckets, serviceError(c, err)
+}
+
+// helper function to render dataset registration form with per field errors
+func dataFormPage(c *gin.Context, status int, form DatasetForm, errs map[string]string) {
+	tmpl := makeTmpl(c, "Dataset registration")
+	top := tmplPage("top.tmpl", tmpl)
+	bottom := tmplPage("bottom.tmpl", tmpl)
+	if errs == nil {
+		errs = make(map[string]string)
+	}
+	tmpl["Form"] = form
+	tmpl["Options"] = datasetOptions(c, form.Site)
+	tmpl["Errors"] = errs
+	content := tmplPage("data_registration.tmpl", tmpl)
+	c.Data(status, "text/html; charset=utf-8", []byte(top+bannerTmpl(c)+content+bottom))
+}
+
+// helper function to render site edit or credentials form, name defines
+// template of the form and errs explains why submitted form was not accepted
+func siteFormPage(c *gin.Context, status int, title, name string, form any, errs map[string]string) {
+	tmpl := makeTmpl(c, title)
+	top := tmplPage("top.tmpl", tmpl)
+	bottom := tmplPage("bottom.tmpl", tmpl)
+	if errs == nil {
+		errs = make(map[string]string)
+	}
+	tmpl["Form"] = form
+	tmpl["Errors"] = errs
+	content := tmplPage(name, tmpl)
+	c.Data(status, "text/html; charset=utf-8", []byte(top+bannerTmpl(c)+content+bottom))
+}
+
+// helper function to render confirmation page of site deregistration with
+// list of buckets and datasets which become orphaned
+func siteDeletePage(c *gin.Context, status int, site, msg string) {
+	impact := siteImpact(c, site)
+	if wantJSON(c) {
+		apiData(c, impact)
+		return
+	}
+	tmpl := makeTmpl(c, "Delete site")
+	top := tmplPage("top.tmpl", tmpl)
+	bottom := tmplPage("bottom.tmpl", tmpl)
+	tmpl["Site"] = site
+	tmpl["Impact"] = impact
+	tmpl["Message"] = msg
+	content := tmplPage("site_delete.tmpl", tmpl)
+	c.Data(status, "text/html; charset=utf-8", []byte(top+bannerTmpl(c)+content+bottom))
+}
+
+// helper function to render meta-data record form, attrs provides values of
+// project attributes and errs explains why submitted form was not accepted,
+// errors of project attributes use "attr." prefix
+func metaFormPage(c *gin.Context, status int, form MetaForm, attrs map[string]any, errs map[string]string) {
+	title := "New meta-data record"
+	if form.ID != "" {
+		title = "Edit meta-data record"
+	}
+	tmpl := makeTmpl(c, title)
+	top := tmplPage("top.tmpl", tmpl)
+	bottom := tmplPage("bottom.tmpl", tmpl)
+	buckets, err := getBuckets(c, form.Site)
+	if err != nil {
+		log.Println("ERROR:", err)
+	}
+	projects, err := _schemas.List()
+	if err != nil {
+		log.Println("ERROR:", err)
+	}
+	if errs == nil {
+		errs = make(map[string]string)
+	}
+	if form.Project != "" {
+		schema, err := projectSchema(form.Project)
+		if err != nil {
+			errs["project"] = err.Error()
+		} else {
+			attrErrs := make(map[string]string)
+			for key, msg := range errs {
+				if name, ok := strings.CutPrefix(key, "attr."); ok {
+					attrErrs[name] = msg
+				}
+			}
+			tmpl["Fields"] = schema.FormFields(attrs, attrErrs)
+		}
+	}
+	tmpl["Form"] = form
+	tmpl["Buckets"] = buckets
+	tmpl["Projects"] = projects
+	tmpl["Errors"] = errs
+	content := tmplPage("meta_upload.tmpl", tmpl)
+	c.Data(status, "text/html; charset=utf-8", []byte(top+bannerTmpl(c)+content+bottom))
+}
+
+// helper function to render project schema form, msg explains why submitted
+// schema was not accepted
+func projectSchemaPage(c *gin.Context, status int, form ProjectSchemaForm, msg string) {
+	tmpl := makeTmpl(c, fmt.Sprintf("Schema of %s project", form.Project))
+	top := tmplPage("top.tmpl", tmpl)
+	bottom := tmplPage("bottom.tmpl", tmpl)
+	ps := ProjectSchema{Project: form.Project, Schema: json.RawMessage(form.Schema)}
+	if schema, err := ps.Parse(); err == nil {
+		// preview of meta-data record form generated from the schema
+		tmpl["Fields"] = schema.FormFields(nil, nil)
+	}
+	tmpl["Form"] = form
+	tmpl["Message"] = msg
+	tmpl["Content"] = template.HTML(tmplPage("project_schema.tmpl", tmpl))
+	content := tmplPage("projects.tmpl", tmpl)
+	c.Data(status, "text/html; charset=utf-8", []byte(top+content+bottom))
+}
+
+// helper function to render confirmation page of meta-data record deletion,
+// without record it lets user choose one of the site records
+func metaDeletePage(c *gin.Context, site, mid string) {
+	tmpl := makeTmpl(c, "Delete meta-data record")
+	top := tmplPage("top.tmpl", tmpl)
+	bottom := tmplPage("bottom.tmpl", tmpl)
+	tmpl["Site"] = site
+	if mid != "" {
+		record, err := siteMetaRecord(c, mid, site)
+		if err != nil {
+			errorPage(c, metaRecordStatus(err), fmt.Sprintf("fail to find mid %s", mid), err)
+			return
+		}
+		tmpl["Record"] = record
+	} else {
+		records, err := metadata(c, site)
+		if err != nil {
+			errorPage(c, serviceStatus(err), fmt.Sprintf("fail to obtain meta-data records of site %s", site), err)
+			return
+		}
+		tmpl["Records"] = records
+	}
+	content := tmplPage("meta_delete.tmpl", tmpl)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+content+bottom))
+}
+
 // helper functiont to provides success template message
 func successTmpl(c *gin.Context, msg string) string {
 	tmpl := makeTmpl(c, "Status")
@@ -164,17 +389,9 @@ func CaptchaHandler() gin.HandlerFunc {
 
 // IndexHandler provides access to GET / end-point
 func IndexHandler(c *gin.Context) {
-	// check if user cookie is set, this is necessary as we do not
+	// check if user session exists, this is necessary as we do not
 	// use authorization handler for / end-point
-	user, err := c.Cookie("user")
-	if err == nil {
-		c.Set("user", user)
-	} else {
-		log.Println("WARNING: unable to get user cookie", err)
-	}
-	if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
-		log.Printf("user from c.Cookie: '%s'", user)
-	}
+	user := sessionUser(c)
 
 	// top and bottom HTTP content from our templates
 	tmpl := makeTmpl(c, "OreCast home")
@@ -193,11 +410,9 @@ func IndexHandler(c *gin.Context) {
 
 // DocsHandler provides access to GET /docs end-point
 func DocsHandler(c *gin.Context) {
-	// check if user cookie is set, this is necessary as we do not
+	// check if user session exists, this is necessary as we do not
 	// use authorization handler for /docs end-point
-	if user, err := c.Cookie("user"); err == nil {
-		c.Set("user", user)
-	}
+	sessionUser(c)
 	tmpl := makeTmpl(c, "Documentation")
 	top := tmplPage("top.tmpl", tmpl)
 	bottom := tmplPage("bottom.tmpl", tmpl)
@@ -207,6 +422,12 @@ func DocsHandler(c *gin.Context) {
 	if err := c.ShouldBindUri(&params); err == nil {
 		fname = fmt.Sprintf("static/markdown/%s", params.Page)
 	}
+	// API explorer is rendered from OpenAPI specification, see openapi.go
+	if params.Page == "api" {
+		content := tmplPage("api_docs.tmpl", tmpl)
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+content+bottom))
+		return
+	}
 	content, err := mdToHTML(fname)
 	if err != nil {
 		content = fmt.Sprintf("unable to convert %s to HTML, error %v", fname, err)
@@ -219,13 +440,54 @@ func DocsHandler(c *gin.Context) {
 }
 
 // MetaDataHandler provides access to GET /meta endpoint
+//
+// It provides faceted search of meta-data records across all sites, search
+// parameters are part of page url which can be bookmarked
 func MetaDataHandler(c *gin.Context) {
+	var params MetaSearchParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		errorPage(c, http.StatusBadRequest, "fail to bind meta-data search parameters", err)
+		return
+	}
+	params.normalize()
+	result, err := metaSearch(c, params)
+	if err != nil {
+		errorPage(c, serviceStatus(err), "fail to obtain list of sites", err)
+		return
+	}
+	if wantJSON(c) {
+		apiData(c, result)
+		return
+	}
 	tmpl := makeTmpl(c, "MetaData")
 	top := tmplPage("top.tmpl", tmpl)
 	bottom := tmplPage("bottom.tmpl", tmpl)
-	tmpl["Content"] = "OreCast MetaData page"
-	content := tmplPage("content.tmpl", tmpl)
-	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+content+bottom))
+	var sorts []map[string]any
+	for _, key := range metaSortKeys {
+		order := "asc"
+		if key == params.Sort && params.Order == "asc" && key != "relevance" {
+			order = "desc"
+		}
+		sorts = append(sorts, map[string]any{
+			"Key":    key,
+			"Active": key == params.Sort,
+			"URL":    params.url(url.Values{"sort": {key}, "order": {order}, "page": nil}),
+		})
+	}
+	if params.Page > 1 {
+		tmpl["PrevURL"] = params.url(url.Values{"page": {fmt.Sprintf("%d", params.Page-1)}})
+	}
+	if params.Page*params.Limit < result.Total {
+		tmpl["NextURL"] = params.url(url.Values{"page": {fmt.Sprintf("%d", params.Page+1)}})
+	}
+	tmpl["Result"] = result
+	tmpl["Params"] = params
+	tmpl["Sorts"] = sorts
+	tmpl["First"] = (params.Page-1)*params.Limit + 1
+	tmpl["Last"] = (params.Page-1)*params.Limit + len(result.Hits)
+	tmpl["ClearURL"] = oreConfig.Config.Frontend.WebServer.Base + "/meta"
+	content := tmplPage("meta_search.tmpl", tmpl)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+bannerTmpl(c)+content+bottom))
 }
 
 // MetaRecordHandler provides access to GET /meta/record/:mid endpoint
@@ -236,55 +498,226 @@ func MetaRecordHandler(c *gin.Context) {
 	tmpl["Base"] = oreConfig.Config.Frontend.WebServer.Base
 	var params MetaIdParams
 	if err := c.ShouldBindUri(&params); err != nil {
-		msg := fmt.Sprintf("fail to bind meta/record/:mid parameters, error %v", err)
-		content := errorTmpl(c, msg, err)
-		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+		errorPage(c, http.StatusBadRequest, "fail to bind meta/record/:mid parameters", err)
+		return
+	}
+
+	// history tab provides revisions of the record, they are kept even if
+	// record is deleted
+	if c.Query("tab") == "history" {
+		from, _ := strconv.Atoi(c.Query("from"))
+		to, _ := strconv.Atoi(c.Query("to"))
+		hist, err := metaHistory(params.MetaId, params.Site, from, to)
+		if err != nil {
+			errorPage(c, http.StatusInternalServerError, fmt.Sprintf("fail to read history of mid %s", params.MetaId), err)
+			return
+		}
+		if wantJSON(c) {
+			apiData(c, hist)
+			return
+		}
+		tmpl["ID"] = params.MetaId
+		tmpl["Site"] = params.Site
+		tmpl["Tab"] = "history"
+		tmpl["History"] = hist
+		meta := tmplPage("meta_record.tmpl", tmpl)
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+meta+bottom))
 		return
 	}
 
-	results := getMetaRecord(params.MetaId)
-	if results.Status != "ok" {
+	record, err := getMetaRecord(c, params.MetaId)
+	if err != nil {
 		msg := fmt.Sprintf("fail to find mid %s", params.MetaId)
-		content := errorTmpl(c, msg, errors.New("Not Found"))
-		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+		errorPage(c, serviceStatus(err), msg, err)
+		return
+	}
+	if wantJSON(c) {
+		apiData(c, record)
 		return
 	}
-	data := results.Data
-	record := data[0]
 	tmpl["ID"] = record.ID
 	tmpl["Description"] = record.Description
 	tmpl["Tags"] = record.Tags
 	tmpl["Bucket"] = record.Bucket
 	tmpl["Site"] = params.Site
+	tmpl["Project"] = record.Project
+	tmpl["Attributes"] = record.Attributes
+	tmpl["Tab"] = "details"
 	meta := tmplPage("meta_record.tmpl", tmpl)
 	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+meta+bottom))
 }
 
-// DatasetHandler provides access to GET /dataset endpoint
-func DatasetHandler(c *gin.Context) {
-	tmpl := makeTmpl(c, "Data")
+// DatasetsHandler provides access to GET /datasets endpoint
+//
+// It searches datasets by dataset query language, see datasetsearch.go
+func DatasetsHandler(c *gin.Context) {
+	var params DatasetSearchParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		errorPage(c, http.StatusBadRequest, "fail to bind dataset search parameters", err)
+		return
+	}
+	params.normalize()
+	result, err := searchDatasets(c, params)
+	status := http.StatusOK
+	if err != nil {
+		var serr *client.Error
+		if !errors.As(err, &serr) {
+			// query errors are shown along with the query form
+			status = http.StatusBadRequest
+			if wantJSON(c) {
+				apiFieldErrors(c, "dataset query is not valid", map[string]string{"q": err.Error()})
+				return
+			}
+		} else {
+			errorPage(c, serviceStatus(err), "fail to obtain datasets", err)
+			return
+		}
+	}
+	result.Saved = savedQueries(c)
+	if wantJSON(c) {
+		apiData(c, result)
+		return
+	}
+	tmpl := makeTmpl(c, "Datasets")
 	top := tmplPage("top.tmpl", tmpl)
 	bottom := tmplPage("bottom.tmpl", tmpl)
-	tmpl["Base"] = oreConfig.Config.Frontend.WebServer.Base
-	var content, dsName string
+	var sorts []map[string]any
+	for _, key := range datasetSortKeys {
+		order := "asc"
+		if key == params.Sort && params.Order == "asc" {
+			order = "desc"
+		}
+		sorts = append(sorts, map[string]any{
+			"Key":    key,
+			"Active": key == params.Sort,
+			"URL":    params.url(url.Values{"sort": {key}, "order": {order}, "page": nil}),
+		})
+	}
+	if params.Page > 1 {
+		tmpl["PrevURL"] = params.url(url.Values{"page": {fmt.Sprintf("%d", params.Page-1)}})
+	}
+	if params.Page*params.Limit < result.Total {
+		tmpl["NextURL"] = params.url(url.Values{"page": {fmt.Sprintf("%d", params.Page+1)}})
+	}
+	var records []map[string]any
+	for _, rec := range result.Records {
+		records = append(records, map[string]any{
+			"Record":   rec,
+			"Created":  lineageTime(rec.CreationDate),
+			"Modified": lineageTime(rec.LastModificationdate),
+		})
+	}
+	tmpl["QueryError"] = ""
+	if err != nil {
+		tmpl["QueryError"] = err.Error()
+	}
+	tmpl["Result"] = result
+	tmpl["Records"] = records
+	tmpl["Params"] = params
+	tmpl["Sorts"] = sorts
+	tmpl["First"] = (params.Page-1)*params.Limit + 1
+	tmpl["Last"] = (params.Page-1)*params.Limit + len(result.Records)
+	tmpl["QueryKeys"] = strings.Join(datasetQueryKeys, ", ")
+	content := tmplPage("dataset_search.tmpl", tmpl)
+	c.Data(status, "text/html; charset=utf-8", []byte(top+bannerTmpl(c)+content+bottom))
+}
+
+// DatasetQueryPostHandler provides access to POST /datasets/queries endpoint
+//
+// It saves dataset query of the user under given name
+func DatasetQueryPostHandler(c *gin.Context) {
+	var form SavedQuery
+	if err := c.ShouldBind(&form); err != nil {
+		errorPage(c, http.StatusBadRequest, "saved query form binding error", err)
+		return
+	}
+	form.Name = strings.TrimSpace(form.Name)
+	errs := make(map[string]string)
+	if form.Name == "" {
+		errs["name"] = "this field is required"
+	}
+	if _, err := parseDatasetQuery(form.Query); err != nil {
+		errs["q"] = err.Error()
+	}
+	if len(errs) > 0 {
+		if wantJSON(c) {
+			apiFieldErrors(c, "dataset query is not valid", errs)
+			return
+		}
+		var msgs []string
+		for _, key := range []string{"name", "q"} {
+			if msg, ok := errs[key]; ok {
+				msgs = append(msgs, fmt.Sprintf("%s: %s", key, msg))
+			}
+		}
+		errorPage(c, http.StatusBadRequest, "fail to save dataset query", errors.New(strings.Join(msgs, "; ")))
+		return
+	}
+	form.Time = time.Now().Unix()
+	if err := _queries.Save(c.GetString("user"), form); err != nil {
+		log.Println("ERROR:", err)
+		errorPage(c, http.StatusInternalServerError, "fail to save dataset query", err)
+		return
+	}
+	if wantJSON(c) {
+		apiData(c, form)
+		return
+	}
+	c.Redirect(http.StatusFound, form.URL())
+}
+
+// DatasetQueryDeletePostHandler provides access to POST /datasets/queries/delete endpoint
+func DatasetQueryDeletePostHandler(c *gin.Context) {
+	var form SavedQueryForm
+	if err := c.ShouldBind(&form); err != nil {
+		errorPage(c, http.StatusBadRequest, "saved query form binding error", err)
+		return
+	}
+	if err := _queries.Delete(c.GetString("user"), form.Name); err != nil {
+		log.Println("ERROR:", err)
+		errorPage(c, http.StatusInternalServerError, "fail to delete dataset query", err)
+		return
+	}
+	if wantJSON(c) {
+		apiData(c, savedQueries(c))
+		return
+	}
+	c.Redirect(http.StatusFound, oreConfig.Config.Frontend.WebServer.Base+"/datasets")
+}
+
+// DatasetHandler provides access to GET /dataset/*dataset endpoint
+//
+// It provides dataset details along with its meta-data record, storage
+// bucket and lineage, orphaned datasets are flagged
+func DatasetHandler(c *gin.Context) {
 	var params DsParams
-	if err := c.ShouldBindUri(&params); err == nil {
-		dsName = params.Dataset
+	if err := c.ShouldBindUri(&params); err != nil {
+		errorPage(c, http.StatusBadRequest, "fail to bind dataset parameters", err)
+		return
 	}
-	for _, dobj := range getDatasets(dsName) {
-		if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
-			log.Printf("processing datset object %+v", dobj)
+	details, err := datasetDetails(c, params.Dataset)
+	if err != nil {
+		status := serviceStatus(err)
+		if errors.Is(err, client.ErrNotFound) {
+			status = http.StatusNotFound
 		}
-		tmpl["Dataset"] = dobj.Dataset
-		tmpl["Site"] = dobj.Site
-		tmpl["MetaId"] = dobj.MetaId
-		tmpl["Processing"] = dobj.Processing
-		datasetContent := tmplPage("dataset_record.tmpl", tmpl)
-		content += fmt.Sprintf("%s", template.HTML(datasetContent))
+		errorPage(c, status, fmt.Sprintf("fail to obtain dataset %s", params.Dataset), err)
+		return
 	}
-	tmpl["Content"] = template.HTML(content)
-	datasets := tmplPage("datasets.tmpl", tmpl)
-	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+datasets+bottom))
+	if wantJSON(c) {
+		apiData(c, details)
+		return
+	}
+	tmpl := makeTmpl(c, "Dataset")
+	top := tmplPage("top.tmpl", tmpl)
+	bottom := tmplPage("bottom.tmpl", tmpl)
+	tmpl["Details"] = details
+	tmpl["Site"] = details.Record.Site
+	tmpl["Created"] = lineageTime(details.Record.CreationDate)
+	tmpl["Modified"] = lineageTime(details.Record.LastModificationdate)
+	tmpl["MaxObjects"] = datasetMaxObjects
+	content := tmplPage("dataset_record.tmpl", tmpl)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+bannerTmpl(c)+content+bottom))
 }
 
 // DiscoveryHandler provides access to GET /discovery endpoint
@@ -308,13 +741,62 @@ func AnalyticsHandler(c *gin.Context) {
 }
 
 // ProvenanceHandler provides access to GET /provenance endpoint
+//
+// It provides lineage graph of datasets, dataset query parameter limits the
+// graph to ancestors and descendants of the dataset and format parameter
+// exports the graph as GraphViz DOT (dot) or W3C PROV-JSON (prov) file.
 func ProvenanceHandler(c *gin.Context) {
+	var params ProvenanceParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		errorPage(c, http.StatusBadRequest, "fail to bind provenance parameters", err)
+		return
+	}
+	records, err := getDatasets(c, "")
+	if err != nil {
+		errorPage(c, serviceStatus(err), "fail to obtain datasets", err)
+		return
+	}
+	graph, err := buildLineage(records, params.Dataset)
+	if err != nil {
+		errorPage(c, http.StatusNotFound, "fail to build lineage graph", err)
+		return
+	}
+	name := "lineage"
+	if params.Dataset != "" {
+		name = strings.ReplaceAll(strings.Trim(params.Dataset, "/"), "/", "_")
+	}
+	switch params.Format {
+	case "dot":
+		c.Header("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.dot\"", name))
+		c.Status(http.StatusOK)
+		if err := lineageDOT(c.Writer, graph); err != nil {
+			log.Println("ERROR: unable to export lineage graph", err)
+		}
+		return
+	case "prov":
+		c.Header("Content-Type", "application/json")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.prov.json\"", name))
+		c.Status(http.StatusOK)
+		if err := lineagePROVJSON(c.Writer, graph); err != nil {
+			log.Println("ERROR: unable to export lineage graph", err)
+		}
+		return
+	}
+	if wantJSON(c) {
+		apiData(c, graph)
+		return
+	}
 	tmpl := makeTmpl(c, "Provenance")
 	top := tmplPage("top.tmpl", tmpl)
 	bottom := tmplPage("bottom.tmpl", tmpl)
-	tmpl["Content"] = "OreCast provenant page"
-	content := tmplPage("content.tmpl", tmpl)
-	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+content+bottom))
+	tmpl["Dataset"] = params.Dataset
+	tmpl["Datasets"] = datasetNames(records)
+	tmpl["Graph"] = graph
+	tmpl["NodeWidth"] = lineageNodeWidth
+	tmpl["NodeHeight"] = lineageNodeHeight
+	content := tmplPage("provenance.tmpl", tmpl)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+bannerTmpl(c)+content+bottom))
 }
 
 // MetaSiteHandler provides access to GET /meta/:site endpoint
@@ -325,36 +807,53 @@ func MetaSiteHandler(c *gin.Context) {
 	tmpl["Base"] = oreConfig.Config.Frontend.WebServer.Base
 	var params MetaSiteParams
 	if err := c.ShouldBindUri(&params); err != nil {
-		msg := fmt.Sprintf("fail to bind meta/:site parameters, error %v", err)
-		content := errorTmpl(c, msg, err)
-		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+		errorPage(c, http.StatusBadRequest, "fail to bind meta/:site parameters", err)
 		return
 	}
 
 	site := params.Site
 	var records []MetaData
-	for _, sobj := range getSites() {
+	sites, err := getSites(c)
+	if err != nil {
+		log.Println("ERROR:", err)
+	}
+	rec := SiteMetaRecords{Site: site}
+	var names []string
+	for _, sobj := range sites {
 		if site == sobj.Name {
 			if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
 				log.Printf("processing %+v", sobj)
 			}
 			tmpl["Description"] = sobj.Description
 			tmpl["UseSSL"] = sobj.UseSSL
-			rec := metadata(site)
-			if rec.Status == "ok" {
-				for _, r := range rec.Data {
-					records = append(records, r)
-				}
-			} else {
-				log.Printf("WARNING: failed metadata record %+v", rec)
-			}
+			rec.Description = sobj.Description
+			rec.UseSSL = sobj.UseSSL
+			names = append(names, site)
 		}
 	}
+	for _, r := range sitesMetadata(c, names) {
+		if r.Error == nil {
+			records = append(records, r.Records...)
+		} else {
+			log.Printf("WARNING: failed metadata records of site %s, error %v", site, r.Error)
+			tmpl["Error"] = r.Error.Error()
+			rec.Error = r.Error.Error()
+		}
+	}
+	if wantJSON(c) {
+		if err != nil {
+			apiError(c, serviceStatus(err), "fail to obtain sites", err)
+			return
+		}
+		rec.Records = records
+		apiData(c, rec)
+		return
+	}
 	tmpl["Site"] = site
 	tmpl["Records"] = records
 	tmpl["NRecords"] = len(records)
 	meta := tmplPage("meta_records.tmpl", tmpl)
-	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+meta+bottom))
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+bannerTmpl(c)+meta+bottom))
 }
 
 // SiteHandler provides access to GET /sites endpoint
@@ -369,25 +868,65 @@ func SitesHandler(c *gin.Context) {
 	if err := c.ShouldBindUri(&params); err == nil {
 		sname = params.Site
 	}
-	for _, sobj := range getSites() {
+	allSites, err := getSites(c)
+	if err != nil {
+		log.Println("ERROR:", err)
+	}
+	var selected []Site
+	var names []string
+	for _, sobj := range allSites {
+		if sname != "" && sobj.Name != sname {
+			continue
+		}
+		selected = append(selected, sobj)
+		names = append(names, sobj.Name)
+	}
+	// query MetaData service for all sites concurrently
+	results := sitesMetadata(c, names)
+	if wantJSON(c) {
+		if err != nil {
+			apiError(c, serviceStatus(err), "fail to obtain sites", err)
+			return
+		}
+		records := []SiteRecord{}
+		for idx, sobj := range selected {
+			rec := SiteRecord{
+				Name:        sobj.Name,
+				URL:         sobj.URL,
+				Description: sobj.Description,
+				UseSSL:      sobj.UseSSL,
+				NRecords:    len(results[idx].Records),
+				Permissions: userPermissions(c, sobj.Name),
+			}
+			if results[idx].Error != nil {
+				rec.Error = results[idx].Error.Error()
+			}
+			records = append(records, rec)
+		}
+		apiData(c, records)
+		return
+	}
+	for idx, sobj := range selected {
 		site := sobj.Name
 		if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
 			log.Printf("processing %+v", sobj)
 		}
-		if sname != "" && site != sname {
-			continue
+		tmpl["Error"] = ""
+		if err := results[idx].Error; err != nil {
+			log.Println("ERROR:", err)
+			tmpl["Error"] = err.Error()
 		}
-		rec := metadata(site)
 		tmpl["Site"] = site
+		tmpl["Perms"] = userPermissions(c, site)
 		tmpl["Description"] = sobj.Description
 		tmpl["UseSSL"] = sobj.UseSSL
-		tmpl["NRecords"] = len(rec.Data)
+		tmpl["NRecords"] = len(results[idx].Records)
 		siteContent := tmplPage("site_record.tmpl", tmpl)
 		content += fmt.Sprintf("%s", template.HTML(siteContent))
 	}
 	tmpl["Content"] = template.HTML(content)
 	sites := tmplPage("sites.tmpl", tmpl)
-	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+sites+bottom))
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+bannerTmpl(c)+sites+bottom))
 }
 
 // SiteBucketsHandler provides access to GET /storage/:site endpoint
@@ -400,51 +939,35 @@ func SiteBucketsHandler(c *gin.Context) {
 	var params StorageParams
 	err := c.ShouldBindUri(&params)
 	if err != nil {
-		msg := fmt.Sprintf("fail to bind storage parameters, error %v", err)
-		content := errorTmpl(c, msg, err)
-		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+		errorPage(c, http.StatusBadRequest, "fail to bind storage parameters", err)
 		return
 	}
 	site := params.Site
 
-	// place request to DataManagement service to get either site or bucket info
-	rurl := fmt.Sprintf("%s/storage/%s", oreConfig.Config.Services.DataManagementURL, site)
-	if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
-		log.Println("query DataManagement", rurl)
-	}
-	resp, err := httpGet(rurl)
+	// place request to DataManagement service to get site info
+	buckets, err := getBuckets(c, site)
 	if err != nil {
 		log.Println("ERROR:", err)
-		msg := fmt.Sprintf("fail to obtain storage info, error %v", err)
-		content := errorTmpl(c, msg, err)
-		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
-		return
-	}
-	defer resp.Body.Close()
-	var bdata SiteBucketsData
-	dec := json.NewDecoder(resp.Body)
-	if err := dec.Decode(&bdata); err != nil {
-		log.Println("ERROR:", err)
-		msg := fmt.Sprintf("fail to obtain storage info, error %v", err)
-		content := errorTmpl(c, msg, err)
-		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+		errorPage(c, serviceStatus(err), "fail to obtain storage info", err)
 		return
 	}
-	if bdata.Status != "ok" {
-		msg := fmt.Sprintf("fail to obtain storage info, error %v", bdata.Error)
-		content := errorTmpl(c, msg, nil)
-		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+	if wantJSON(c) {
+		apiData(c, SiteBuckets{Site: site, Buckets: buckets})
 		return
 	}
 	tmpl["StoragePath"] = fmt.Sprintf("/storage/%s", site)
-	tmpl["Buckets"] = bdata.Data.Buckets
-	tmpl["NBuckets"] = len(bdata.Data.Buckets)
+	tmpl["Buckets"] = buckets
+	tmpl["NBuckets"] = len(buckets)
 	tmpl["Site"] = site
 	content := tmplPage("buckets.tmpl", tmpl)
 	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+content+bottom))
 }
 
 // BucketObjectsHandler provides access to GET /storage/:site/:bucket endpoint
+//
+// The bucket listing is paginated and driven by the following query parameters:
+// prefix (folder to browse), filter (name filter), sort (name, size or modified),
+// order (asc or desc), token (continuation token) and limit (entries per page).
 func BucketObjectsHandler(c *gin.Context) {
 	tmpl := makeTmpl(c, "Storage")
 	top := tmplPage("top.tmpl", tmpl)
@@ -454,76 +977,255 @@ func BucketObjectsHandler(c *gin.Context) {
 	var params StorageParams
 	err := c.ShouldBindUri(&params)
 	if err != nil {
-		msg := fmt.Sprintf("fail to bind storage parameters, error %v", err)
-		content := errorTmpl(c, msg, err)
-		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+		errorPage(c, http.StatusBadRequest, "fail to bind storage parameters", err)
+		return
+	}
+	var lparams ListingParams
+	if err := c.ShouldBindQuery(&lparams); err != nil {
+		errorPage(c, http.StatusBadRequest, "fail to bind listing parameters", err)
 		return
 	}
+	if lparams.Limit <= 0 || lparams.Limit > listingMaxLimit {
+		lparams.Limit = listingDefaultLimit
+	}
+	if lparams.Sort != "size" && lparams.Sort != "modified" {
+		lparams.Sort = "name"
+	}
+	if lparams.Order != "desc" {
+		lparams.Order = "asc"
+	}
+	if lparams.Prefix != "" && !strings.HasSuffix(lparams.Prefix, "/") {
+		lparams.Prefix += "/"
+	}
 	site := params.Site
 	bucket := params.Bucket
 
-	// place request to DataManagement service to get either site or bucket info
-	rurl := fmt.Sprintf("%s/storage/%s", oreConfig.Config.Services.DataManagementURL, site)
-	if bucket != "" {
-		rurl = fmt.Sprintf("%s/storage/%s/%s", oreConfig.Config.Services.DataManagementURL, site, bucket)
-	}
-	if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
-		log.Println("query DataManagement", rurl)
-	}
-	resp, err := httpGet(rurl)
+	// list bucket objects directly from site S3 storage
+	s3, err := siteStorage(c, site)
 	if err != nil {
 		log.Println("ERROR:", err)
-		msg := fmt.Sprintf("fail to obtain storage info, error %v", err)
-		content := errorTmpl(c, msg, err)
-		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+		errorPage(c, serviceStatus(err), "fail to obtain storage info", err)
 		return
 	}
-	defer resp.Body.Close()
-	var bdata BucketData
-	dec := json.NewDecoder(resp.Body)
-	if err := dec.Decode(&bdata); err != nil {
+	listing, err := listObjects(s3, bucket, lparams)
+	if err != nil {
 		log.Println("ERROR:", err)
-		msg := fmt.Sprintf("fail to obtain storage info, error %v", err)
-		content := errorTmpl(c, msg, err)
-		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+		errorPage(c, http.StatusBadRequest, fmt.Sprintf("fail to list objects of bucket %s", bucket), err)
 		return
 	}
-	if bdata.Status != "ok" {
-		msg := fmt.Sprintf("fail to obtain storage info, error %v", bdata.Error)
-		content := errorTmpl(c, msg, nil)
-		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+	if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
+		log.Printf("listing %s/%s %+v: %d folders, %d objects, scanned %d keys",
+			site, bucket, lparams, len(listing.Folders), len(listing.Objects), listing.Scanned)
+	}
+	if wantJSON(c) {
+		rec := BucketListing{
+			Site:      site,
+			Bucket:    bucket,
+			Prefix:    lparams.Prefix,
+			Filter:    lparams.Filter,
+			Sort:      lparams.Sort,
+			Order:     lparams.Order,
+			SortScope: sortScope(lparams, listing),
+			Limit:     lparams.Limit,
+			Folders:   append([]string{}, listing.Folders...),
+			Objects:   []StorageObject{},
+			NextToken: listing.NextToken,
+		}
+		for _, obj := range listing.Objects {
+			rec.Objects = append(rec.Objects, StorageObject{
+				Name:         obj.Key,
+				Size:         obj.Size,
+				ETag:         strings.Trim(obj.ETag, "\""),
+				LastModified: obj.LastModified.Format(time.RFC3339),
+			})
+		}
+		apiData(c, rec)
 		return
 	}
-	// convert storage buckets data into appropriate HTML structure
+
+	// convert storage objects into appropriate HTML structure
 	var datasets []Dataset
-	for _, b := range bdata.Data.Objects {
-		val, _ := b["name"]
-		name := fmt.Sprintf("%v", val)
-		val, _ = b["etag"]
-		etag := fmt.Sprintf("%v", val)
-		val, _ = b["size"]
-		size := fmt.Sprintf("%v", val)
-		val, _ = b["lastModified"]
-		ltime := fmt.Sprintf("%v", val)
+	for _, obj := range listing.Objects {
+		etag := strings.Trim(obj.ETag, "\"")
+		short := etag
+		if len(short) > 10 {
+			short = short[:10]
+		}
 		d := Dataset{
-			Name:         name,
+			Name:         obj.Key,
+			Label:        strings.TrimPrefix(obj.Key, lparams.Prefix),
 			ETag:         etag,
-			ShortETag:    etag[:10],
-			LastModified: ltime,
-			Size:         size}
+			ShortETag:    short,
+			LastModified: obj.LastModified.Format(time.RFC3339),
+			Size:         fmt.Sprintf("%d", obj.Size)}
 		datasets = append(datasets, d)
 	}
+	var folders []Link
+	for _, prefix := range listing.Folders {
+		folders = append(folders, Link{
+			Name: strings.TrimPrefix(prefix, lparams.Prefix),
+			URL:  listingURL(c, lparams, url.Values{"prefix": {prefix}, "token": nil}),
+		})
+	}
+	breadcrumbs := []Link{{Name: bucket, URL: listingURL(c, lparams, url.Values{"prefix": nil, "token": nil})}}
+	var prefix string
+	for _, part := range strings.Split(strings.TrimSuffix(lparams.Prefix, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		prefix += part + "/"
+		breadcrumbs = append(breadcrumbs, Link{
+			Name: part,
+			URL:  listingURL(c, lparams, url.Values{"prefix": {prefix}, "token": nil}),
+		})
+	}
+	sortLinks := make(map[string]string)
+	for _, key := range []string{"name", "size", "modified"} {
+		order := "asc"
+		if key == lparams.Sort && lparams.Order == "asc" {
+			order = "desc"
+		}
+		sortLinks[key] = listingURL(c, lparams, url.Values{"sort": {key}, "order": {order}})
+	}
 
-	tmpl["StoragePath"] = fmt.Sprintf("/storage/%s/%s", site, bucket)
+	tmpl["StoragePath"] = fmt.Sprintf("/storage/%s/%s/%s", site, bucket, lparams.Prefix)
 	tmpl["Datasets"] = datasets
+	tmpl["Folders"] = folders
+	tmpl["Breadcrumbs"] = breadcrumbs
+	tmpl["SortLinks"] = sortLinks
+	tmpl["Listing"] = lparams
+	tmpl["Paged"] = pagedListing(lparams, listing)
+	if listing.NextToken != "" {
+		tmpl["NextURL"] = listingURL(c, lparams, url.Values{"token": {listing.NextToken}})
+	}
+	if lparams.Token != "" {
+		tmpl["FirstURL"] = listingURL(c, lparams, url.Values{"token": nil})
+	}
 	tmpl["DataManagementURL"] = oreConfig.Config.Services.DataManagementURL
 	tmpl["NObjects"] = len(datasets)
+	tmpl["NFolders"] = len(folders)
 	tmpl["Site"] = site
 	tmpl["Bucket"] = bucket
 	content := tmplPage("dataobjects.tmpl", tmpl)
 	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+content+bottom))
 }
 
+// ObjectHandler provides access to GET /storage/:site/:bucket/*object endpoint
+//
+// By default it streams S3 object through the frontend and supports HTTP Range
+// requests, with presign=true query parameter it provides time-limited presigned
+// url of the object instead and with preview=true query parameter it shows preview
+// of the object content. All accesses are recorded in access log.
+func ObjectHandler(c *gin.Context) {
+	tmpl := makeTmpl(c, "Storage object")
+	top := tmplPage("top.tmpl", tmpl)
+	bottom := tmplPage("bottom.tmpl", tmpl)
+	var params ObjectParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		errorPage(c, http.StatusBadRequest, "fail to bind storage parameters", err)
+		return
+	}
+	site := params.Site
+	bucket := params.Bucket
+	object := strings.TrimPrefix(params.Object, "/")
+	s3, err := siteStorage(c, site)
+	if err != nil {
+		errorPage(c, serviceStatus(err), fmt.Sprintf("unable to access storage of site %s", site), err)
+		return
+	}
+
+	// provide preview of the object content
+	if c.Query("preview") == "true" || c.Query("preview") == "1" {
+		size := frontendConfig.PreviewSize
+		if previewKind(object, "") == "image" {
+			size = frontendConfig.PreviewImageSize
+		}
+		data, info, err := readObjectHead(c.Request.Context(), s3, bucket, object, size)
+		if err != nil {
+			errorPage(c, http.StatusNotFound, fmt.Sprintf("unable to read %s/%s at site %s", bucket, object, site), err)
+			return
+		}
+		preview := makePreview(object, info.ContentType, data, int64(len(data)) < info.Size)
+		if wantJSON(c) {
+			rec := objectRecord(site, bucket, object, info)
+			rec.Preview = &preview
+			apiData(c, rec)
+			logAccess(c, "preview", site, bucket, object, 0)
+			return
+		}
+		tmpl["Site"] = site
+		tmpl["Bucket"] = bucket
+		tmpl["Object"] = object
+		tmpl["Size"] = info.Size
+		tmpl["ContentType"] = info.ContentType
+		tmpl["LastModified"] = info.LastModified.Format(time.RFC3339)
+		tmpl["Preview"] = preview
+		content := tmplPage("object_preview.tmpl", tmpl)
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+content+bottom))
+		logAccess(c, "preview", site, bucket, object, 0)
+		return
+	}
+
+	// provide presigned url of the object
+	if c.Query("presign") == "true" || c.Query("presign") == "1" {
+		expires := frontendConfig.PresignMaxExpires
+		if val, err := strconv.ParseInt(c.Query("expires"), 10, 64); err == nil && val > 0 && val < expires {
+			expires = val
+		}
+		purl, err := presignObject(c.Request.Context(), s3, bucket, object, time.Duration(expires)*time.Second)
+		if err != nil {
+			errorPage(c, http.StatusBadRequest, fmt.Sprintf("unable to presign %s/%s at site %s", bucket, object, site), err)
+			return
+		}
+		if wantJSON(c) {
+			apiData(c, ObjectRecord{Site: site, Bucket: bucket, Object: object, URL: purl.String(), Expires: expires})
+			logAccess(c, "presign", site, bucket, object, expires)
+			return
+		}
+		msg := fmt.Sprintf("Presigned link of %s/%s is valid for %d seconds:<br/><a href=\"%s\">%s</a>",
+			template.HTMLEscapeString(bucket), template.HTMLEscapeString(object), expires,
+			template.HTMLEscapeString(purl.String()), template.HTMLEscapeString(object))
+		tmpl["Content"] = template.HTML(successTmpl(c, msg))
+		content := tmplPage("content.tmpl", tmpl)
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+content+bottom))
+		logAccess(c, "presign", site, bucket, object, expires)
+		return
+	}
+
+	// stream object content through the frontend, JSON clients get object
+	// attributes instead, they can download content via presigned url
+	obj, info, err := openObject(c.Request.Context(), s3, bucket, object)
+	if err != nil {
+		errorPage(c, http.StatusNotFound, fmt.Sprintf("unable to read %s/%s at site %s", bucket, object, site), err)
+		return
+	}
+	defer obj.Close()
+	if wantJSON(c) {
+		apiData(c, objectRecord(site, bucket, object, info))
+		return
+	}
+	// objects are served from frontend origin, therefore only safe content
+	// types are rendered inline and browser should not run their content
+	disposition := "attachment"
+	if c.Query("inline") == "true" || c.Query("inline") == "1" {
+		if inlineContentType(info.ContentType) {
+			disposition = "inline"
+		}
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("%s; filename=%q", disposition, path.Base(object)))
+	ctype := info.ContentType
+	if ctype == "" {
+		// do not let content type to be sniffed from the object content
+		ctype = "application/octet-stream"
+	}
+	c.Header("Content-Type", ctype)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "sandbox")
+	c.Header("ETag", fmt.Sprintf("\"%s\"", strings.Trim(info.ETag, "\"")))
+	http.ServeContent(c.Writer, c.Request, path.Base(object), info.LastModified, obj)
+	logAccess(c, "download", site, bucket, object, 0)
+}
+
 // S3CreateHandler provides access to GET /storage/create endpoint
 func S3CreateHandler(c *gin.Context) {
 	tmpl := makeTmpl(c, "Create bucket")
@@ -550,12 +1252,19 @@ func S3UploadHandler(c *gin.Context) {
 	status := http.StatusOK
 	if err := c.ShouldBindUri(&params); err == nil {
 		tmpl["Site"] = params.Site
+		tmpl["Bucket"] = c.Query("bucket")
+		buckets, err := getBuckets(c, params.Site)
+		if err != nil {
+			log.Println("ERROR: unable to get site buckets", err)
+		}
+		tmpl["Buckets"] = buckets
+		tmpl["MaxSize"] = frontendConfig.UploadMaxSize
 		content = tmplPage("upload_data.tmpl", tmpl)
 	} else {
 		content = errorTmpl(c, "binding error", err)
 		status = http.StatusBadRequest
 	}
-	c.Data(status, "text/html; charset=utf-8", []byte(top+content+bottom))
+	c.Data(status, "text/html; charset=utf-8", []byte(top+bannerTmpl(c)+content+bottom))
 }
 
 // S3DeleteHandler provides access to GET /storage/delete endpoint
@@ -600,6 +1309,55 @@ func ProjectHandler(c *gin.Context) {
 	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+content+bottom))
 }
 
+// ProjectSchemasHandler provides access to GET /project/schemas endpoint
+func ProjectSchemasHandler(c *gin.Context) {
+	schemas, err := _schemas.List()
+	if err != nil {
+		errorPage(c, http.StatusInternalServerError, "fail to read project schemas", err)
+		return
+	}
+	if wantJSON(c) {
+		apiData(c, schemas)
+		return
+	}
+	tmpl := makeTmpl(c, "Project schemas")
+	top := tmplPage("top.tmpl", tmpl)
+	bottom := tmplPage("bottom.tmpl", tmpl)
+	tmpl["Schemas"] = schemas
+	tmpl["Content"] = template.HTML(tmplPage("project_schemas.tmpl", tmpl))
+	content := tmplPage("projects.tmpl", tmpl)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+content+bottom))
+}
+
+// ProjectSchemaHandler provides access to GET /project/schema/:project endpoint
+//
+// It provides schema of the project along with preview of meta-data record
+// form, project without schema gets form with example schema
+func ProjectSchemaHandler(c *gin.Context) {
+	project := c.Param("project")
+	form := ProjectSchemaForm{Project: project, Schema: exampleSchema}
+	ps, err := _schemas.Get(project)
+	if err == nil {
+		var out bytes.Buffer
+		if err := json.Indent(&out, ps.Schema, "", "  "); err == nil {
+			form.Schema = out.String()
+		}
+		form.Site = ps.Site
+		form.Description = ps.Description
+	} else if !projectName.MatchString(project) {
+		errorPage(c, http.StatusBadRequest, "invalid project name", err)
+		return
+	} else if wantJSON(c) {
+		errorPage(c, http.StatusNotFound, "fail to find project schema", err)
+		return
+	}
+	if wantJSON(c) {
+		apiData(c, ps)
+		return
+	}
+	projectSchemaPage(c, http.StatusOK, form, "")
+}
+
 // DataHandler provides access to GET /data endpoint
 func DataHandler(c *gin.Context) {
 	c.String(400, "Not implemented yet")
@@ -624,6 +1382,64 @@ func SiteRegistrationHandler(c *gin.Context) {
 	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+content+bottom))
 }
 
+// SiteEditHandler provides access to GET /site/:site/edit endpoint
+//
+// It provides form to edit site record, credentials of the site are never
+// shown and they are changed only via /site/:site/credentials form
+func SiteEditHandler(c *gin.Context) {
+	var params StorageParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		errorPage(c, http.StatusBadRequest, "fail to bind site/:site parameters", err)
+		return
+	}
+	rec, err := _services.Discovery.Site(serviceContext(c), params.Site)
+	if err = serviceError(c, err); err != nil {
+		errorPage(c, serviceStatus(err), fmt.Sprintf("fail to find site %s", params.Site), err)
+		return
+	}
+	form := SiteForm{
+		Site:        rec.Name,
+		URL:         rec.URL,
+		Endpoint:    rec.Endpoint,
+		UseSSL:      rec.UseSSL,
+		Description: rec.Description,
+	}
+	if wantJSON(c) {
+		apiData(c, form)
+		return
+	}
+	siteFormPage(c, http.StatusOK, "Edit site", "site_edit.tmpl", form, nil)
+}
+
+// SiteCredentialsHandler provides access to GET /site/:site/credentials endpoint
+func SiteCredentialsHandler(c *gin.Context) {
+	var params StorageParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		errorPage(c, http.StatusBadRequest, "fail to bind site/:site parameters", err)
+		return
+	}
+	form := SiteCredentialsForm{Site: params.Site}
+	siteFormPage(c, http.StatusOK, "Site credentials", "site_credentials.tmpl", form, nil)
+}
+
+// SiteDeleteHandler provides access to GET /site/:site/delete endpoint
+//
+// It provides confirmation form of site deregistration along with buckets
+// and datasets of the site which become orphaned
+func SiteDeleteHandler(c *gin.Context) {
+	var params StorageParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		errorPage(c, http.StatusBadRequest, "fail to bind site/:site parameters", err)
+		return
+	}
+	if _, err := _services.Discovery.Site(serviceContext(c), params.Site); err != nil {
+		err = serviceError(c, err)
+		errorPage(c, serviceStatus(err), fmt.Sprintf("fail to find site %s", params.Site), err)
+		return
+	}
+	siteDeletePage(c, http.StatusOK, params.Site, "")
+}
+
 // LoginHandler provides access to GET /login endpoint
 func LoginHandler(c *gin.Context) {
 	tmpl := makeTmpl(c, "Login")
@@ -635,17 +1451,16 @@ func LoginHandler(c *gin.Context) {
 
 // LogoutHandler provides access to GET /logout endpoint
 func LogoutHandler(c *gin.Context) {
-	c.SetCookie("user", "", -1, "/", domain(), false, true)
+	// invalidate user session on server side
+	_sessions.Destroy(c)
 	c.Redirect(http.StatusFound, "/")
 }
 
 // UserRegistryHandler provides access to GET /registry endpoint
 func UserRegistryHandler(c *gin.Context) {
-	// check if user cookie is set, this is necessary as we do not
+	// check if user session exists, this is necessary as we do not
 	// use authorization handler for /registry end-point
-	if user, err := c.Cookie("user"); err == nil {
-		c.Set("user", user)
-	}
+	sessionUser(c)
 	tmpl := makeTmpl(c, "User registration")
 	top := tmplPage("top.tmpl", tmpl)
 	bottom := tmplPage("bottom.tmpl", tmpl)
@@ -660,18 +1475,103 @@ func UserRegistryHandler(c *gin.Context) {
 }
 
 // DataRegistrationHandler provides access to GET /data/registration endpoint
+//
+// It provides dataset registration form, site and parent query parameters
+// preset form choices. JSON clients get choices of the form.
 func DataRegistrationHandler(c *gin.Context) {
-	c.String(400, "Not implemented yet")
+	form := DatasetForm{Site: c.Query("site"), Parent: c.Query("parent")}
+	if wantJSON(c) {
+		apiData(c, datasetOptions(c, form.Site))
+		return
+	}
+	dataFormPage(c, http.StatusOK, form, nil)
 }
 
-// MetaUploadHandler provides access to GET /meta/upload endpoint
+// MetaUploadHandler provides access to GET /meta/:site/upload endpoint
+//
+// It provides form of new meta-data record, with mid query parameter it
+// provides form to edit existing record
 func MetaUploadHandler(c *gin.Context) {
-	c.String(400, "Not implemented yet")
+	var params MetaSiteParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		errorPage(c, http.StatusBadRequest, "fail to bind meta/:site parameters", err)
+		return
+	}
+	form := MetaForm{Site: params.Site, Bucket: c.Query("bucket"), Project: c.Query("project")}
+	var attrs map[string]any
+	if mid := c.Query("mid"); mid != "" {
+		record, err := siteMetaRecord(c, mid, params.Site)
+		if err != nil {
+			errorPage(c, metaRecordStatus(err), fmt.Sprintf("fail to find mid %s", mid), err)
+			return
+		}
+		form = MetaForm{
+			ID:          record.ID,
+			Site:        params.Site,
+			Bucket:      record.Bucket,
+			Description: record.Description,
+			Tags:        strings.Join(record.Tags, ", "),
+			Project:     record.Project,
+		}
+		// user may switch project of existing record
+		if _, ok := c.GetQuery("project"); ok {
+			form.Project = c.Query("project")
+		}
+		attrs = record.Attributes
+	}
+	metaFormPage(c, http.StatusOK, form, attrs, nil)
 }
 
-// MetaDeleteHandler provides access to GET /meta/delete endpoint
+// MetaDeleteHandler provides access to GET /meta/:site/delete endpoint
 func MetaDeleteHandler(c *gin.Context) {
-	c.String(400, "Not implemented yet")
+	var params MetaSiteParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		errorPage(c, http.StatusBadRequest, "fail to bind meta/:site parameters", err)
+		return
+	}
+	metaDeletePage(c, params.Site, c.Query("mid"))
+}
+
+// MetaImportHandler provides access to GET /meta/:site/import endpoint
+func MetaImportHandler(c *gin.Context) {
+	var params MetaSiteParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		errorPage(c, http.StatusBadRequest, "fail to bind meta/:site parameters", err)
+		return
+	}
+	tmpl := makeTmpl(c, "Import meta-data records")
+	top := tmplPage("top.tmpl", tmpl)
+	bottom := tmplPage("bottom.tmpl", tmpl)
+	tmpl["Site"] = params.Site
+	tmpl["Formats"] = metaFormats
+	tmpl["MaxSize"] = maxImportSize
+	content := tmplPage("meta_import.tmpl", tmpl)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+content+bottom))
+}
+
+// MetaExportHandler provides access to GET /meta/:site/export endpoint
+//
+// It streams all meta-data records of the site in format given by format
+// query parameter: csv (default), jsonl or yaml
+func MetaExportHandler(c *gin.Context) {
+	var params MetaSiteParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		errorPage(c, http.StatusBadRequest, "fail to bind meta/:site parameters", err)
+		return
+	}
+	format := importFormat(c.Query("format"), "")
+	records, err := metadata(c, params.Site)
+	if err != nil {
+		errorPage(c, serviceStatus(err), fmt.Sprintf("fail to obtain meta-data records of site %s", params.Site), err)
+		return
+	}
+	ctype, ext := exportType(format)
+	c.Header("Content-Type", ctype)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-meta.%s\"", params.Site, ext))
+	c.Status(http.StatusOK)
+	if err := exportMeta(c.Writer, format, records); err != nil {
+		log.Println("ERROR: unable to export meta-data records", err)
+	}
 }
 
 // DataUploadHandler provides access to GET /data/upload endpoint
@@ -679,9 +1579,27 @@ func DataUploadHandler(c *gin.Context) {
 	c.String(400, "Not implemented yet")
 }
 
-// DataDeleteHandler provides access to GET /data/delete endpoint
+// DataDeleteHandler provides access to GET /data/:site/delete endpoint
 func DataDeleteHandler(c *gin.Context) {
-	c.String(400, "Not implemented yet")
+	tmpl := makeTmpl(c, "Delete data")
+	top := tmplPage("top.tmpl", tmpl)
+	bottom := tmplPage("bottom.tmpl", tmpl)
+	var params MetaSiteParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		content := errorTmpl(c, "binding error", err)
+		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+		return
+	}
+	buckets, err := getBuckets(c, params.Site)
+	if err != nil {
+		log.Println("ERROR: unable to get site buckets", err)
+	}
+	tmpl["Site"] = params.Site
+	tmpl["Bucket"] = c.Query("bucket")
+	tmpl["Prefix"] = c.Query("prefix")
+	tmpl["Buckets"] = buckets
+	content := tmplPage("bulk_delete.tmpl", tmpl)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+bannerTmpl(c)+content+bottom))
 }
 
 // POST handlers
@@ -710,52 +1628,41 @@ func LoginPostHandler(c *gin.Context) {
 	}
 
 	// make a call to Authz service to check for a user
-	rurl := fmt.Sprintf("%s/oauth/authorize?client_id=%s&response_type=code", oreConfig.Config.Services.AuthzURL, oreConfig.Config.Authz.ClientId)
-	user := User{Login: form.User, Password: form.Password}
-	data, err := json.Marshal(user)
-	if err != nil {
-		content = errorTmpl(c, "unable to marshal user form, error", err)
+	if err := _services.Authz.Authorize(c.Request.Context(), form.User, form.Password); err != nil {
+		log.Println("ERROR:", err)
+		msg := fmt.Sprintf("No user %s found in Authz service", form.User)
+		if errors.Is(err, client.ErrUnavailable) {
+			msg = "unable to contact Authz service"
+		}
+		content = errorTmpl(c, msg, err)
 		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
 		return
 	}
-	resp, err := http.Post(rurl, "application/json", bytes.NewBuffer(data))
+
+	// obtain user token which will be used in all upstream calls made on behalf of the user
+	token, err := getUserToken(form.User, form.Password)
 	if err != nil {
-		content = errorTmpl(c, "unable to POST request to Authz service, error", err)
-		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+		content = errorTmpl(c, "unable to obtain user token from Authz service, error", err)
+		c.Data(http.StatusUnauthorized, "text/html; charset=utf-8", []byte(top+content+bottom))
 		return
 	}
-	defer resp.Body.Close()
-	data, err = io.ReadAll(resp.Body)
-	var response authz.Response
-	err = json.Unmarshal(data, &response)
+
+	// create new user session, it replaces any existing session of the request
+	session, err := _sessions.New(c, form.User, &token)
 	if err != nil {
-		content = errorTmpl(c, "unable handle authz response, error", err)
-		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+		content = errorTmpl(c, "unable to create user session, error", err)
+		c.Data(http.StatusInternalServerError, "text/html; charset=utf-8", []byte(top+content+bottom))
 		return
 	}
-	if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
-		log.Printf("INFO: Authz response %+v, error %v", response, err)
-	}
-	if response.Status != "ok" {
-		msg := fmt.Sprintf("No user %s found in Authz service", form.User)
-		content = errorTmpl(c, msg, errors.New("user not found"))
-		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
-		return
+	session.AddFlash(fmt.Sprintf("Welcome %s, you are successfully logged in", form.User))
+	if err := _sessions.Save(session); err != nil {
+		log.Println("ERROR: unable to save session", err)
 	}
-
 	c.Set("user", form.User)
 	if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
 		log.Printf("login from user %s, url path %s", form.User, c.Request.URL.Path)
 	}
 
-	// set our user cookie
-	if _, err := c.Cookie("user"); err != nil {
-		if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
-			log.Printf("set cookie user=%s domain=%s", form.User, domain())
-		}
-		c.SetCookie("user", form.User, 3600, "/", domain(), false, true)
-	}
-
 	// redirect
 	c.Redirect(http.StatusFound, "/")
 }
@@ -770,91 +1677,513 @@ func ProjectRegistrationPostHandler(c *gin.Context) {
 	var form ProjectRegistrationForm
 	var err error
 	content := successTmpl(c, "Project registration is successful")
+	status := http.StatusOK
 	if err = c.ShouldBind(&form); err != nil {
 		content = errorTmpl(c, "Project registration binding error", err)
+		status = http.StatusBadRequest
 	} else {
 		if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
 			log.Printf("register Project %+v", form)
 		}
+		// project may register JSON Schema of its meta-data attributes
+		if strings.TrimSpace(form.Schema) != "" {
+			ps := ProjectSchema{
+				Project:     strings.TrimSpace(form.Project),
+				Site:        form.Site,
+				Description: form.Description,
+				Schema:      json.RawMessage(form.Schema),
+				UpdatedBy:   c.GetString("user"),
+			}
+			if err := saveProjectSchema(ps); err != nil {
+				content = errorTmpl(c, "Project schema is not valid", err)
+				status = http.StatusBadRequest
+			}
+		}
 	}
 
 	// return page
 	tmpl["Content"] = template.HTML(content)
 	content = tmplPage("content.tmpl", tmpl)
+	c.Data(status, "text/html; charset=utf-8", []byte(top+content+bottom))
+}
+
+// ProjectSchemaPostHandler provides access to POST /project/schema endpoint
+func ProjectSchemaPostHandler(c *gin.Context) {
+	var form ProjectSchemaForm
+	if err := c.ShouldBind(&form); err != nil {
+		errorPage(c, http.StatusBadRequest, "project schema form binding error", err)
+		return
+	}
+	form.Project = strings.TrimSpace(form.Project)
+	ps := ProjectSchema{
+		Project:     form.Project,
+		Site:        form.Site,
+		Description: form.Description,
+		Schema:      json.RawMessage(form.Schema),
+		UpdatedBy:   c.GetString("user"),
+	}
+	if err := saveProjectSchema(ps); err != nil {
+		if wantJSON(c) {
+			apiError(c, http.StatusBadRequest, "project schema is not valid", err)
+			return
+		}
+		projectSchemaPage(c, http.StatusBadRequest, form, err.Error())
+		return
+	}
+	if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
+		log.Printf("user %s updated schema of project %s", ps.UpdatedBy, ps.Project)
+	}
+	if wantJSON(c) {
+		apiData(c, ps)
+		return
+	}
+	tmpl := makeTmpl(c, "Project schema")
+	top := tmplPage("top.tmpl", tmpl)
+	bottom := tmplPage("bottom.tmpl", tmpl)
+	base := oreConfig.Config.Frontend.WebServer.Base
+	project := template.HTMLEscapeString(form.Project)
+	msg := fmt.Sprintf("Schema of <a href=\"%s/project/schema/%s\">%s</a> project is successfully saved",
+		base, project, project)
+	tmpl["Content"] = template.HTML(successTmpl(c, msg))
+	content := tmplPage("content.tmpl", tmpl)
 	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+content+bottom))
 }
 
 // MetaUploadPostHandler provides access to POST /meta/upload endpoint
 func MetaUploadPostHandler(c *gin.Context) {
-	c.String(400, "Not implemented yet")
-}
-
-// MetaDeletePostHandler provides access to POST /meta/delete endpoint
-func MetaDeletePostHandler(c *gin.Context) {
-	c.String(400, "Not implemented yet")
-}
-
-// DataUploadPostHandler provides access to POST /data/upload endpoint
-func DataUploadPostHandler(c *gin.Context) {
-	c.String(400, "Not implemented yet")
-}
-
-// DataDeletePostHandler provides access to POST /data/delete endpoint
-func DataDeletePostHandler(c *gin.Context) {
-	c.String(400, "Not implemented yet")
-}
+	var form MetaForm
+	if err := c.ShouldBind(&form); err != nil {
+		errorPage(c, http.StatusBadRequest, "meta-data record form binding error", err)
+		return
+	}
+	form.Site = strings.TrimSpace(form.Site)
+	form.Bucket = strings.TrimSpace(form.Bucket)
+	form.Description = strings.TrimSpace(form.Description)
+	form.Project = strings.TrimSpace(form.Project)
+	if !sitePermission(c, form.Site, PermDataWrite) {
+		return
+	}
 
-// S3CreatePostHandler provides access to POST /storage/create endpoint
-func S3CreatePostHandler(c *gin.Context) {
-	tmpl := makeTmpl(c, "Storage create bucket")
-	top := tmplPage("top.tmpl", tmpl)
-	bottom := tmplPage("bottom.tmpl", tmpl)
-	var form CreateBucketForm
-	var content string
-	var err error
+	// edited record should belong to the site user is permitted to change
+	var existing MetaData
+	if form.ID != "" {
+		record, err := siteMetaRecord(c, form.ID, form.Site)
+		if err != nil {
+			errorPage(c, metaRecordStatus(err), fmt.Sprintf("fail to find mid %s", form.ID), err)
+			return
+		}
+		existing = record
+	}
 
-	if err = c.ShouldBind(&form); err != nil {
-		content = errorTmpl(c, "site bucket create binding error", err)
-		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+	errs := make(map[string]string)
+	if form.Description == "" {
+		errs["description"] = "this field is required"
+	}
+	// meta-data record should point to existing bucket
+	if form.Bucket == "" {
+		errs["bucket"] = "this field is required"
+	} else {
+		exists, err := bucketExists(c, form.Site, form.Bucket)
+		if err != nil {
+			errorPage(c, serviceStatus(err), fmt.Sprintf("fail to obtain buckets of site %s", form.Site), err)
+			return
+		}
+		if !exists {
+			errs["bucket"] = fmt.Sprintf("bucket %s does not exist at site %s", form.Bucket, form.Site)
+		}
+	}
+	// attributes of the record are defined and validated by project schema
+	var attrs map[string]any
+	values := make(map[string]any)
+	if form.Project != "" {
+		schema, err := projectSchema(form.Project)
+		if err != nil {
+			errs["project"] = err.Error()
+		} else {
+			var attrErrs map[string]string
+			attrs, attrErrs = schema.ParseForm(func(name string) string {
+				return c.PostForm("attr." + name)
+			})
+			for name, val := range attrs {
+				values[name] = val
+			}
+			for name, msg := range attrErrs {
+				errs["attr."+name] = msg
+				// keep user input of invalid fields
+				values[name] = c.PostForm("attr." + name)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		if wantJSON(c) {
+			apiFieldErrors(c, "meta-data record is not valid", errs)
+			return
+		}
+		metaFormPage(c, http.StatusBadRequest, form, values, errs)
 		return
 	}
-	site := form.Site
-	bucket := form.Bucket
-	// curl -X POST http://localhost:8340/storage/cornell/s3-bucket
-	rurl := fmt.Sprintf("%s/storage/%s/%s", oreConfig.Config.Services.DataManagementURL, site, bucket)
-	if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
-		log.Println("query DataManagement", rurl)
+
+	rec := MetaData{
+		ID:          form.ID,
+		Site:        form.Site,
+		Bucket:      form.Bucket,
+		Description: form.Description,
+		Tags:        parseTags(form.Tags),
+		Project:     form.Project,
+		Attributes:  attrs,
+	}
+	// record without project keeps its attributes, they are not part of the form
+	if form.Project == "" {
+		rec.Attributes = existing.Attributes
 	}
-	resp, err := httpPostForm(rurl, url.Values{})
+	rec, err := saveMetaRecord(c, rec, "")
 	if err != nil {
 		log.Println("ERROR:", err)
-		msg := fmt.Sprintf("fail to create bucket %s at site %s, error %v", bucket, site, err)
-		content := errorTmpl(c, msg, err)
-		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+		errorPage(c, serviceStatus(err), fmt.Sprintf("fail to save meta-data record of site %s", form.Site), err)
 		return
 	}
-	defer resp.Body.Close()
-
-	msg := fmt.Sprintf("New bucket %s at site %s successfully created, response status %s", bucket, site, resp.Status)
-	if resp.Status == "200 OK" {
-		content = successTmpl(c, msg)
-	} else {
-		respBody, err := io.ReadAll(resp.Body)
-		msg = fmt.Sprintf("failed response %+v", respBody)
-		content = errorTmpl(c, msg, err)
+	if wantJSON(c) {
+		apiData(c, rec)
+		return
 	}
-	tmpl["Content"] = template.HTML(content)
-	content = tmplPage("content.tmpl", tmpl)
+	tmpl := makeTmpl(c, "Meta-data record")
+	top := tmplPage("top.tmpl", tmpl)
+	bottom := tmplPage("bottom.tmpl", tmpl)
+	base := oreConfig.Config.Frontend.WebServer.Base
+	site := template.HTMLEscapeString(form.Site)
+	msg := fmt.Sprintf("Meta-data record of bucket %s is successfully saved, see <a href=\"%s/meta/%s\">%s records</a>",
+		template.HTMLEscapeString(form.Bucket), base, site, site)
+	tmpl["Content"] = template.HTML(successTmpl(c, msg))
+	content := tmplPage("content.tmpl", tmpl)
 	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+content+bottom))
 }
 
-// S3UploadPostHandler provides access to POST /storage/upload endpoint
-func S3UploadPostHandler(c *gin.Context) {
+// MetaImportPostHandler provides access to POST /meta/:site/import endpoint
+//
+// Without confirm form parameter it provides column mapping and dry-run
+// diff of imported records, with confirmation it applies the import if all
+// rows are valid. Columns are mapped by map[<column>] form parameters.
+func MetaImportPostHandler(c *gin.Context) {
+	var params MetaSiteParams
+	if err := c.ShouldBindUri(&params); err != nil {
+		errorPage(c, http.StatusBadRequest, "fail to bind meta/:site parameters", err)
+		return
+	}
+	// limit size of request body, we allow extra space for column mapping
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize+1024*1024)
+	var form MetaImportForm
+	if err := c.ShouldBind(&form); err != nil {
+		var merr *http.MaxBytesError
+		if errors.As(err, &merr) {
+			errorPage(c, http.StatusRequestEntityTooLarge, "imported file is too large", fmt.Errorf("maximum size is %d bytes", maxImportSize))
+			return
+		}
+		errorPage(c, http.StatusBadRequest, "meta-data import form binding error", err)
+		return
+	}
+	fname := ""
+	if file, header, err := c.Request.FormFile("file"); err == nil {
+		defer file.Close()
+		data, err := io.ReadAll(io.LimitReader(file, maxImportSize+1))
+		if err != nil {
+			errorPage(c, http.StatusBadRequest, "unable to read imported file", err)
+			return
+		}
+		form.Data = string(data)
+		fname = header.Filename
+	}
+	form.Format = importFormat(form.Format, fname)
+	if strings.TrimSpace(form.Data) == "" {
+		errorPage(c, http.StatusBadRequest, "please provide file with meta-data records", errors.New("nothing to import"))
+		return
+	}
+	if len(form.Data) > maxImportSize {
+		errorPage(c, http.StatusRequestEntityTooLarge, "imported file is too large", fmt.Errorf("maximum size is %d bytes", maxImportSize))
+		return
+	}
+	table, err := parseMetaTable(form.Format, []byte(form.Data))
+	if err != nil {
+		errorPage(c, http.StatusBadRequest, fmt.Sprintf("unable to parse %s file", form.Format), err)
+		return
+	}
+
+	// columns without mapping get the guessed one, unknown targets are ignored
+	mapping := c.PostFormMap("map")
+	for _, col := range table.Columns {
+		target, ok := mapping[col]
+		if !ok {
+			mapping[col] = guessTarget(col)
+			continue
+		}
+		known := false
+		for _, t := range metaTargets {
+			known = known || t == target
+		}
+		if !known {
+			mapping[col] = ""
+		}
+	}
+	report, err := buildImport(c, params.Site, table, mapping)
+	if err != nil {
+		errorPage(c, serviceStatus(err), "fail to check imported meta-data records", err)
+		return
+	}
+	report.Format = form.Format
+	status := http.StatusOK
+	msg := ""
+	if form.Confirm {
+		if report.Invalid > 0 {
+			status = http.StatusBadRequest
+			msg = fmt.Sprintf("%d rows are not valid, please fix them before import", report.Invalid)
+		} else {
+			applyImport(c, &report)
+			if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
+				log.Printf("import of %d meta-data records to site %s, %d failed", len(report.Rows), params.Site, report.Failed)
+			}
+		}
+	}
+	if wantJSON(c) {
+		if status != http.StatusOK {
+			// report explains which rows are not valid
+			c.JSON(status, APIResponse{Status: "error", Code: status, Error: msg, Data: report})
+			return
+		}
+		apiData(c, report)
+		return
+	}
+	tmpl := makeTmpl(c, "Import meta-data records")
+	top := tmplPage("top.tmpl", tmpl)
+	bottom := tmplPage("bottom.tmpl", tmpl)
+	tmpl["Site"] = params.Site
+	tmpl["Form"] = form
+	tmpl["Table"] = table
+	tmpl["Mapping"] = mapping
+	tmpl["Targets"] = metaTargets
+	tmpl["Report"] = report
+	tmpl["Message"] = msg
+	content := tmplPage("meta_import.tmpl", tmpl)
+	c.Data(status, "text/html; charset=utf-8", []byte(top+bannerTmpl(c)+content+bottom))
+}
+
+// MetaRevertPostHandler provides access to POST /meta/revert endpoint
+//
+// It restores fields of meta-data record from its revision, the revert
+// becomes new revision of the record
+func MetaRevertPostHandler(c *gin.Context) {
+	var form MetaRevertForm
+	if err := c.ShouldBind(&form); err != nil {
+		errorPage(c, http.StatusBadRequest, "meta-data revert form binding error", err)
+		return
+	}
+	if !sitePermission(c, form.Site, PermDataWrite) {
+		return
+	}
+	if _history == nil {
+		errorPage(c, http.StatusServiceUnavailable, "meta-data history is not available", nil)
+		return
+	}
+	rev, err := _history.Revision(form.ID, form.Revision)
+	if err != nil {
+		errorPage(c, http.StatusNotFound, fmt.Sprintf("fail to find revision of mid %s", form.ID), err)
+		return
+	}
+	// reverted record should belong to the site user is permitted to change
+	if rev.Site != form.Site || rev.Record.Site != form.Site {
+		err := fmt.Errorf("%w: record %s does not belong to site %s", errForeignRecord, form.ID, form.Site)
+		errorPage(c, http.StatusForbidden, fmt.Sprintf("fail to revert meta-data record %s", form.ID), err)
+		return
+	}
+	rec := rev.Record
+	rec.ID = form.ID
+	rec, err = saveMetaRecord(c, rec, "revert")
+	if err != nil {
+		log.Println("ERROR:", err)
+		errorPage(c, serviceStatus(err), fmt.Sprintf("fail to revert meta-data record %s", form.ID), err)
+		return
+	}
+	if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
+		log.Printf("user %s reverted meta-data record %s to revision %d", c.GetString("user"), form.ID, form.Revision)
+	}
+	if wantJSON(c) {
+		apiData(c, rec)
+		return
+	}
+	base := oreConfig.Config.Frontend.WebServer.Base
+	c.Redirect(http.StatusFound, fmt.Sprintf("%s/meta/record/%s/%s?tab=history",
+		base, url.PathEscape(form.ID), url.PathEscape(form.Site)))
+}
+
+// MetaDeletePostHandler provides access to POST /meta/delete endpoint
+//
+// Without confirm form parameter it asks user to confirm the deletion
+func MetaDeletePostHandler(c *gin.Context) {
+	var form MetaDeleteForm
+	if err := c.ShouldBind(&form); err != nil {
+		errorPage(c, http.StatusBadRequest, "meta-data record delete form binding error", err)
+		return
+	}
+	if !sitePermission(c, form.Site, PermDataDelete) {
+		return
+	}
+	if !form.Confirm {
+		metaDeletePage(c, form.Site, form.ID)
+		return
+	}
+	// deleted record should belong to the site user is permitted to change
+	if _, err := siteMetaRecord(c, form.ID, form.Site); err != nil {
+		errorPage(c, metaRecordStatus(err), fmt.Sprintf("fail to find mid %s", form.ID), err)
+		return
+	}
+	if err := deleteMetaRecord(c, form.ID); err != nil {
+		log.Println("ERROR:", err)
+		errorPage(c, serviceStatus(err), fmt.Sprintf("fail to delete meta-data record %s", form.ID), err)
+		return
+	}
+	if wantJSON(c) {
+		apiData(c, gin.H{"id": form.ID, "site": form.Site})
+		return
+	}
+	tmpl := makeTmpl(c, "Meta-data record")
+	top := tmplPage("top.tmpl", tmpl)
+	bottom := tmplPage("bottom.tmpl", tmpl)
+	base := oreConfig.Config.Frontend.WebServer.Base
+	site := template.HTMLEscapeString(form.Site)
+	msg := fmt.Sprintf("Meta-data record %s is successfully deleted, see <a href=\"%s/meta/%s\">%s records</a>",
+		template.HTMLEscapeString(form.ID), base, site, site)
+	tmpl["Content"] = template.HTML(successTmpl(c, msg))
+	content := tmplPage("content.tmpl", tmpl)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+content+bottom))
+}
+
+// DataUploadPostHandler provides access to POST /data/upload endpoint
+func DataUploadPostHandler(c *gin.Context) {
 	c.String(400, "Not implemented yet")
 }
 
-// S3DeletePostHandler provides access to POST /storage/delete endpoint
-func S3DeletePostHandler(c *gin.Context) {
+// DataDeletePostHandler provides access to POST /data/delete endpoint
+func DataDeletePostHandler(c *gin.Context) {
+	bulkOperation(c, "delete")
+}
+
+// DataCopyPostHandler provides access to POST /data/copy endpoint
+func DataCopyPostHandler(c *gin.Context) {
+	action := "copy"
+	if c.PostForm("action") == "move" {
+		action = "move"
+	}
+	bulkOperation(c, action)
+}
+
+// helper function to perform bulk operation on site bucket objects, without
+// confirmation it only provides dry-run preview of affected objects
+func bulkOperation(c *gin.Context, action string) {
+	tmpl := makeTmpl(c, "Bulk "+action)
+	top := tmplPage("top.tmpl", tmpl)
+	bottom := tmplPage("bottom.tmpl", tmpl)
+	var form BulkForm
+	if err := c.ShouldBind(&form); err != nil {
+		content := errorTmpl(c, "bulk operation form binding error", err)
+		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+		return
+	}
+	form.Action = action
+	perms := userPermissions(c, form.Site)
+	if (action != "copy" && !perms[PermDataDelete]) || (action != "delete" && !perms[PermDataWrite]) {
+		msg := fmt.Sprintf("you are not allowed to %s data at site %s", action, form.Site)
+		content := errorTmpl(c, msg, errors.New("permission denied"))
+		c.Data(http.StatusForbidden, "text/html; charset=utf-8", []byte(top+content+bottom))
+		return
+	}
+	if len(form.Objects) == 0 && form.Prefix == "" {
+		content := errorTmpl(c, "please select objects or provide prefix", errors.New("nothing to do"))
+		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+		return
+	}
+	if action != "delete" && (form.Target == "" || form.Target == form.Bucket) {
+		content := errorTmpl(c, "please provide target bucket different from source one", errors.New("invalid target"))
+		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+		return
+	}
+	s3, err := siteStorage(c, form.Site)
+	if err != nil {
+		content := errorTmpl(c, fmt.Sprintf("unable to access storage of site %s", form.Site), err)
+		c.Data(serviceStatus(err), "text/html; charset=utf-8", []byte(top+bannerTmpl(c)+content+bottom))
+		return
+	}
+	ctx := c.Request.Context()
+	objects, err := resolveObjects(ctx, s3, form.Bucket, form.Prefix, form.Objects)
+	if err != nil {
+		content := errorTmpl(c, "unable to resolve objects of bulk operation", err)
+		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+		return
+	}
+	tmpl["Site"] = form.Site
+	tmpl["Bucket"] = form.Bucket
+	tmpl["Prefix"] = form.Prefix
+	tmpl["Target"] = form.Target
+	tmpl["Action"] = action
+	tmpl["ActionURL"] = "/data/delete"
+	if action != "delete" {
+		tmpl["ActionURL"] = "/data/copy"
+	}
+
+	// dry-run preview of the operation
+	if !form.Confirm {
+		var size int64
+		var nok int
+		for _, obj := range objects {
+			if obj.Status == "ok" {
+				size += obj.Size
+				nok++
+			}
+		}
+		if action != "delete" {
+			tmpl["Existing"] = existingObjects(ctx, s3, form.Target, objects)
+		}
+		tmpl["Objects"] = objects
+		tmpl["NObjects"] = nok
+		tmpl["TotalSize"] = size
+		content := tmplPage("bulk_preview.tmpl", tmpl)
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+content+bottom))
+		return
+	}
+
+	// perform the operation
+	if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
+		log.Printf("bulk %s of %d objects at %s/%s target %s", action, len(objects), form.Site, form.Bucket, form.Target)
+	}
+	var results []ObjectResult
+	if action == "delete" {
+		results, err = removeObjects(ctx, s3, form.Bucket, objects)
+	} else {
+		results, err = copyObjects(ctx, s3, form.Bucket, form.Target, objects, action == "move")
+	}
+	// objects are changed in site storage, cached listings of DataManagement
+	// service are outdated even if operation partially failed
+	_services.DataManagement.InvalidateObjects(form.Site, form.Bucket)
+	if action != "delete" {
+		_services.DataManagement.InvalidateObjects(form.Site, form.Target)
+	}
+	if err != nil {
+		content := errorTmpl(c, fmt.Sprintf("unable to %s objects", action), err)
+		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+		return
+	}
+	var nfailed int
+	for _, r := range results {
+		if r.Status == "fail" {
+			nfailed++
+		}
+	}
+	tmpl["Results"] = results
+	tmpl["NFailed"] = nfailed
+	tmpl["NSucceeded"] = len(results) - nfailed
+	content := tmplPage("bulk_results.tmpl", tmpl)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+content+bottom))
+}
+
+// S3CreatePostHandler provides access to POST /storage/create endpoint
+func S3CreatePostHandler(c *gin.Context) {
 	tmpl := makeTmpl(c, "Storage create bucket")
 	top := tmplPage("top.tmpl", tmpl)
 	bottom := tmplPage("bottom.tmpl", tmpl)
@@ -863,43 +2192,167 @@ func S3DeletePostHandler(c *gin.Context) {
 	var err error
 
 	if err = c.ShouldBind(&form); err != nil {
-		content = errorTmpl(c, "site bucket delete binding error", err)
+		content = errorTmpl(c, "site bucket create binding error", err)
 		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
 		return
 	}
+	// multipart forms are not inspected by middleware, therefore permission
+	// is checked against site of the bound form
+	if !sitePermission(c, form.Site, PermStorageAdmin) {
+		return
+	}
 	site := form.Site
 	bucket := form.Bucket
-	// curl -X DELETE http://localhost:8340/storage/cornell/s3-bucket
-	rurl := fmt.Sprintf("%s/storage/%s/%s", oreConfig.Config.Services.DataManagementURL, site, bucket)
-	if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
-		log.Println("query DataManagement", rurl)
-	}
-	req, err := http.NewRequest("DELETE", rurl, nil)
-	if err != nil {
+	// curl -X POST http://localhost:8340/storage/cornell/s3-bucket
+	if err := _services.DataManagement.CreateBucket(serviceContext(c), site, bucket); err != nil {
 		log.Println("ERROR:", err)
-		msg := fmt.Sprintf("fail to delete bucket %s at site %s, error %v", bucket, site, err)
+		msg := fmt.Sprintf("fail to create bucket %s at site %s", bucket, site)
 		content := errorTmpl(c, msg, err)
 		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
 		return
 	}
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	msg := fmt.Sprintf("New bucket %s at site %s successfully created",
+		template.HTMLEscapeString(bucket), template.HTMLEscapeString(site))
+	content = successTmpl(c, msg)
+	tmpl["Content"] = template.HTML(content)
+	content = tmplPage("content.tmpl", tmpl)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+content+bottom))
+}
+
+// S3UploadPostHandler provides access to POST /storage/upload endpoint
+//
+// The upload form is read as a stream, i.e. site, bucket and object fields should
+// precede the file field, and file content is passed directly to site S3 storage.
+func S3UploadPostHandler(c *gin.Context) {
+	tmpl := makeTmpl(c, "Storage upload")
+	top := tmplPage("top.tmpl", tmpl)
+	bottom := tmplPage("bottom.tmpl", tmpl)
+	var content string
+
+	// limit size of request body, we allow extra space for form fields
+	maxSize := frontendConfig.UploadMaxSize
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+1024*1024)
+	reader, err := c.Request.MultipartReader()
 	if err != nil {
+		content = errorTmpl(c, "upload form should be multipart/form-data", err)
+		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+		return
+	}
+	fields := make(map[string]string)
+	fields["site"] = c.Query("site")
+	var result UploadResult
+	var uploaded bool
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			content = errorTmpl(c, "unable to read upload form", err)
+			c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+			return
+		}
+		if part.FormName() != "file" {
+			val, err := io.ReadAll(io.LimitReader(part, 4096))
+			if err != nil {
+				content = errorTmpl(c, "unable to read upload form", err)
+				c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+				return
+			}
+			if v := strings.TrimSpace(string(val)); v != "" {
+				fields[part.FormName()] = v
+			}
+			continue
+		}
+
+		// we got file part of the form
+		site := fields["site"]
+		bucket := fields["bucket"]
+		object := fields["object"]
+		if object == "" {
+			object = part.FileName()
+		}
+		if site == "" || bucket == "" || object == "" {
+			msg := "site, bucket and file name should be provided before file content"
+			content = errorTmpl(c, msg, errors.New("incomplete upload form"))
+			c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+			return
+		}
+		if !userPermissions(c, site)[PermDataWrite] {
+			content = errorTmpl(c, fmt.Sprintf("you are not allowed to upload data to site %s", site), errors.New("permission denied"))
+			c.Data(http.StatusForbidden, "text/html; charset=utf-8", []byte(top+content+bottom))
+			return
+		}
+		s3, err := siteStorage(c, site)
+		if err != nil {
+			content = errorTmpl(c, fmt.Sprintf("unable to access storage of site %s", site), err)
+			c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+			return
+		}
+		if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
+			log.Printf("upload %s to site %s bucket %s", object, site, bucket)
+		}
+		result, err = uploadObject(c.Request.Context(), s3, bucket, object, part, maxSize)
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, ErrTooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			msg := fmt.Sprintf("fail to upload %s to bucket %s at site %s", object, bucket, site)
+			content = errorTmpl(c, msg, err)
+			c.Data(status, "text/html; charset=utf-8", []byte(top+content+bottom))
+			return
+		}
+		uploaded = true
+		break
+	}
+	if !uploaded {
+		content = errorTmpl(c, "upload form does not contain any file", errors.New("no file"))
+		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+		return
+	}
+	_services.DataManagement.InvalidateObjects(fields["site"], result.Bucket)
+
+	msg := fmt.Sprintf("File %s (%d bytes, %s) successfully uploaded to bucket %s at site %s, ETag %s",
+		template.HTMLEscapeString(result.Object), result.Size,
+		template.HTMLEscapeString(result.ContentType), template.HTMLEscapeString(result.Bucket),
+		template.HTMLEscapeString(fields["site"]), template.HTMLEscapeString(result.ETag))
+	content = successTmpl(c, msg)
+	tmpl["Content"] = template.HTML(content)
+	content = tmplPage("content.tmpl", tmpl)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+content+bottom))
+}
+
+// S3DeletePostHandler provides access to POST /storage/delete endpoint
+func S3DeletePostHandler(c *gin.Context) {
+	tmpl := makeTmpl(c, "Storage create bucket")
+	top := tmplPage("top.tmpl", tmpl)
+	bottom := tmplPage("bottom.tmpl", tmpl)
+	var form CreateBucketForm
+	var content string
+	var err error
+
+	if err = c.ShouldBind(&form); err != nil {
+		content = errorTmpl(c, "site bucket delete binding error", err)
+		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+		return
+	}
+	if !sitePermission(c, form.Site, PermStorageAdmin) {
+		return
+	}
+	site := form.Site
+	bucket := form.Bucket
+	// curl -X DELETE http://localhost:8340/storage/cornell/s3-bucket
+	if err := _services.DataManagement.DeleteBucket(serviceContext(c), site, bucket); err != nil {
 		log.Println("ERROR:", err)
-		msg := fmt.Sprintf("fail to delete bucket %s at site %s, error %v", bucket, site, err)
+		msg := fmt.Sprintf("fail to delete bucket %s at site %s", bucket, site)
 		content := errorTmpl(c, msg, err)
 		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
 		return
 	}
-	defer resp.Body.Close()
-	msg := fmt.Sprintf("Bucket %s at site %s successfully deleted, response status %s", bucket, site, resp.Status)
-	if resp.Status == "200 OK" {
-		content = successTmpl(c, msg)
-	} else {
-		respBody, err := io.ReadAll(resp.Body)
-		msg = fmt.Sprintf("failed response %+v", respBody)
-		content = errorTmpl(c, msg, err)
-	}
+	msg := fmt.Sprintf("Bucket %s at site %s successfully deleted",
+		template.HTMLEscapeString(bucket), template.HTMLEscapeString(site))
+	content = successTmpl(c, msg)
 	tmpl["Content"] = template.HTML(content)
 	content = tmplPage("content.tmpl", tmpl)
 	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+content+bottom))
@@ -942,52 +2395,34 @@ func UserRegistryPostHandler(c *gin.Context) {
 	}
 
 	// make a call to Authz service to registry new user
-	rurl := fmt.Sprintf("%s/user", oreConfig.Config.Services.AuthzURL)
-	data, err := json.Marshal(form)
-	if err != nil {
-		content = errorTmpl(c, "unable to marshal user form, error", err)
-		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
-		return
-	}
-	resp, err := http.Post(rurl, "application/json", bytes.NewBuffer(data))
-	if err != nil {
-		content = errorTmpl(c, "unable to POST request to Authz service, error", err)
+	if err := _services.Authz.AddUser(c.Request.Context(), form); err != nil {
+		log.Println("ERROR:", err)
+		msg := fmt.Sprintf("unable to register user %s in Authz service", form.Login)
+		content = errorTmpl(c, msg, err)
 		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
 		return
 	}
-	defer resp.Body.Close()
-	data, err = io.ReadAll(resp.Body)
-	var response authz.Response
-	err = json.Unmarshal(data, &response)
+
+	// obtain token for newly registered user
+	token, err := getUserToken(form.Login, form.Password)
 	if err != nil {
-		content = errorTmpl(c, "unable handle authz response, error", err)
-		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+		content = errorTmpl(c, "unable to obtain user token from Authz service, error", err)
+		c.Data(http.StatusUnauthorized, "text/html; charset=utf-8", []byte(top+content+bottom))
 		return
 	}
-	if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
-		log.Printf("INFO: Authz response %+v, error %v", response, err)
-	}
-	if response.Status != "ok" {
-		msg := fmt.Sprintf("No user %s found in Authz service", form.Login)
-		content = errorTmpl(c, msg, errors.New("user not found"))
-		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte(top+content+bottom))
+
+	// create session for newly registered user
+	if _, err := _sessions.New(c, form.Login, &token); err != nil {
+		content = errorTmpl(c, "unable to create user session, error", err)
+		c.Data(http.StatusInternalServerError, "text/html; charset=utf-8", []byte(top+content+bottom))
 		return
 	}
-
 	c.Set("user", form.Login)
+	tmpl["User"] = form.Login
 	if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
 		log.Printf("login from user %s, url path %s", form.Login, c.Request.URL.Path)
 	}
 
-	// set our user cookie
-	if _, err := c.Cookie("user"); err != nil {
-		if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
-			log.Printf("user registry: set cookie user=%s domain=%s", form.Login, domain())
-		}
-		c.SetCookie("user", form.Login, 3600, "/", domain(), false, true)
-		c.Set("user", form.Login)
-	}
-
 	// return page
 	// we regenerate top template with new user info
 	top = tmplPage("top.tmpl", tmpl)
@@ -1020,19 +2455,8 @@ func SiteRegistrationPostHandler(c *gin.Context) {
 			content = errorTmpl(c, "Site registration failure to encrypt Site attributes", err)
 		} else {
 			// make JSON request to Discovery service
-			if data, err := json.Marshal(form); err == nil {
-				rurl := fmt.Sprintf("%s/sites", oreConfig.Config.Services.DiscoveryURL)
-				resp, err := httpPost(rurl, "application/json", bytes.NewBuffer(data))
-				if err != nil {
-					content = errorTmpl(c, "Site registration posting to discvoeru service failure", err)
-					tmpl["Content"] = template.HTML(content)
-				} else {
-					if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
-						log.Printf("discovery service response: %s", resp.Status)
-					}
-				}
-			} else {
-				content = errorTmpl(c, "Site registration json marshalling error", err)
+			if err := _services.Discovery.AddSite(serviceContext(c), form); err != nil {
+				content = errorTmpl(c, "Site registration posting to discovery service failure", err)
 			}
 		}
 	}
@@ -1043,7 +2467,202 @@ func SiteRegistrationPostHandler(c *gin.Context) {
 	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+content+bottom))
 }
 
+// SiteEditPostHandler provides access to POST /site/edit endpoint
+//
+// It updates site record in Discovery service, if storage endpoint is
+// changed the storage should be accessible with current site credentials
+func SiteEditPostHandler(c *gin.Context) {
+	var form SiteForm
+	if err := c.ShouldBind(&form); err != nil {
+		errorPage(c, http.StatusBadRequest, "site edit form binding error", err)
+		return
+	}
+	if !sitePermission(c, form.Site, PermSiteAdmin) {
+		return
+	}
+	form.URL = strings.TrimSpace(form.URL)
+	form.Endpoint = strings.TrimSpace(form.Endpoint)
+	form.Description = strings.TrimSpace(form.Description)
+	_, errs, err := editSite(c, form)
+	if err != nil {
+		log.Println("ERROR:", err)
+		errorPage(c, serviceStatus(err), fmt.Sprintf("fail to update site %s", form.Site), err)
+		return
+	}
+	if len(errs) > 0 {
+		if wantJSON(c) {
+			apiFieldErrors(c, "site record is not valid", errs)
+			return
+		}
+		siteFormPage(c, http.StatusBadRequest, "Edit site", "site_edit.tmpl", form, errs)
+		return
+	}
+	if wantJSON(c) {
+		apiData(c, form)
+		return
+	}
+	tmpl := makeTmpl(c, "Edit site")
+	top := tmplPage("top.tmpl", tmpl)
+	bottom := tmplPage("bottom.tmpl", tmpl)
+	base := oreConfig.Config.Frontend.WebServer.Base
+	site := template.HTMLEscapeString(form.Site)
+	msg := fmt.Sprintf("Site <a href=\"%s/site/%s\">%s</a> is successfully updated", base, site, site)
+	tmpl["Content"] = template.HTML(successTmpl(c, msg))
+	content := tmplPage("content.tmpl", tmpl)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+content+bottom))
+}
+
+// SiteCredentialsPostHandler provides access to POST /site/credentials endpoint
+//
+// It rotates S3 credentials of the site, new credentials are stored in
+// Discovery service only after storage is accessed with them
+func SiteCredentialsPostHandler(c *gin.Context) {
+	var form SiteCredentialsForm
+	if err := c.ShouldBind(&form); err != nil {
+		errorPage(c, http.StatusBadRequest, "site credentials form binding error", err)
+		return
+	}
+	if !sitePermission(c, form.Site, PermSiteAdmin) {
+		return
+	}
+	errs, err := rotateSiteCredentials(c, form)
+	if err != nil {
+		log.Println("ERROR:", err)
+		errorPage(c, serviceStatus(err), fmt.Sprintf("fail to update credentials of site %s", form.Site), err)
+		return
+	}
+	// secrets are never sent back to the client
+	form.AccessKey, form.AccessSecret = "", ""
+	if len(errs) > 0 {
+		if wantJSON(c) {
+			apiFieldErrors(c, "site credentials are not valid", errs)
+			return
+		}
+		siteFormPage(c, http.StatusBadRequest, "Site credentials", "site_credentials.tmpl", form, errs)
+		return
+	}
+	if wantJSON(c) {
+		apiData(c, gin.H{"site": form.Site})
+		return
+	}
+	tmpl := makeTmpl(c, "Site credentials")
+	top := tmplPage("top.tmpl", tmpl)
+	bottom := tmplPage("bottom.tmpl", tmpl)
+	base := oreConfig.Config.Frontend.WebServer.Base
+	site := template.HTMLEscapeString(form.Site)
+	msg := fmt.Sprintf("Credentials of site <a href=\"%s/site/%s\">%s</a> are verified and successfully updated", base, site, site)
+	tmpl["Content"] = template.HTML(successTmpl(c, msg))
+	content := tmplPage("content.tmpl", tmpl)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+content+bottom))
+}
+
+// SiteDeletePostHandler provides access to POST /site/delete endpoint
+//
+// The site is deregistered only if confirm form parameter matches its name,
+// otherwise user gets confirmation page with resources which become orphaned
+func SiteDeletePostHandler(c *gin.Context) {
+	var form SiteDeleteForm
+	if err := c.ShouldBind(&form); err != nil {
+		errorPage(c, http.StatusBadRequest, "site delete form binding error", err)
+		return
+	}
+	if !sitePermission(c, form.Site, PermSiteAdmin) {
+		return
+	}
+	if form.Confirm != form.Site {
+		msg := fmt.Sprintf("please type %s to confirm deletion of the site", form.Site)
+		if wantJSON(c) {
+			apiFieldErrors(c, "site deletion is not confirmed", map[string]string{"confirm": msg})
+			return
+		}
+		siteDeletePage(c, http.StatusBadRequest, form.Site, msg)
+		return
+	}
+	impact := siteImpact(c, form.Site)
+	err := _services.Discovery.DeleteSite(serviceContext(c), form.Site)
+	if err = serviceError(c, err); err != nil {
+		log.Println("ERROR:", err)
+		errorPage(c, serviceStatus(err), fmt.Sprintf("fail to delete site %s", form.Site), err)
+		return
+	}
+	if wantJSON(c) {
+		apiData(c, impact)
+		return
+	}
+	tmpl := makeTmpl(c, "Delete site")
+	top := tmplPage("top.tmpl", tmpl)
+	bottom := tmplPage("bottom.tmpl", tmpl)
+	msg := fmt.Sprintf("Site %s is successfully deleted", template.HTMLEscapeString(form.Site))
+	if n := len(impact.Buckets) + len(impact.Datasets); n > 0 {
+		msg += fmt.Sprintf(", %d buckets and %d datasets of the site are orphaned",
+			len(impact.Buckets), len(impact.Datasets))
+	}
+	tmpl["Content"] = template.HTML(successTmpl(c, msg))
+	content := tmplPage("content.tmpl", tmpl)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+content+bottom))
+}
+
 // DataRegistrationPostHandler provides access to POST /data/registration endpoint
+//
+// It registers new dataset in DataBookkeeping service, the dataset is
+// submitted either by registration form or as JSON body.
 func DataRegistrationPostHandler(c *gin.Context) {
-	c.String(400, "Not implemented yet")
+	var form DatasetForm
+	if err := c.ShouldBind(&form); err != nil {
+		errorPage(c, http.StatusBadRequest, "dataset registration form binding error", err)
+		return
+	}
+	form.Dataset = strings.TrimSpace(form.Dataset)
+	form.Site = strings.TrimSpace(form.Site)
+	form.MetaId = strings.TrimSpace(form.MetaId)
+	form.Parent = strings.TrimSpace(form.Parent)
+	form.Processing = strings.TrimSpace(form.Processing)
+	if !sitePermission(c, form.Site, PermDataWrite) {
+		return
+	}
+
+	errs, err := validateDataset(c, form)
+	if err != nil {
+		errorPage(c, serviceStatus(err), "fail to validate dataset", err)
+		return
+	}
+	if len(errs) > 0 {
+		if wantJSON(c) {
+			apiFieldErrors(c, "dataset is not valid", errs)
+			return
+		}
+		dataFormPage(c, http.StatusBadRequest, form, errs)
+		return
+	}
+
+	user := c.GetString("user")
+	rec := DBSRecord{
+		Dataset:        form.Dataset,
+		MetaId:         form.MetaId,
+		Site:           form.Site,
+		Processing:     form.Processing,
+		Parent:         form.Parent,
+		CreateBy:       user,
+		CreationDate:   time.Now().Unix(),
+		LastModifiedBy: user,
+	}
+	rec.LastModificationdate = rec.CreationDate
+	if err := addDataset(c, rec); err != nil {
+		log.Println("ERROR:", err)
+		errorPage(c, serviceStatus(err), fmt.Sprintf("fail to register dataset %s", form.Dataset), err)
+		return
+	}
+	if wantJSON(c) {
+		apiData(c, rec)
+		return
+	}
+	tmpl := makeTmpl(c, "Dataset registration")
+	top := tmplPage("top.tmpl", tmpl)
+	bottom := tmplPage("bottom.tmpl", tmpl)
+	base := oreConfig.Config.Frontend.WebServer.Base
+	msg := fmt.Sprintf("Dataset <a href=\"%s/dataset%s\">%s</a> is successfully registered",
+		base, template.HTMLEscapeString(form.Dataset), template.HTMLEscapeString(form.Dataset))
+	tmpl["Content"] = template.HTML(successTmpl(c, msg))
+	content := tmplPage("content.tmpl", tmpl)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(top+content+bottom))
 }
@@ -0,0 +1,266 @@
+package main
+
+// meta-data history module
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+// MetaData service keeps only current state of meta-data records, therefore
+// frontend keeps revisions of records it writes in BoltDB file. Every
+// revision holds complete record along with user, time and action which
+// produced it. Records which were created before history was tracked get
+// their state at the time of first tracked change as baseline revision.
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	bolt "go.etcd.io/bbolt"
+)
+
+// historyBucket defines name of BoltDB bucket with revisions of meta-data
+// records, revisions of every record are kept in nested bucket
+var historyBucket = []byte("meta_history")
+
+// Revision represents revision of meta-data record
+type Revision struct {
+	Number  int           `json:"number"`
+	MetaID  string        `json:"mid"`
+	Site    string        `json:"site"`
+	User    string        `json:"user"`
+	Time    int64         `json:"time"`
+	Action  string        `json:"action"` // baseline, create, update, import, revert or delete
+	Record  MetaData      `json:"record"`
+	Changes []FieldChange `json:"changes,omitempty"` // changes with respect to previous revision
+}
+
+// Date returns time of the revision in human readable form
+func (r Revision) Date() string {
+	return time.Unix(r.Time, 0).UTC().Format("2006-01-02 15:04:05 UTC")
+}
+
+// HistoryStore keeps revisions of meta-data records in BoltDB file
+type HistoryStore struct {
+	db *bolt.DB
+}
+
+// _history holds revisions of meta-data records
+var _history *HistoryStore
+
+// helper function to initialize store of meta-data revisions
+func initHistory() error {
+	var err error
+	_history, err = NewHistoryStore(frontendConfig.HistoryFile)
+	return err
+}
+
+// NewHistoryStore creates new instance of HistoryStore
+func NewHistoryStore(fname string) (*HistoryStore, error) {
+	db, err := bolt.Open(fname, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(historyBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &HistoryStore{db: db}, nil
+}
+
+// helper function to make key of the revision, big-endian keys keep
+// revisions ordered
+func revisionKey(number int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(number))
+	return key
+}
+
+// Revisions returns revisions of given meta-data record ordered by their numbers
+func (h *HistoryStore) Revisions(mid string) ([]Revision, error) {
+	var revs []Revision
+	err := h.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historyBucket).Bucket([]byte(mid))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var rev Revision
+			if err := json.Unmarshal(v, &rev); err != nil {
+				return err
+			}
+			revs = append(revs, rev)
+			return nil
+		})
+	})
+	return revs, err
+}
+
+// Revision returns revision of meta-data record with given number
+func (h *HistoryStore) Revision(mid string, number int) (Revision, error) {
+	var rev Revision
+	var data []byte
+	err := h.db.View(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket(historyBucket).Bucket([]byte(mid)); bucket != nil {
+			if val := bucket.Get(revisionKey(number)); val != nil {
+				data = append(data, val...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return rev, err
+	}
+	if data == nil {
+		return rev, fmt.Errorf("revision %d of meta-data record %s is not found", number, mid)
+	}
+	err = json.Unmarshal(data, &rev)
+	return rev, err
+}
+
+// Add stores new revision of meta-data record, it assigns revision number
+// and changes with respect to previous revision
+func (h *HistoryStore) Add(rev Revision) (Revision, error) {
+	err := h.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(historyBucket).CreateBucketIfNotExists([]byte(rev.MetaID))
+		if err != nil {
+			return err
+		}
+		if _, last := bucket.Cursor().Last(); last != nil {
+			var prev Revision
+			if err := json.Unmarshal(last, &prev); err == nil {
+				rev.Changes = diffRecords(prev.Record, rev.Record)
+			}
+		}
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		rev.Number = int(seq)
+		data, err := json.Marshal(rev)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(revisionKey(rev.Number), data)
+	})
+	return rev, err
+}
+
+// helper function to get field level changes between two meta-data records
+func diffRecords(old, rec MetaData) []FieldChange {
+	oldFields := recordFields(old)
+	newFields := recordFields(rec)
+	var names []string
+	for name := range newFields {
+		names = append(names, name)
+	}
+	for name := range oldFields {
+		if _, ok := newFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var changes []FieldChange
+	for _, name := range names {
+		if oldFields[name] != newFields[name] {
+			changes = append(changes, FieldChange{Field: name, Old: oldFields[name], New: newFields[name]})
+		}
+	}
+	return changes
+}
+
+// helper function to keep current state of meta-data record as baseline
+// revision if record has no revisions yet, it should be called before the
+// record is changed
+func historyBaseline(c *gin.Context, mid string) {
+	if _history == nil {
+		return
+	}
+	revs, err := _history.Revisions(mid)
+	if err != nil || len(revs) > 0 {
+		return
+	}
+	rec, err := getMetaRecord(c, mid)
+	if err != nil {
+		log.Println("ERROR: unable to obtain baseline of meta-data record", mid, err)
+		return
+	}
+	rev := Revision{MetaID: mid, Site: rec.Site, Time: time.Now().Unix(), Action: "baseline", Record: rec}
+	if _, err := _history.Add(rev); err != nil {
+		log.Println("ERROR:", err)
+	}
+}
+
+// helper function to record revision of meta-data record made by the user
+func recordRevision(c *gin.Context, action string, rec MetaData) {
+	if _history == nil || rec.ID == "" {
+		return
+	}
+	rev := Revision{
+		MetaID: rec.ID,
+		Site:   rec.Site,
+		User:   c.GetString("user"),
+		Time:   time.Now().Unix(),
+		Action: action,
+		Record: rec,
+	}
+	if _, err := _history.Add(rev); err != nil {
+		log.Println("ERROR: unable to record revision of meta-data record", rec.ID, err)
+	}
+}
+
+// MetaHistory represents history tab of meta-data record
+type MetaHistory struct {
+	MetaID    string        `json:"mid"`
+	Site      string        `json:"site"`
+	Revisions []Revision    `json:"revisions"`
+	From      int           `json:"from"` // revision compared by the diff
+	To        int           `json:"to"`   // revision compared with
+	Diff      []FieldChange `json:"diff"`
+}
+
+// helper function to get history of meta-data record with diff between
+// given revisions, by default the latest revision is compared with previous one
+func metaHistory(mid, site string, from, to int) (MetaHistory, error) {
+	hist := MetaHistory{MetaID: mid, Site: site}
+	if _history == nil {
+		return hist, nil
+	}
+	revs, err := _history.Revisions(mid)
+	if err != nil || len(revs) == 0 {
+		return hist, err
+	}
+	hist.Revisions = revs
+	find := func(number int) (Revision, bool) {
+		for _, rev := range revs {
+			if rev.Number == number {
+				return rev, true
+			}
+		}
+		return Revision{}, false
+	}
+	last := revs[len(revs)-1]
+	if _, ok := find(to); !ok {
+		to = last.Number
+	}
+	if _, ok := find(from); !ok {
+		from = to
+		for _, rev := range revs {
+			if rev.Number < to {
+				from = rev.Number
+			}
+		}
+	}
+	a, _ := find(from)
+	b, _ := find(to)
+	hist.From, hist.To = from, to
+	hist.Diff = diffRecords(a.Record, b.Record)
+	return hist, nil
+}
@@ -14,5 +14,6 @@ import (
 
 func main() {
 	oreConfig.Init()
+	initConfig()
 	Server()
 }
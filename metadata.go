@@ -1,67 +1,119 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"net/http"
+	"strings"
 
-	oreConfig "github.com/OreCast/common/config"
+	"github.com/OreCast/Frontend/client"
+	"github.com/gin-gonic/gin"
 )
 
-// helper function to get metadata
-// MetaData represents MetaData object returned from discovery service
-type MetaData struct {
-	ID          string   `json:"id"`
-	Site        string   `json:"site"`
-	Description string   `json:"description"`
-	Tags        []string `json:"tags"`
-	Bucket      string   `json:"bucket"`
+// MetaData represents MetaData object returned from MetaData service
+type MetaData = client.MetaData
+
+// helper function to fetch meta-data records of given site from MetaData service
+func metadata(c *gin.Context, site string) ([]MetaData, error) {
+	records, err := _services.MetaData.Records(serviceContext(c), site)
+	return records, serviceError(c, err)
 }
 
-// MetaDataRecord represents MetaData record returned by discovery service
-type MetaDataRecord struct {
-	Status string     `json:"status"`
-	Data   []MetaData `json:"data"`
+// helper function to fetch meta-data record with given id from MetaData service
+func getMetaRecord(c *gin.Context, mid string) (MetaData, error) {
+	record, err := _services.MetaData.Record(serviceContext(c), mid)
+	return record, serviceError(c, err)
 }
 
-// helper function to fetch sites info from discovery service
-func metadata(site string) MetaDataRecord {
-	var results MetaDataRecord
-	rurl := fmt.Sprintf("%s/meta/%s", oreConfig.Config.Services.MetaDataURL, site)
-	resp, err := httpGet(rurl)
-	if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
-		log.Println("query MetaData service rurl", rurl, err)
-	}
+// errForeignRecord reports meta-data record of another site, permissions of
+// the user are checked against the site of the request and they do not
+// apply to records of other sites
+var errForeignRecord = errors.New("meta-data record belongs to another site")
+
+// helper function to fetch meta-data record with given id which belongs to given site
+func siteMetaRecord(c *gin.Context, mid, site string) (MetaData, error) {
+	record, err := getMetaRecord(c, mid)
 	if err != nil {
-		log.Println("ERROR:", err)
-		return results
+		return record, err
+	}
+	if record.Site != site {
+		return record, fmt.Errorf("%w: record %s does not belong to site %s", errForeignRecord, mid, site)
+	}
+	return record, nil
+}
+
+// helper function to get HTTP status of meta-data record lookup error
+func metaRecordStatus(err error) int {
+	if errors.Is(err, errForeignRecord) {
+		return http.StatusForbidden
+	}
+	if errors.Is(err, client.ErrNotFound) {
+		return http.StatusNotFound
 	}
-	defer resp.Body.Close()
-	dec := json.NewDecoder(resp.Body)
-	if err := dec.Decode(&results); err != nil {
-		log.Println("ERROR:", err)
-		return results
+	return serviceStatus(err)
+}
+
+// helper function to create or update meta-data record in MetaData service,
+// it returns saved record and keeps its revision; action describes the change
+// in record history, by default it is create or update
+func saveMetaRecord(c *gin.Context, rec MetaData, action string) (MetaData, error) {
+	var err error
+	if rec.ID == "" {
+		rec, err = _services.MetaData.AddRecord(serviceContext(c), rec)
+		if action == "" {
+			action = "create"
+		}
+	} else {
+		historyBaseline(c, rec.ID)
+		err = _services.MetaData.UpdateRecord(serviceContext(c), rec)
+		if action == "" {
+			action = "update"
+		}
+	}
+	if err == nil {
+		recordRevision(c, action, rec)
+	}
+	return rec, serviceError(c, err)
+}
+
+// helper function to delete meta-data record with given id in MetaData service
+func deleteMetaRecord(c *gin.Context, mid string) error {
+	historyBaseline(c, mid)
+	err := _services.MetaData.DeleteRecord(serviceContext(c), mid)
+	if err == nil && _history != nil {
+		// deleted record keeps its last state in the history
+		if revs, herr := _history.Revisions(mid); herr == nil && len(revs) > 0 {
+			recordRevision(c, "delete", revs[len(revs)-1].Record)
+		}
 	}
-	return results
+	return serviceError(c, err)
 }
 
-// helper function to fetch sites info from discovery service
-func getMetaRecord(mid string) MetaDataRecord {
-	var results MetaDataRecord
-	rurl := fmt.Sprintf("%s/meta/record/%s", oreConfig.Config.Services.MetaDataURL, mid)
-	resp, err := httpGet(rurl)
-	if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
-		log.Println("query MetaData service rurl", rurl, err)
+// helper function to parse comma separated list of tags
+func parseTags(tags string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, tag := range strings.Split(tags, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		out = append(out, tag)
 	}
+	return out
+}
+
+// helper function to check that bucket exists at given site
+func bucketExists(c *gin.Context, site, bucket string) (bool, error) {
+	buckets, err := getBuckets(c, site)
 	if err != nil {
-		log.Println("ERROR:", err)
-		return results
+		return false, err
 	}
-	defer resp.Body.Close()
-	dec := json.NewDecoder(resp.Body)
-	if err := dec.Decode(&results); err != nil {
-		log.Println("ERROR:", err)
-		return results
+	for _, b := range buckets {
+		if b.Name == bucket {
+			return true, nil
+		}
 	}
-	return results
+	return false, nil
 }
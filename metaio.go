@@ -0,0 +1,543 @@
+package main
+
+// meta-data import and export module
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+// Field teams keep their sample manifests in spreadsheets. Manifests are
+// imported as tables: CSV files with header row, JSON-lines files with one
+// record per line or YAML files with list of records. Columns of the table
+// are mapped to fields of meta-data records, columns mapped to attributes
+// keep their names, e.g. "attr.depth_from" or "depth_from" columns become
+// depth_from attribute. Import is checked against existing records of the
+// site first (dry-run) and applied only when all rows are valid.
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// maxImportSize defines maximum size of imported meta-data file
+const maxImportSize = 10 << 20
+
+// metaFormats lists supported formats of meta-data import and export
+var metaFormats = []string{"csv", "jsonl", "yaml"}
+
+// metaTargets lists fields of meta-data record which table columns can be
+// mapped to, "attr" keeps column as record attribute
+var metaTargets = []string{"id", "bucket", "description", "tags", "project", "attr"}
+
+// MetaRow represents single row of imported table
+type MetaRow struct {
+	Line   int               // line or item number in imported file
+	Values map[string]string // values of row columns
+}
+
+// MetaTable represents imported table of meta-data records
+type MetaTable struct {
+	Columns []string  // columns in order of their appearance
+	Rows    []MetaRow // table rows
+}
+
+// helper function to add column to the table
+func (t *MetaTable) addColumn(name string) {
+	for _, col := range t.Columns {
+		if col == name {
+			return
+		}
+	}
+	t.Columns = append(t.Columns, name)
+}
+
+// Sample returns first non empty value of given column
+func (t MetaTable) Sample(column string) string {
+	for _, row := range t.Rows {
+		if val := row.Values[column]; val != "" {
+			return val
+		}
+	}
+	return ""
+}
+
+// helper function to get format of imported file from provided format or
+// file extension
+func importFormat(format, fname string) string {
+	for _, f := range metaFormats {
+		if f == format {
+			return format
+		}
+	}
+	switch strings.ToLower(filepath.Ext(fname)) {
+	case ".json", ".jsonl", ".ndjson":
+		return "jsonl"
+	case ".yaml", ".yml":
+		return "yaml"
+	}
+	return "csv"
+}
+
+// helper function to parse imported file into meta-data table
+func parseMetaTable(format string, data []byte) (MetaTable, error) {
+	var table MetaTable
+	var err error
+	switch format {
+	case "jsonl":
+		table, err = parseJSONLines(data)
+	case "yaml":
+		table, err = parseYAML(data)
+	default:
+		table, err = parseCSV(data)
+	}
+	if err == nil && len(table.Rows) == 0 {
+		err = errors.New("file does not contain any records")
+	}
+	return table, err
+}
+
+// helper function to parse CSV file, its first row provides column names
+func parseCSV(data []byte) (MetaTable, error) {
+	var table MetaTable
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return table, fmt.Errorf("unable to read CSV header: %w", err)
+	}
+	for i, col := range header {
+		header[i] = strings.TrimSpace(col)
+		table.addColumn(header[i])
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if err != nil {
+			return table, fmt.Errorf("line %d: %w", line, err)
+		}
+		row := MetaRow{Line: line, Values: make(map[string]string)}
+		empty := true
+		for i, val := range record {
+			if i >= len(header) {
+				return table, fmt.Errorf("line %d: row has more values than header columns", line)
+			}
+			row.Values[header[i]] = strings.TrimSpace(val)
+			if row.Values[header[i]] != "" {
+				empty = false
+			}
+		}
+		if !empty {
+			table.Rows = append(table.Rows, row)
+		}
+	}
+	return table, nil
+}
+
+// helper function to parse JSON-lines file
+func parseJSONLines(data []byte) (MetaTable, error) {
+	var table MetaTable
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		var obj map[string]any
+		if err := json.Unmarshal([]byte(line), &obj); err != nil {
+			return table, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		table.addRow(i+1, obj)
+	}
+	return table, nil
+}
+
+// helper function to parse YAML file with list of records
+func parseYAML(data []byte) (MetaTable, error) {
+	var table MetaTable
+	var objs []map[string]any
+	if err := yaml.Unmarshal(data, &objs); err != nil {
+		return table, err
+	}
+	for i, obj := range objs {
+		table.addRow(i+1, obj)
+	}
+	return table, nil
+}
+
+// helper function to add record of JSON-lines or YAML file to the table,
+// attributes of the record become attr.<name> columns
+func (t *MetaTable) addRow(line int, obj map[string]any) {
+	row := MetaRow{Line: line, Values: make(map[string]string)}
+	var keys []string
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if attrs, ok := obj[key].(map[string]any); ok && key == "attributes" {
+			var names []string
+			for name := range attrs {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				t.addColumn("attr." + name)
+				row.Values["attr."+name] = cellValue(attrs[name])
+			}
+			continue
+		}
+		t.addColumn(key)
+		row.Values[key] = cellValue(obj[key])
+	}
+	t.Rows = append(t.Rows, row)
+}
+
+// helper function to convert value of the record into table cell
+func cellValue(val any) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case []any:
+		var items []string
+		for _, item := range v {
+			items = append(items, cellValue(item))
+		}
+		return strings.Join(items, ", ")
+	case []string:
+		return strings.Join(v, ", ")
+	case float64:
+		return fmt.Sprintf("%g", v)
+	case map[string]any:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	return fmt.Sprintf("%v", val)
+}
+
+// helper function to guess mapping of table column
+func guessTarget(column string) string {
+	col := strings.ToLower(strings.TrimSpace(column))
+	switch col {
+	case "id", "mid", "meta_id", "_id":
+		return "id"
+	case "bucket", "bucket_name":
+		return "bucket"
+	case "description", "desc":
+		return "description"
+	case "tags", "tag", "keywords":
+		return "tags"
+	case "project":
+		return "project"
+	case "site":
+		// records are imported to the site of the page
+		return ""
+	}
+	return "attr"
+}
+
+// helper function to get attribute name of the column
+func attrName(column string) string {
+	return strings.TrimPrefix(column, "attr.")
+}
+
+// FieldChange represents change of record field found by import dry-run
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// ImportRow represents outcome of importing single table row
+type ImportRow struct {
+	Line    int           `json:"line"`
+	Action  string        `json:"action"` // create, update, unchanged or error
+	Status  string        `json:"status"` // outcome of applied import
+	Record  MetaData      `json:"record"`
+	Changes []FieldChange `json:"changes,omitempty"`
+	Errors  []string      `json:"errors,omitempty"`
+}
+
+// ImportReport represents dry-run or outcome of meta-data import
+type ImportReport struct {
+	Site      string      `json:"site"`
+	Format    string      `json:"format"`
+	DryRun    bool        `json:"dry_run"`
+	Create    int         `json:"create"`
+	Update    int         `json:"update"`
+	Unchanged int         `json:"unchanged"`
+	Invalid   int         `json:"invalid"`
+	Failed    int         `json:"failed"`
+	Rows      []ImportRow `json:"rows"`
+}
+
+// helper function to get values of record fields which are compared by
+// import dry-run
+func recordFields(rec MetaData) map[string]string {
+	fields := map[string]string{
+		"bucket":      rec.Bucket,
+		"description": rec.Description,
+		"tags":        strings.Join(rec.Tags, ", "),
+		"project":     rec.Project,
+	}
+	for name, val := range rec.Attributes {
+		fields["attr."+name] = cellValue(val)
+	}
+	return fields
+}
+
+// helper function to check imported table against existing records of the
+// site, mapping assigns table columns to record fields
+func buildImport(c *gin.Context, site string, table MetaTable, mapping map[string]string) (ImportReport, error) {
+	report := ImportReport{Site: site, DryRun: true}
+	records, err := metadata(c, site)
+	if err != nil {
+		return report, fmt.Errorf("fail to obtain meta-data records of site %s: %w", site, err)
+	}
+	existing := make(map[string]MetaData)
+	for _, rec := range records {
+		existing[rec.ID] = rec
+	}
+	buckets, err := getBuckets(c, site)
+	if err != nil {
+		return report, fmt.Errorf("fail to obtain buckets of site %s: %w", site, err)
+	}
+	bucketNames := make(map[string]bool)
+	for _, b := range buckets {
+		bucketNames[b.Name] = true
+	}
+	schemas := make(map[string]*JSONSchema)
+	seen := make(map[string]int)
+
+	for _, row := range table.Rows {
+		out := ImportRow{Line: row.Line, Action: "create"}
+		rec := MetaData{Site: site}
+		// records of JSON-lines and YAML files may omit some columns
+		mapped := func(target string) (string, bool) {
+			for _, col := range table.Columns {
+				if val, ok := row.Values[col]; ok && mapping[col] == target {
+					return val, true
+				}
+			}
+			return "", false
+		}
+		if id, ok := mapped("id"); ok && id != "" {
+			old, found := existing[id]
+			if !found {
+				out.Errors = append(out.Errors, fmt.Sprintf("record %s does not exist at site %s", id, site))
+			}
+			if line, dup := seen[id]; dup {
+				out.Errors = append(out.Errors, fmt.Sprintf("record %s is already updated by line %d", id, line))
+			}
+			seen[id] = row.Line
+			// fields which are not provided by the table keep their values
+			rec = old
+			rec.ID, rec.Site = id, site
+			out.Action = "update"
+		}
+		if val, ok := mapped("bucket"); ok {
+			rec.Bucket = val
+		}
+		if val, ok := mapped("description"); ok {
+			rec.Description = val
+		}
+		if val, ok := mapped("tags"); ok {
+			rec.Tags = parseTags(strings.ReplaceAll(val, ";", ","))
+		}
+		if val, ok := mapped("project"); ok {
+			rec.Project = val
+		}
+		attrs := make(map[string]any)
+		for name, val := range rec.Attributes {
+			attrs[name] = val
+		}
+		for _, col := range table.Columns {
+			if mapping[col] == "attr" && row.Values[col] != "" {
+				attrs[attrName(col)] = row.Values[col]
+			}
+		}
+
+		if rec.Bucket == "" {
+			out.Errors = append(out.Errors, "bucket is required")
+		} else if !bucketNames[rec.Bucket] {
+			out.Errors = append(out.Errors, fmt.Sprintf("bucket %s does not exist at site %s", rec.Bucket, site))
+		}
+		if rec.Description == "" {
+			out.Errors = append(out.Errors, "description is required")
+		}
+		// attributes of project records are converted and validated by project schema
+		if rec.Project != "" {
+			schema, ok := schemas[rec.Project]
+			if !ok {
+				schema, err = projectSchema(rec.Project)
+				if err != nil {
+					log.Println("ERROR:", err)
+				}
+				schemas[rec.Project] = schema
+			}
+			if schema == nil {
+				out.Errors = append(out.Errors, fmt.Sprintf("project %s has no valid schema", rec.Project))
+			} else {
+				parsed, errs := schema.ParseForm(func(name string) string {
+					return cellValue(attrs[name])
+				})
+				for _, name := range schema.Fields() {
+					if msg, ok := errs[name]; ok {
+						out.Errors = append(out.Errors, fmt.Sprintf("%s: %s", name, msg))
+					}
+				}
+				for name, val := range parsed {
+					attrs[name] = val
+				}
+			}
+		}
+		if len(attrs) > 0 {
+			rec.Attributes = attrs
+		}
+		out.Record = rec
+
+		if len(out.Errors) > 0 {
+			out.Action = "error"
+			report.Invalid++
+		} else if out.Action == "update" {
+			out.Changes = diffRecords(existing[rec.ID], rec)
+			if len(out.Changes) == 0 {
+				out.Action = "unchanged"
+				report.Unchanged++
+			} else {
+				report.Update++
+			}
+		} else {
+			fields := recordFields(rec)
+			for _, name := range sortedKeys(fields) {
+				if val := fields[name]; val != "" {
+					out.Changes = append(out.Changes, FieldChange{Field: name, New: val})
+				}
+			}
+			report.Create++
+		}
+		report.Rows = append(report.Rows, out)
+	}
+	return report, nil
+}
+
+// helper function to get sorted keys of the map
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// helper function to apply checked import, it creates and updates records
+// through MetaData service and reports outcome of every row
+func applyImport(c *gin.Context, report *ImportReport) {
+	report.DryRun = false
+	for i, row := range report.Rows {
+		switch row.Action {
+		case "create", "update":
+			rec, err := saveMetaRecord(c, row.Record, "import")
+			if err != nil {
+				log.Println("ERROR:", err)
+				report.Rows[i].Status = "failed"
+				report.Rows[i].Errors = append(report.Rows[i].Errors, err.Error())
+				report.Failed++
+				continue
+			}
+			report.Rows[i].Record = rec
+			report.Rows[i].Status = row.Action + "d"
+		default:
+			report.Rows[i].Status = row.Action
+		}
+	}
+}
+
+// helper function to get content type and file extension of export format
+func exportType(format string) (string, string) {
+	switch format {
+	case "jsonl":
+		return "application/x-ndjson", "jsonl"
+	case "yaml":
+		return "application/yaml", "yaml"
+	}
+	return "text/csv", "csv"
+}
+
+// helper function to stream meta-data records in given format, CSV columns
+// are record fields followed by attributes of the records
+func exportMeta(w io.Writer, format string, records []MetaData) error {
+	flush := func() {
+		if f, ok := w.(interface{ Flush() }); ok {
+			f.Flush()
+		}
+	}
+	switch format {
+	case "jsonl":
+		enc := json.NewEncoder(w)
+		for _, rec := range records {
+			if err := enc.Encode(rec); err != nil {
+				return err
+			}
+			flush()
+		}
+	case "yaml":
+		for _, rec := range records {
+			// use JSON names of record fields
+			data, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			var obj map[string]any
+			if err := json.Unmarshal(data, &obj); err != nil {
+				return err
+			}
+			data, err = yaml.Marshal([]any{obj})
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+			flush()
+		}
+	default:
+		names := make(map[string]string)
+		for _, rec := range records {
+			for name := range rec.Attributes {
+				names["attr."+name] = name
+			}
+		}
+		attrs := sortedKeys(names)
+		writer := csv.NewWriter(w)
+		header := append([]string{"id", "site", "bucket", "description", "tags", "project"}, attrs...)
+		if err := writer.Write(header); err != nil {
+			return err
+		}
+		for _, rec := range records {
+			row := []string{rec.ID, rec.Site, rec.Bucket, rec.Description, strings.Join(rec.Tags, ", "), rec.Project}
+			for _, col := range attrs {
+				row = append(row, cellValue(rec.Attributes[names[col]]))
+			}
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+			writer.Flush()
+			flush()
+		}
+		return writer.Error()
+	}
+	return nil
+}
@@ -0,0 +1,309 @@
+package main
+
+// meta-data import and export tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/OreCast/Frontend/client"
+	"github.com/gin-gonic/gin"
+)
+
+// helper function to create gin context of test request
+func testContext() *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	return c
+}
+
+// helper function to point clients of OreCast services to fake service
+// which responds with data of given paths
+func fakeServices(t *testing.T, data map[string]any) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		val, ok := data[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(client.Response{Status: "fail", Error: "not found"})
+			return
+		}
+		raw, _ := json.Marshal(val)
+		json.NewEncoder(w).Encode(client.Response{Status: "ok", Data: raw})
+	}))
+	t.Cleanup(srv.Close)
+	services := _services
+	t.Cleanup(func() { _services = services })
+	_services = client.New(client.Config{
+		DiscoveryURL:       srv.URL,
+		DataManagementURL:  srv.URL,
+		MetaDataURL:        srv.URL,
+		DataBookkeepingURL: srv.URL,
+		AuthzURL:           srv.URL,
+	})
+}
+
+// TestParseMetaTable tests parsing of imported files in all formats
+func TestParseMetaTable(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		data    string
+		columns []string
+		rows    []MetaRow
+		err     string
+	}{
+		{
+			name:    "csv",
+			format:  "csv",
+			data:    "\xef\xbb\xbfbucket, description ,depth\nb1, first ,1.5\n,,\nb2,\"second, quoted\"\n",
+			columns: []string{"bucket", "description", "depth"},
+			rows: []MetaRow{
+				{Line: 2, Values: map[string]string{"bucket": "b1", "description": "first", "depth": "1.5"}},
+				{Line: 4, Values: map[string]string{"bucket": "b2", "description": "second, quoted"}},
+			},
+		},
+		{
+			name:   "csv with extra values",
+			format: "csv",
+			data:   "bucket\nb1,extra\n",
+			err:    "line 2: row has more values than header columns",
+		},
+		{
+			name:   "csv without records",
+			format: "csv",
+			data:   "bucket,description\n",
+			err:    "does not contain any records",
+		},
+		{
+			name:    "jsonl",
+			format:  "jsonl",
+			data:    "{\"bucket\":\"b1\",\"tags\":[\"a\",\"b\"],\"attributes\":{\"depth\":1.5,\"hole\":\"DH-1\"}}\n\n{\"bucket\":\"b2\",\"id\":null}\n",
+			columns: []string{"attr.depth", "attr.hole", "bucket", "tags", "id"},
+			rows: []MetaRow{
+				{Line: 1, Values: map[string]string{"attr.depth": "1.5", "attr.hole": "DH-1", "bucket": "b1", "tags": "a, b"}},
+				{Line: 3, Values: map[string]string{"bucket": "b2", "id": ""}},
+			},
+		},
+		{
+			name:   "invalid jsonl",
+			format: "jsonl",
+			data:   "{\"bucket\":\"b1\"}\n{bucket}\n",
+			err:    "line 2:",
+		},
+		{
+			name:    "yaml",
+			format:  "yaml",
+			data:    "- bucket: b1\n  attributes:\n    depth: 2\n- bucket: b2\n  description: second\n",
+			columns: []string{"attr.depth", "bucket", "description"},
+			rows: []MetaRow{
+				{Line: 1, Values: map[string]string{"attr.depth": "2", "bucket": "b1"}},
+				{Line: 2, Values: map[string]string{"bucket": "b2", "description": "second"}},
+			},
+		},
+		{
+			name:   "yaml without list",
+			format: "yaml",
+			data:   "bucket: b1\n",
+			err:    "cannot unmarshal",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, err := parseMetaTable(tt.format, []byte(tt.data))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(table.Columns, tt.columns) {
+				t.Errorf("got columns %v, want %v", table.Columns, tt.columns)
+			}
+			if !reflect.DeepEqual(table.Rows, tt.rows) {
+				t.Errorf("got rows %+v, want %+v", table.Rows, tt.rows)
+			}
+		})
+	}
+}
+
+// TestImportFormat tests detection of format of imported files
+func TestImportFormat(t *testing.T) {
+	tests := []struct {
+		format, fname, want string
+	}{
+		{"yaml", "data.csv", "yaml"},
+		{"", "data.ndjson", "jsonl"},
+		{"", "data.JSON", "jsonl"},
+		{"", "data.yml", "yaml"},
+		{"", "data.txt", "csv"},
+		{"xml", "data", "csv"},
+	}
+	for _, tt := range tests {
+		if got := importFormat(tt.format, tt.fname); got != tt.want {
+			t.Errorf("importFormat(%q, %q) = %q, want %q", tt.format, tt.fname, got, tt.want)
+		}
+	}
+}
+
+// TestBuildImport tests import dry-run against existing records of the site
+func TestBuildImport(t *testing.T) {
+	fakeServices(t, map[string]any{
+		"/meta/Cornell": []MetaData{
+			{ID: "m1", Site: "Cornell", Bucket: "b1", Description: "first", Tags: []string{"a"}},
+			{ID: "m2", Site: "Cornell", Bucket: "b1", Description: "second", Attributes: map[string]any{"depth": "1"}},
+		},
+		"/storage/Cornell": map[string]any{"site": "Cornell", "buckets": []BucketObject{{Name: "b1"}, {Name: "b2"}}},
+	})
+	schemas := _schemas
+	t.Cleanup(func() { _schemas = schemas })
+	_schemas = &SchemaStore{Dir: t.TempDir()}
+	err := _schemas.Save(ProjectSchema{Project: "drill", Schema: json.RawMessage(`{
+		"type": "object",
+		"properties": {"depth": {"type": "number", "minimum": 0}},
+		"required": ["depth"]
+	}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := parseCSV([]byte(`id,bucket,description,tags,project,depth,site
+,b2,new record,x;y,,5,MIT
+m1,b1,first,a,,,
+m1,b1,first again,a,,,
+m2,b1,second,,,2,
+m3,b1,missing,,,,
+,b3,,,,,
+,b1,drill core,,drill,-1,
+,b1,drill core,,drill,3.5,
+,b1,unknown project,,mining,,
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapping := make(map[string]string)
+	for _, col := range table.Columns {
+		mapping[col] = guessTarget(col)
+	}
+	report, err := buildImport(testContext(), "Cornell", table, mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type outcome struct {
+		action  string
+		changes []FieldChange
+		errors  []string
+	}
+	want := []outcome{
+		{"create", []FieldChange{
+			{Field: "attr.depth", New: "5"},
+			{Field: "bucket", New: "b2"},
+			{Field: "description", New: "new record"},
+			{Field: "tags", New: "x, y"},
+		}, nil},
+		{"unchanged", nil, nil},
+		{"error", nil, []string{"record m1 is already updated by line 3"}},
+		{"update", []FieldChange{
+			{Field: "attr.depth", Old: "1", New: "2"},
+		}, nil},
+		{"error", nil, []string{"record m3 does not exist at site Cornell"}},
+		{"error", nil, []string{"bucket b3 does not exist at site Cornell", "description is required"}},
+		{"error", nil, []string{"depth: should be greater than or equal to 0"}},
+		{"create", []FieldChange{
+			{Field: "attr.depth", New: "3.5"},
+			{Field: "bucket", New: "b1"},
+			{Field: "description", New: "drill core"},
+			{Field: "project", New: "drill"},
+		}, nil},
+		{"error", nil, []string{"project mining has no valid schema"}},
+	}
+	if len(report.Rows) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(report.Rows), len(want))
+	}
+	for i, row := range report.Rows {
+		if row.Action != want[i].action {
+			t.Errorf("line %d: got action %s, want %s, errors %v", row.Line, row.Action, want[i].action, row.Errors)
+		}
+		if want[i].action != "error" && !reflect.DeepEqual(row.Changes, want[i].changes) {
+			t.Errorf("line %d: got changes %+v, want %+v", row.Line, row.Changes, want[i].changes)
+		}
+		if !reflect.DeepEqual(row.Errors, want[i].errors) {
+			t.Errorf("line %d: got errors %q, want %q", row.Line, row.Errors, want[i].errors)
+		}
+		if row.Record.Site != "Cornell" {
+			t.Errorf("line %d: record is imported to site %s", row.Line, row.Record.Site)
+		}
+	}
+	if report.Create != 2 || report.Update != 1 || report.Unchanged != 1 || report.Invalid != 5 {
+		t.Errorf("unexpected report counts %+v", report)
+	}
+	// fields which are not provided by the table keep their values
+	if rec := report.Rows[3].Record; rec.Description != "second" || rec.Bucket != "b1" {
+		t.Errorf("unexpected updated record %+v", rec)
+	}
+	// project attributes are converted by project schema
+	if depth := report.Rows[7].Record.Attributes["depth"]; depth != 3.5 {
+		t.Errorf("got depth %#v, want 3.5", depth)
+	}
+}
+
+// countingReader counts bytes read from underlying reader
+type countingReader struct {
+	reader io.Reader
+	size   int
+}
+
+// Read implements io.Reader interface
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.size += n
+	return n, err
+}
+
+// TestMetaImportTooLarge tests that imported request body is limited before
+// it is parsed
+func TestMetaImportTooLarge(t *testing.T) {
+	testPolicy(t)
+	calls := countingServices(t)
+	route := Route{"POST", "/meta/:site/import", PermDataWrite, MetaImportPostHandler}
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "records.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("id,description\n"))
+	part.Write(bytes.Repeat([]byte("1,record\n"), 2*maxImportSize/9))
+	writer.Close()
+	size := body.Len()
+	reader := &countingReader{reader: &body}
+	req := httptest.NewRequest("POST", "/meta/A/import", reader)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	testRouter("alice", route).ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("got status %d, want %d: %s", w.Code, http.StatusRequestEntityTooLarge, w.Body.String())
+	}
+	if reader.size >= size {
+		t.Errorf("whole request body of %d bytes is read", size)
+	}
+	if n := calls.Load(); n != 0 {
+		t.Errorf("OreCast services are called %d times", n)
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+// meta-data search module
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+// Meta-data records of all sites are searched by free text over their
+// descriptions and narrowed by tag, site and bucket facets. Values of the
+// same facet are alternatives while different facets narrow results
+// together, e.g. ?q=drill+core&tag=Cu&tag=Au&site=Cornell provides Cornell
+// records whose description mentions drill and core and which are tagged
+// by Cu or Au. Facet counts are computed over records matching all other
+// facets, therefore they tell how many records selection of the value adds.
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	oreConfig "github.com/OreCast/common/config"
+	"github.com/gin-gonic/gin"
+)
+
+// metaSortKeys lists allowed sort keys of meta-data search
+var metaSortKeys = []string{"relevance", "site", "bucket", "description", "id"}
+
+// MetaSearchParams represents query parameters of meta-data search page
+type MetaSearchParams struct {
+	Query   string   `form:"q" json:"q"`            // free text search over descriptions
+	Tags    []string `form:"tag" json:"tags"`       // tag facet values
+	Sites   []string `form:"site" json:"sites"`     // site facet values
+	Buckets []string `form:"bucket" json:"buckets"` // bucket facet values
+	Sort    string   `form:"sort" json:"sort"`      // one of metaSortKeys
+	Order   string   `form:"order" json:"order"`    // asc or desc
+	Limit   int      `form:"limit" json:"limit"`    // number of results per page
+	Page    int      `form:"page" json:"page"`      // page number starting from 1
+}
+
+// helper function to set default values of search parameters
+func (p *MetaSearchParams) normalize() {
+	p.Query = strings.TrimSpace(p.Query)
+	known := false
+	for _, key := range metaSortKeys {
+		known = known || key == p.Sort
+	}
+	if !known {
+		p.Sort = "site"
+		if p.Query != "" {
+			p.Sort = "relevance"
+		}
+	}
+	if p.Order != "desc" {
+		p.Order = "asc"
+	}
+	if p.Limit <= 0 || p.Limit > 500 {
+		p.Limit = 50
+	}
+	if p.Page <= 0 {
+		p.Page = 1
+	}
+}
+
+// helper function to encode search parameters, the overrides replace given
+// parameters and empty overrides remove them
+func (p MetaSearchParams) values(overrides url.Values) url.Values {
+	vals := url.Values{}
+	vals.Set("q", p.Query)
+	vals["tag"] = p.Tags
+	vals["site"] = p.Sites
+	vals["bucket"] = p.Buckets
+	vals.Set("sort", p.Sort)
+	vals.Set("order", p.Order)
+	vals.Set("limit", fmt.Sprintf("%d", p.Limit))
+	vals.Set("page", fmt.Sprintf("%d", p.Page))
+	for key, val := range overrides {
+		vals[key] = val
+	}
+	for key, val := range vals {
+		if len(val) == 0 || val[0] == "" {
+			vals.Del(key)
+		}
+	}
+	return vals
+}
+
+// helper function to build bookmarkable url of the search with given overrides
+func (p MetaSearchParams) url(overrides url.Values) string {
+	base := oreConfig.Config.Frontend.WebServer.Base
+	return fmt.Sprintf("%s/meta?%s", base, p.values(overrides).Encode())
+}
+
+// MetaHit represents meta-data record found by the search
+type MetaHit struct {
+	Site   string   `json:"site"`
+	Record MetaData `json:"record"`
+	Score  int      `json:"score"` // number of occurrences of query terms
+}
+
+// FacetValue represents value of the facet
+type FacetValue struct {
+	Value    string `json:"value"`
+	Count    int    `json:"count"`
+	Selected bool   `json:"selected"`
+	URL      string `json:"-"` // search url which toggles the value
+}
+
+// Facet represents facet of meta-data search
+type Facet struct {
+	Name   string       `json:"name"`
+	Param  string       `json:"param"` // query parameter of the facet
+	Values []FacetValue `json:"values"`
+}
+
+// MetaSearchResult represents meta-data search page
+type MetaSearchResult struct {
+	Params      MetaSearchParams `json:"params"`
+	Total       int              `json:"total"`
+	Hits        []MetaHit        `json:"hits"`
+	Facets      []Facet          `json:"facets"`
+	Unavailable []string         `json:"unavailable_sites,omitempty"` // sites whose records were not obtained
+}
+
+// helper function to count occurrences of query terms in the text, it
+// returns zero if any of the terms is missing
+func textScore(text string, terms []string) int {
+	text = strings.ToLower(text)
+	score := 0
+	for _, term := range terms {
+		n := strings.Count(text, term)
+		if n == 0 {
+			return 0
+		}
+		score += n
+	}
+	return score
+}
+
+// helper function to check if any of record values is selected by the facet
+func facetMatch(selected, values []string) bool {
+	if len(selected) == 0 {
+		return true
+	}
+	for _, s := range selected {
+		for _, v := range values {
+			if s == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// helper function to search meta-data records of the sites
+func searchMetadata(results []MetaResult, params MetaSearchParams) MetaSearchResult {
+	out := MetaSearchResult{Params: params}
+	terms := strings.Fields(strings.ToLower(params.Query))
+
+	// records matching free text query, facets are applied below
+	var hits []MetaHit
+	for _, r := range results {
+		if r.Error != nil {
+			out.Unavailable = append(out.Unavailable, r.Site)
+			continue
+		}
+		for _, rec := range r.Records {
+			score := 1
+			if len(terms) > 0 {
+				score = textScore(rec.Description, terms)
+			}
+			if score > 0 {
+				hits = append(hits, MetaHit{Site: r.Site, Record: rec, Score: score})
+			}
+		}
+	}
+
+	// facet values of the hit, facets are ordered as tag, site and bucket
+	facetValues := func(h MetaHit) [3][]string {
+		return [3][]string{h.Record.Tags, {h.Site}, {h.Record.Bucket}}
+	}
+	selected := [3][]string{params.Tags, params.Sites, params.Buckets}
+	counts := [3]map[string]int{{}, {}, {}}
+	for _, h := range hits {
+		vals := facetValues(h)
+		match := [3]bool{}
+		for i := range vals {
+			match[i] = facetMatch(selected[i], vals[i])
+		}
+		// facet counts take into account selections of other facets only
+		for i := range vals {
+			others := true
+			for j := range vals {
+				if j != i && !match[j] {
+					others = false
+				}
+			}
+			if !others {
+				continue
+			}
+			seen := make(map[string]bool)
+			for _, v := range vals[i] {
+				if v != "" && !seen[v] {
+					counts[i][v]++
+					seen[v] = true
+				}
+			}
+		}
+		if match[0] && match[1] && match[2] {
+			out.Hits = append(out.Hits, h)
+		}
+	}
+
+	names := [3]string{"Tags", "Sites", "Buckets"}
+	param := [3]string{"tag", "site", "bucket"}
+	for i := range names {
+		facet := Facet{Name: names[i], Param: param[i]}
+		// selected values are always shown even if they have no records
+		for _, v := range selected[i] {
+			if _, ok := counts[i][v]; !ok {
+				counts[i][v] = 0
+			}
+		}
+		for value, count := range counts[i] {
+			fv := FacetValue{Value: value, Count: count}
+			var vals []string
+			for _, v := range selected[i] {
+				if v == value {
+					fv.Selected = true
+				} else {
+					vals = append(vals, v)
+				}
+			}
+			if !fv.Selected {
+				vals = append(vals, value)
+			}
+			// facet selection starts new result list
+			fv.URL = params.url(url.Values{param[i]: vals, "page": nil})
+			facet.Values = append(facet.Values, fv)
+		}
+		sort.Slice(facet.Values, func(a, b int) bool {
+			va, vb := facet.Values[a], facet.Values[b]
+			if va.Count != vb.Count {
+				return va.Count > vb.Count
+			}
+			return va.Value < vb.Value
+		})
+		out.Facets = append(out.Facets, facet)
+	}
+
+	sortHits(out.Hits, params.Sort, params.Order)
+	out.Total = len(out.Hits)
+	start := (params.Page - 1) * params.Limit
+	if start > len(out.Hits) {
+		start = len(out.Hits)
+	}
+	end := start + params.Limit
+	if end > len(out.Hits) {
+		end = len(out.Hits)
+	}
+	out.Hits = out.Hits[start:end]
+	return out
+}
+
+// helper function to sort search hits by given key and order
+func sortHits(hits []MetaHit, key, order string) {
+	value := func(h MetaHit) string {
+		switch key {
+		case "bucket":
+			return h.Record.Bucket
+		case "description":
+			return strings.ToLower(h.Record.Description)
+		case "id":
+			return h.Record.ID
+		}
+		return h.Site
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		if key == "relevance" {
+			// most relevant records always come first
+			if a.Score != b.Score {
+				return a.Score > b.Score
+			}
+			return a.Site < b.Site
+		}
+		va, vb := value(a), value(b)
+		if va == vb {
+			return a.Record.ID < b.Record.ID
+		}
+		return (va < vb) == (order == "asc")
+	})
+}
+
+// helper function to search meta-data records of all sites
+func metaSearch(c *gin.Context, params MetaSearchParams) (MetaSearchResult, error) {
+	sites, err := getSites(c)
+	if err != nil {
+		return MetaSearchResult{Params: params}, err
+	}
+	var names []string
+	for _, site := range sites {
+		names = append(names, site.Name)
+	}
+	return searchMetadata(sitesMetadata(c, names), params), nil
+}
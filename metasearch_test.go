@@ -0,0 +1,158 @@
+package main
+
+// meta-data search tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+
+	oreConfig "github.com/OreCast/common/config"
+)
+
+// helper function to get counts of facet values
+func facetCounts(f Facet) map[string]int {
+	counts := make(map[string]int)
+	for _, v := range f.Values {
+		counts[v.Value] = v.Count
+	}
+	return counts
+}
+
+// helper function to get ids of search hits
+func hitIDs(hits []MetaHit) []string {
+	var ids []string
+	for _, h := range hits {
+		ids = append(ids, h.Record.ID)
+	}
+	return ids
+}
+
+// TestSearchMetadata tests free text search and facet counts of meta-data search
+func TestSearchMetadata(t *testing.T) {
+	if oreConfig.Config == nil {
+		oreConfig.Config = &oreConfig.OreCastConfig{}
+	}
+	results := []MetaResult{
+		{Site: "Cornell", Records: []MetaData{
+			{ID: "c1", Bucket: "core", Description: "Drill core samples", Tags: []string{"Cu", "Au"}},
+			{ID: "c2", Bucket: "core", Description: "Drill core of drill-hole DH-2", Tags: []string{"Cu", "Cu"}},
+			{ID: "c3", Bucket: "maps", Description: "Geological maps", Tags: []string{"Li"}},
+		}},
+		{Site: "MIT", Records: []MetaData{
+			{ID: "m1", Bucket: "core", Description: "Core photos", Tags: []string{"Au"}},
+			{ID: "m2", Bucket: "logs", Description: "Drill logs"},
+		}},
+		{Site: "Down", Error: errors.New("timeout")},
+	}
+	tests := []struct {
+		name    string
+		params  MetaSearchParams
+		hits    []string
+		tags    map[string]int
+		sites   map[string]int
+		buckets map[string]int
+	}{
+		{
+			name:    "all records",
+			params:  MetaSearchParams{},
+			hits:    []string{"c1", "c2", "c3", "m1", "m2"},
+			tags:    map[string]int{"Cu": 2, "Au": 2, "Li": 1},
+			sites:   map[string]int{"Cornell": 3, "MIT": 2},
+			buckets: map[string]int{"core": 3, "maps": 1, "logs": 1},
+		},
+		{
+			name:    "free text",
+			params:  MetaSearchParams{Query: "DRILL core"},
+			hits:    []string{"c2", "c1"},
+			tags:    map[string]int{"Cu": 2, "Au": 1},
+			sites:   map[string]int{"Cornell": 2},
+			buckets: map[string]int{"core": 2},
+		},
+		{
+			// counts of the facet ignore its own selection
+			name:    "tag alternatives",
+			params:  MetaSearchParams{Tags: []string{"Au", "Li"}},
+			hits:    []string{"c1", "c3", "m1"},
+			tags:    map[string]int{"Cu": 2, "Au": 2, "Li": 1},
+			sites:   map[string]int{"Cornell": 2, "MIT": 1},
+			buckets: map[string]int{"core": 2, "maps": 1},
+		},
+		{
+			name:    "facets narrow each other",
+			params:  MetaSearchParams{Tags: []string{"Au"}, Sites: []string{"MIT"}},
+			hits:    []string{"m1"},
+			tags:    map[string]int{"Au": 1},
+			sites:   map[string]int{"Cornell": 1, "MIT": 1},
+			buckets: map[string]int{"core": 1},
+		},
+		{
+			// selected values are shown even without records
+			name:    "selected value without records",
+			params:  MetaSearchParams{Buckets: []string{"empty"}},
+			hits:    nil,
+			tags:    map[string]int{},
+			sites:   map[string]int{},
+			buckets: map[string]int{"core": 3, "maps": 1, "logs": 1, "empty": 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := tt.params
+			params.normalize()
+			out := searchMetadata(results, params)
+			if got := hitIDs(out.Hits); !reflect.DeepEqual(got, tt.hits) {
+				t.Errorf("got hits %v, want %v", got, tt.hits)
+			}
+			if out.Total != len(tt.hits) {
+				t.Errorf("got total %d, want %d", out.Total, len(tt.hits))
+			}
+			if !reflect.DeepEqual(out.Unavailable, []string{"Down"}) {
+				t.Errorf("got unavailable sites %v", out.Unavailable)
+			}
+			want := []map[string]int{tt.tags, tt.sites, tt.buckets}
+			for i, facet := range out.Facets {
+				if got := facetCounts(facet); !reflect.DeepEqual(got, want[i]) {
+					t.Errorf("facet %s: got counts %v, want %v", facet.Name, got, want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestSearchMetadataFacetURL tests that facet values toggle their selection
+func TestSearchMetadataFacetURL(t *testing.T) {
+	if oreConfig.Config == nil {
+		oreConfig.Config = &oreConfig.OreCastConfig{}
+	}
+	results := []MetaResult{{Site: "Cornell", Records: []MetaData{
+		{ID: "c1", Bucket: "core", Tags: []string{"Cu", "Au"}},
+	}}}
+	params := MetaSearchParams{Tags: []string{"Cu"}, Page: 3}
+	params.normalize()
+	out := searchMetadata(results, params)
+	for _, v := range out.Facets[0].Values {
+		u, err := url.Parse(v.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		query := u.Query()
+		want := []string{"Cu", "Au"}
+		if v.Value == "Cu" {
+			want = nil
+		}
+		if !v.Selected == (v.Value == "Cu") {
+			t.Errorf("value %s is selected %v", v.Value, v.Selected)
+		}
+		if !reflect.DeepEqual(query["tag"], want) {
+			t.Errorf("value %s: got tags %v, want %v", v.Value, query["tag"], want)
+		}
+		if query.Get("page") != "" {
+			t.Errorf("value %s: facet selection keeps page %s", v.Value, query.Get("page"))
+		}
+	}
+}
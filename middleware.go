@@ -1,17 +1,16 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
+	"expvar"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
-	"net/http/httputil"
 	"net/url"
-	"strings"
+	"time"
 
+	"github.com/OreCast/Frontend/client"
 	authz "github.com/OreCast/common/authz"
 	oreConfig "github.com/OreCast/common/config"
 	"github.com/gin-gonic/gin"
@@ -19,8 +18,24 @@ import (
 	cryptoutils "github.com/vkuznet/cryptoutils"
 )
 
-// _token is used across all authorized APIs
-var _token *authz.Token
+// tokenRefreshMargin defines how long before expiration we refresh user token
+var tokenRefreshMargin = 60 * time.Second
+
+// UserToken represents OAuth token issued by Authz service to individual user
+type UserToken struct {
+	authz.Token
+	RefreshToken string    `json:"refresh_token"`
+	Login        string    `json:"login"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// Expired checks if user token is expired or close to its expiration
+func (t *UserToken) Expired() bool {
+	if t.ExpiresAt.IsZero() {
+		return false
+	}
+	return time.Now().Add(tokenRefreshMargin).After(t.ExpiresAt)
+}
 
 // gin cookies
 // https://gin-gonic.com/docs/examples/cookie/
@@ -28,76 +43,108 @@ var _token *authz.Token
 // https://stackoverflow.com/questions/66289603/use-existing-session-cookie-in-gin-router
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// check if our user key is set
-		if user, err := c.Cookie("user"); err == nil {
+		// check if request has valid session
+		session, err := _sessions.Load(c)
+		if err != nil {
 			if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
-				log.Println(c.Request.Method, c.Request.URL.Path, user)
+				log.Println(c.Request.Method, c.Request.URL.Path, err)
 			}
-			c.Set("user", user)
-			if err := refreshToken(); err != nil {
-				c.SetCookie("user", "", -1, "/", "localhost", false, true)
-				c.Set("user", "")
-				content := errorTmpl(c, "unable to get valid token", err)
-				log.Fatal(content)
-				//                 c.Data(http.StatusUnauthorized, "text/html; charset=utf-8", []byte(content))
-				//                 c.Redirect(http.StatusFound, "/")
+			if wantJSON(c) {
+				apiError(c, http.StatusUnauthorized, "no valid session found, please login", nil)
+				c.Abort()
 				return
 			}
+			c.Redirect(http.StatusFound, "/login")
+			c.Abort()
 			return
 		}
+		user := session.User
+		if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
+			log.Println(c.Request.Method, c.Request.URL.Path, user)
+		}
 
-		if user, ok := c.Get("user"); !ok {
-			if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
-				log.Println(c.Request.Method, c.Request.URL.Path)
+		// each user session holds its own token obtained at login time
+		token, err := refreshToken(session)
+		if err != nil {
+			log.Printf("WARNING: unable to get valid token for user %s, error %v", user, err)
+			_sessions.Destroy(c)
+			if wantJSON(c) {
+				apiError(c, http.StatusUnauthorized, "unable to get valid token, please login", nil)
+				c.Abort()
+				return
 			}
 			c.Redirect(http.StatusFound, "/login")
-		} else {
-			if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
-				log.Println(c.Request.Method, c.Request.URL.Path, user)
-			}
-		}
-		if err := refreshToken(); err != nil {
-			content := errorTmpl(c, "unable to get valid token", err)
-			c.Data(http.StatusUnauthorized, "text/html; charset=utf-8", []byte(content))
+			c.Abort()
 			return
 		}
+		c.Set("user", user)
+		c.Set("token", token)
 		c.Next()
 	}
 }
 
-// helper function to refresh global token used in authorized APIs
-func refreshToken() error {
-	// check and obtain token
-	var err error
-	if _token == nil {
-		if token, err := getToken(); err == nil {
-			_token = &token
-		} else {
-			return err
+// helper function to refresh token of user session used in authorized APIs
+func refreshToken(session *Session) (*UserToken, error) {
+	token := session.Token
+	if token == nil {
+		return nil, errors.New("no token found, please login")
+	}
+	if !token.Expired() {
+		if err := token.Validate(oreConfig.Config.Authz.ClientId); err == nil {
+			return token, nil
 		}
-	} else {
-		err = _token.Validate(oreConfig.Config.Authz.ClientId)
 	}
-	return err
+	if token.RefreshToken == "" {
+		return nil, errors.New("token is expired and can not be refreshed")
+	}
+	form := url.Values{}
+	form.Add("grant_type", "refresh_token")
+	form.Add("refresh_token", token.RefreshToken)
+	newToken, err := requestToken(form)
+	if err != nil {
+		return nil, err
+	}
+	newToken.Login = session.User
+	session.Token = &newToken
+	if err := _sessions.Save(session); err != nil {
+		return nil, err
+	}
+	if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
+		log.Printf("INFO: refreshed token of user %s", session.User)
+	}
+	return &newToken, nil
 }
 
-// helper function to obtain JWT token from OreCast Authz service
-func getToken() (authz.Token, error) {
-	var token authz.Token
-	rurl := fmt.Sprintf("%s/oauth/token?client_id=%s&client_secret=%s&grant_type=client_credentials&scope=read", oreConfig.Config.Services.AuthzURL, oreConfig.Config.Authz.ClientId, oreConfig.Config.Authz.ClientSecret)
-	resp, err := http.Get(rurl)
-	defer resp.Body.Close()
-	data, err := io.ReadAll(resp.Body)
+// helper function to obtain JWT token for given user from OreCast Authz service,
+// the password should be encrypted in the same way as we do for login form
+func getUserToken(login, password string) (UserToken, error) {
+	form := url.Values{}
+	form.Add("grant_type", "password")
+	form.Add("username", login)
+	form.Add("password", password)
+	token, err := requestToken(form)
 	if err != nil {
 		return token, err
 	}
-	err = json.Unmarshal(data, &token)
+	token.Login = login
+	return token, nil
+}
+
+// helper function to request JWT token from OreCast Authz service
+func requestToken(form url.Values) (UserToken, error) {
+	var token UserToken
+	resp, err := _services.Authz.Token(context.Background(), form)
 	if err != nil {
 		return token, err
 	}
+	token.Token = resp.Token
+	token.RefreshToken = resp.RefreshToken
+	if token.Expires > 0 {
+		token.ExpiresAt = time.Now().Add(time.Duration(token.Expires) * time.Second)
+	}
 	reqToken := token.AccessToken
 	if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
-		log.Printf("INFO: obtain token %+v", token)
+		log.Printf("INFO: obtain token, scope %s expires at %v", token.Scope, token.ExpiresAt)
 	}
 
 	// validate our token
@@ -119,68 +166,80 @@ func getToken() (authz.Token, error) {
 	return token, nil
 }
 
-// helper function to perform HTTP GET request with bearer token
-func httpGet(rurl string) (*http.Response, error) {
-	req, err := http.NewRequest("GET", rurl, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", _token.AccessToken))
-	req.Header.Add("Accept-Encoding", "")
-	client := &http.Client{}
-	if oreConfig.Config.Frontend.WebServer.Verbose > 1 {
-		dump, err := httputil.DumpRequestOut(req, true)
-		log.Println("request", string(dump), err)
-	}
-	resp, err := client.Do(req)
-	if oreConfig.Config.Frontend.WebServer.Verbose > 1 {
-		dump, err := httputil.DumpResponse(resp, true)
-		log.Println("response", string(dump), err)
+// helper function to get access token of the user who made given request
+func accessToken(c *gin.Context) string {
+	if val, ok := c.Get("token"); ok {
+		if token, ok := val.(*UserToken); ok {
+			return token.AccessToken
+		}
 	}
-	return resp, err
+	return ""
 }
 
-// helper function to perform HTTP POST request with bearer token
-func httpPost(rurl, contentType string, buffer *bytes.Buffer) (*http.Response, error) {
-	req, err := http.NewRequest("POST", rurl, buffer)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", _token.AccessToken))
-	req.Header.Add("Content-Type", contentType)
-	req.Header.Add("Accept", contentType)
-	client := &http.Client{}
-	if oreConfig.Config.Frontend.WebServer.Verbose > 1 {
-		dump, err := httputil.DumpRequestOut(req, true)
-		log.Println("request", string(dump), err)
-	}
-	resp, err := client.Do(req)
-	if oreConfig.Config.Frontend.WebServer.Verbose > 1 {
-		dump, err := httputil.DumpResponse(resp, true)
-		log.Println("response", string(dump), err)
+// _services holds clients of OreCast backend services
+var _services *client.Services
+
+// helper function to initialize clients of OreCast backend services
+func initServices() {
+	_services = client.New(client.Config{
+		DiscoveryURL:       oreConfig.Config.Services.DiscoveryURL,
+		DataManagementURL:  oreConfig.Config.Services.DataManagementURL,
+		MetaDataURL:        oreConfig.Config.Services.MetaDataURL,
+		DataBookkeepingURL: oreConfig.Config.Services.DataBookkeepingURL,
+		AuthzURL:           oreConfig.Config.Services.AuthzURL,
+		ClientID:           oreConfig.Config.Authz.ClientId,
+		ClientSecret:       oreConfig.Config.Authz.ClientSecret,
+		Timeout:            time.Duration(frontendConfig.ServiceTimeout) * time.Second,
+		ConnectTimeout:     time.Duration(frontendConfig.ServiceConnectTimeout) * time.Second,
+		Retries:            max(frontendConfig.ServiceRetries, 0),
+		BreakerThreshold:   max(frontendConfig.BreakerThreshold, 0),
+		BreakerCooldown:    time.Duration(frontendConfig.BreakerCooldown) * time.Second,
+		CacheTTL:           time.Duration(max(frontendConfig.CacheTTL, 0)) * time.Second,
+		CacheMaxEntries:    frontendConfig.CacheMaxEntries,
+		Verbose:            oreConfig.Config.Frontend.WebServer.Verbose,
+	})
+	// cache statistics are exported along with other expvar metrics, see /debug/vars
+	if _services.Cache != nil {
+		expvar.Publish("service_cache", expvar.Func(func() any {
+			return _services.Cache.Stats()
+		}))
 	}
-	return resp, err
 }
 
-// helper function to perform HTTP POST form request with bearer token
-func httpPostForm(rurl string, formData url.Values) (*http.Response, error) {
-	req, err := http.NewRequest("POST", rurl, strings.NewReader(formData.Encode()))
-	if err != nil {
-		return nil, err
+// helper function to get context of upstream calls made on behalf of the user
+func serviceContext(c *gin.Context) context.Context {
+	ctx := client.WithToken(c.Request.Context(), accessToken(c))
+	if user, ok := c.Get("user"); ok {
+		ctx = client.WithUser(ctx, fmt.Sprintf("%v", user))
 	}
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", _token.AccessToken))
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	client := &http.Client{}
-	if oreConfig.Config.Frontend.WebServer.Verbose > 1 {
-		dump, err := httputil.DumpRequestOut(req, true)
-		log.Println("request", string(dump), err)
+	return ctx
+}
+
+// helper function to record unavailable service of given error, such services
+// are shown as banners on web UI pages, see bannerTmpl
+func serviceError(c *gin.Context, err error) error {
+	var serr *client.Error
+	if errors.As(err, &serr) && errors.Is(err, client.ErrUnavailable) {
+		var services []string
+		if val, ok := c.Get("unavailable"); ok {
+			services = val.([]string)
+		}
+		for _, srv := range services {
+			if srv == serr.Service {
+				return err
+			}
+		}
+		c.Set("unavailable", append(services, serr.Service))
 	}
-	resp, err := client.Do(req)
-	if oreConfig.Config.Frontend.WebServer.Verbose > 1 {
-		dump, err := httputil.DumpResponse(resp, true)
-		log.Println("response", string(dump), err)
+	return err
+}
+
+// helper function to get HTTP status code of the page for given service error
+func serviceStatus(err error) int {
+	if errors.Is(err, client.ErrUnavailable) {
+		return http.StatusServiceUnavailable
 	}
-	return resp, err
+	return http.StatusBadRequest
 }
 
 // helper function to encrypt user registration form attributes
@@ -0,0 +1,503 @@
+package main
+
+// OpenAPI module
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+// OpenAPI 3 specification is generated from the routes registered in
+// setupRouter and Go structs used by the handlers, therefore it is always
+// in sync with the server. Routes are described by routeDocs, routes without
+// description are still present in the specification with their path
+// parameters.
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	oreConfig "github.com/OreCast/common/config"
+	"github.com/gin-gonic/gin"
+)
+
+// RouteDoc describes end-point in OpenAPI specification
+type RouteDoc struct {
+	Summary   string // short description of the end-point
+	Query     any    // struct with form tags describing query parameters
+	Form      any    // struct with form tags describing request form
+	Multipart bool   // request form is multipart/form-data
+	JSONBody  bool   // request form is also accepted as JSON body with json tags
+	Binary    bool   // request body is raw content of the object part
+	Data      any    // data of JSON response, see APIResponse
+	JSON      bool   // end-point always responds with JSON
+}
+
+// ObjectQuery represents query parameters of storage object end-point
+type ObjectQuery struct {
+	Preview bool  `form:"preview"` // provide preview of object content
+	Presign bool  `form:"presign"` // provide presigned url of the object
+	Expires int64 `form:"expires"` // lifetime of presigned url in seconds
+	Inline  bool  `form:"inline"`  // show object inline instead of download, only images and plain text are shown inline
+}
+
+// BucketQuery represents query parameters of pages which operate on site bucket
+type BucketQuery struct {
+	Bucket string `form:"bucket"`
+	Prefix string `form:"prefix"`
+}
+
+// MetaQuery represents query parameters of meta-data record forms
+type MetaQuery struct {
+	MetaId  string `form:"mid"`
+	Bucket  string `form:"bucket"`
+	Project string `form:"project"`
+}
+
+// UploadForm represents upload form of S3 objects
+type UploadForm struct {
+	Site   string `form:"site" binding:"required"`
+	Bucket string `form:"bucket" binding:"required"`
+	Object string `form:"object"`
+	File   []byte `form:"file" binding:"required"`
+}
+
+// RecordQuery represents query parameters of meta-data record page
+type RecordQuery struct {
+	Tab  string `form:"tab"`  // history tab provides revisions of the record
+	From int    `form:"from"` // revision compared by history diff
+	To   int    `form:"to"`   // revision compared with
+}
+
+// DatasetQuery represents query parameters of dataset registration form
+type DatasetQuery struct {
+	Site   string `form:"site"`   // site whose meta-data records are offered
+	Parent string `form:"parent"` // preset parent dataset
+}
+
+// ExportQuery represents query parameters of meta-data export
+type ExportQuery struct {
+	Format string `form:"format"` // csv (default), jsonl or yaml
+}
+
+// ImportForm represents meta-data import form, columns of imported file are
+// mapped to record fields by map[<column>] fields
+type ImportForm struct {
+	Site    string `form:"site"`
+	File    []byte `form:"file"`
+	Format  string `form:"format"`  // csv, jsonl or yaml, defaults to file extension
+	Data    string `form:"data"`    // content of imported file instead of file
+	Confirm bool   `form:"confirm"` // apply import, otherwise dry-run is provided
+}
+
+// routeDocs describes frontend end-points, the key is route method and its
+// path, JSON API mirrors of the pages share descriptions of their pages
+var routeDocs = map[string]RouteDoc{
+	"GET /":                   {Summary: "OreCast home page"},
+	"GET /docs":               {Summary: "OreCast documentation"},
+	"GET /docs/:page":         {Summary: "OreCast documentation page, /docs/api provides API explorer"},
+	"GET /login":              {Summary: "login form"},
+	"POST /login":             {Summary: "login user and create user session", Form: LoginForm{}},
+	"GET /logout":             {Summary: "logout user and destroy user session"},
+	"GET /user/registration":  {Summary: "user registration form"},
+	"POST /user/registration": {Summary: "register new user", Form: UserRegistrationForm{}},
+	"GET /captcha/:file":      {Summary: "captcha image of user registration form"},
+	"GET /openapi.json":       {Summary: "OpenAPI specification of OreCast frontend", JSON: true},
+	"GET /debug/vars":         {Summary: "server metrics including service cache statistics", JSON: true},
+
+	"GET /datasets":                 {Summary: "search datasets by query language, e.g. q=site=Cornell dataset=/drill/* created>2024-01-01", Query: DatasetSearchParams{}, Data: DatasetSearchResult{}},
+	"POST /datasets/queries":        {Summary: "save dataset query of the user under given name", Form: SavedQuery{}, Data: SavedQuery{}},
+	"POST /datasets/queries/delete": {Summary: "delete saved dataset query of the user", Form: SavedQueryForm{}, Data: []SavedQuery{}},
+	"GET /dataset/*dataset":         {Summary: "dataset details with its meta-data record, bucket objects and lineage, orphaned datasets are flagged", Data: DatasetDetails{}},
+	"GET /meta":                     {Summary: "faceted search of meta-data records across all sites", Query: MetaSearchParams{}, Data: MetaSearchResult{}},
+	"GET /meta/record/:mid/:site":   {Summary: "provide meta-data record, with tab=history it provides MetaHistory of the record", Query: RecordQuery{}, Data: MetaData{}},
+	"GET /meta/:site":               {Summary: "list meta-data records of the site", Data: SiteMetaRecords{}},
+	"GET /meta/:site/upload":        {Summary: "meta-data record form, with mid it edits existing record and project defines its attributes", Query: MetaQuery{}},
+	"GET /meta/:site/import":        {Summary: "meta-data import form"},
+	"GET /meta/:site/export":        {Summary: "stream all meta-data records of the site as file", Query: ExportQuery{}},
+	"POST /meta/:site/import":       {Summary: "import meta-data records, without confirm it provides column mapping and dry-run diff", Form: ImportForm{}, Multipart: true, Data: ImportReport{}},
+	"GET /meta/:site/delete":        {Summary: "meta-data record delete confirmation form", Query: MetaQuery{}},
+	"GET /sites":                    {Summary: "list all sites", Data: []SiteRecord{}},
+	"GET /site/:site":               {Summary: "provide site info", Data: []SiteRecord{}},
+	"GET /site/registration":        {Summary: "site registration form"},
+	"GET /site/:site/edit":          {Summary: "site edit form, site credentials are never provided", Data: SiteForm{}},
+	"GET /site/:site/credentials":   {Summary: "form to rotate S3 credentials of the site"},
+	"GET /site/:site/delete":        {Summary: "site delete confirmation form with buckets and datasets which become orphaned", Data: SiteImpact{}},
+	"GET /data/registration":        {Summary: "dataset registration form, JSON clients get choices of the form", Query: DatasetQuery{}, Data: DatasetOptions{}},
+	"GET /data/:site/upload":        {Summary: "data upload form"},
+	"GET /data/:site/delete":        {Summary: "bulk delete form of bucket objects", Query: BucketQuery{}},
+	"GET /storage/:site":            {Summary: "list buckets of the site", Data: SiteBuckets{}},
+	"GET /storage/:site/:bucket":    {Summary: "list objects of the bucket, the listing is paginated", Query: ListingParams{}, Data: BucketListing{}},
+	"GET /storage/:site/create":     {Summary: "bucket creation form"},
+	"GET /storage/:site/upload":     {Summary: "object upload form"},
+	"GET /storage/:site/delete":     {Summary: "bucket delete form"},
+	"GET /analytics":                {Summary: "analytics page"},
+	"GET /discovery":                {Summary: "discovery page"},
+	"GET /provenance":               {Summary: "lineage graph of datasets, format=dot or format=prov exports it as GraphViz DOT or W3C PROV-JSON file", Query: ProvenanceParams{}, Data: Lineage{}},
+	"GET /project":                  {Summary: "projects page"},
+	"GET /project/:page":            {Summary: "project page"},
+	"GET /project/schemas":          {Summary: "list JSON Schemas of projects", Data: []ProjectSchema{}},
+	"GET /project/schema/:project":  {Summary: "JSON Schema of the project and preview of its meta-data form", Data: ProjectSchema{}},
+	"POST /project/registration":    {Summary: "register new project", Form: ProjectRegistrationForm{}},
+	"POST /project/schema":          {Summary: "create or update JSON Schema of the project", Form: ProjectSchemaForm{}, Data: ProjectSchema{}},
+	"POST /site/registration":       {Summary: "register new site", Form: Site{}},
+	"POST /site/edit":               {Summary: "update site record, changed endpoint should be accessible with current site credentials", Form: SiteForm{}, Data: SiteForm{}},
+	"POST /site/credentials":        {Summary: "rotate S3 credentials of the site, they are stored only after storage is accessed with them", Form: SiteCredentialsForm{}},
+	"POST /site/delete":             {Summary: "deregister site, confirm should match site name, provides buckets and datasets which become orphaned", Form: SiteDeleteForm{}, Data: SiteImpact{}},
+	"POST /data/registration":       {Summary: "register new dataset in DataBookkeeping service, dataset follows /project/campaign/tier convention", Form: DatasetForm{}, JSONBody: true, Data: DBSRecord{}},
+	"POST /storage/create":          {Summary: "create new bucket", Form: CreateBucketForm{}},
+	"POST /storage/upload":          {Summary: "upload object to the bucket", Form: UploadForm{}, Multipart: true},
+	"POST /storage/delete":          {Summary: "delete bucket", Form: CreateBucketForm{}},
+	"POST /meta/upload":             {Summary: "create or update meta-data record, attributes of project schema are submitted as attr.<name> fields", Form: MetaForm{}, Data: MetaData{}},
+	"POST /meta/revert":             {Summary: "revert meta-data record to its revision", Form: MetaRevertForm{}, Data: MetaData{}},
+	"POST /meta/delete":             {Summary: "delete meta-data record, without confirm it asks for confirmation", Form: MetaDeleteForm{}},
+	"POST /data/upload":             {Summary: "upload data"},
+	"POST /data/delete":             {Summary: "delete bucket objects, without confirm it provides dry-run preview", Form: BulkForm{}},
+	"POST /data/copy":               {Summary: "copy or move bucket objects, without confirm it provides dry-run preview", Form: BulkForm{}},
+	"GET /storage/:site/:bucket/*object": {
+		Summary: "download object, provide its preview or presigned url; JSON clients get object attributes",
+		Query:   ObjectQuery{},
+		Data:    ObjectRecord{},
+	},
+	"POST /storage/:site/upload/resumable":              {Summary: "start resumable upload", Form: ResumableForm{}, JSON: true},
+	"GET /storage/:site/upload/resumable/:id":           {Summary: "status of resumable upload", JSON: true},
+	"PUT /storage/:site/upload/resumable/:id/:part":     {Summary: "upload part of resumable upload", Binary: true, JSON: true},
+	"POST /storage/:site/upload/resumable/:id/complete": {Summary: "complete resumable upload", JSON: true},
+	"DELETE /storage/:site/upload/resumable/:id":        {Summary: "abort resumable upload", JSON: true},
+}
+
+// OpenAPI represents OpenAPI 3 document
+type OpenAPI struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       map[string]string               `json:"info"`
+	Servers    []map[string]string             `json:"servers"`
+	Tags       []map[string]string             `json:"tags"`
+	Paths      map[string]map[string]Operation `json:"paths"`
+	Components map[string]any                  `json:"components"`
+}
+
+// Operation represents operation of OpenAPI path
+type Operation struct {
+	Summary     string                `json:"summary"`
+	OperationID string                `json:"operationId"`
+	Tags        []string              `json:"tags"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody map[string]any        `json:"requestBody,omitempty"`
+	Responses   map[string]any        `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Permission  string                `json:"x-permission,omitempty"`
+}
+
+// Parameter represents path or query parameter of OpenAPI operation
+type Parameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required"`
+	Schema   map[string]any `json:"schema"`
+}
+
+// schemaBuilder builds JSON schemas of Go types and keeps schemas of named
+// structs as OpenAPI components
+type schemaBuilder struct {
+	schemas map[string]any
+}
+
+// helper function to get JSON schema of given type, tag defines which struct
+// tag provides names of the fields (json or form)
+func (b *schemaBuilder) schema(t reflect.Type, tag string) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return map[string]any{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(json.RawMessage{}):
+		return map[string]any{}
+	case reflect.TypeOf(template.HTML("")), reflect.TypeOf(template.URL("")):
+		return map[string]any{"type": "string"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "binary"}
+		}
+		return map[string]any{"type": "array", "items": b.schema(t.Elem(), tag)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schema(t.Elem(), tag)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t, tag)
+		}
+		// form and JSON representations of the same struct differ
+		name := t.Name()
+		if tag != "json" && !strings.HasSuffix(name, "Form") {
+			name += "Form"
+		}
+		if _, ok := b.schemas[name]; !ok {
+			b.schemas[name] = map[string]any{} // placeholder for recursive types
+			b.schemas[name] = b.object(t, tag)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]any{}
+}
+
+// helper function to get JSON schema of struct fields
+func (b *schemaBuilder) object(t reflect.Type, tag string) map[string]any {
+	properties := make(map[string]any)
+	var required []string
+	b.fields(t, tag, properties, &required)
+	obj := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		obj["required"] = required
+	}
+	return obj
+}
+
+// helper function to collect struct fields, fields of embedded structs are
+// promoted to the parent struct as encoding/json does
+func (b *schemaBuilder) fields(t reflect.Type, tag string, properties map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			b.fields(field.Type, tag, properties, required)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = b.schema(field.Type, tag)
+		if strings.Contains(field.Tag.Get("binding"), "required") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// helper function to get parameters described by struct form tags
+func (b *schemaBuilder) parameters(val any, in string) []Parameter {
+	var params []Parameter
+	t := reflect.TypeOf(val)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("form"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		params = append(params, Parameter{
+			Name:     name,
+			In:       in,
+			Required: strings.Contains(field.Tag.Get("binding"), "required"),
+			Schema:   b.schema(field.Type, "form"),
+		})
+	}
+	return params
+}
+
+// helper function to convert gin route path into OpenAPI path and its parameters
+func openAPIPath(route string) (string, []Parameter) {
+	var params []Parameter
+	parts := strings.Split(route, "/")
+	for idx, part := range parts {
+		if strings.HasPrefix(part, ":") || strings.HasPrefix(part, "*") {
+			name := part[1:]
+			parts[idx] = "{" + name + "}"
+			params = append(params, Parameter{
+				Name:     name,
+				In:       "path",
+				Required: true,
+				Schema:   map[string]any{"type": "string"},
+			})
+		}
+	}
+	return strings.Join(parts, "/"), params
+}
+
+// helper function to get OpenAPI tag of the route from its first path segment
+func routeTag(route string) string {
+	route = strings.TrimPrefix(route, apiPrefix)
+	tag, _, _ := strings.Cut(strings.TrimPrefix(route, "/"), "/")
+	switch tag {
+	case "":
+		return "home"
+	case "site":
+		return "sites"
+	case "dataset":
+		return "datasets"
+	case "login", "logout", "user", "captcha":
+		return "user"
+	case "openapi.json", "debug":
+		return "server"
+	}
+	return tag
+}
+
+// helper function to build JSON response envelope schema with given data
+func (b *schemaBuilder) envelope(data any) map[string]any {
+	schema := b.schema(reflect.TypeOf(APIResponse{}), "json")
+	if data == nil {
+		return schema
+	}
+	return map[string]any{
+		"allOf": []any{
+			schema,
+			map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"data": b.schema(reflect.TypeOf(data), "json")},
+			},
+		},
+	}
+}
+
+// helper function to make OpenAPI operation of given route
+func (b *schemaBuilder) operation(route gin.RouteInfo, permissions map[string]string) Operation {
+	path := strings.TrimPrefix(route.Path, apiPrefix)
+	api := path != route.Path
+	key := fmt.Sprintf("%s %s", route.Method, path)
+	doc, ok := routeDocs[key]
+	if !ok {
+		// fallback to handler name, e.g. github.com/OreCast/Frontend.SitesHandler
+		doc.Summary = route.Handler[strings.LastIndex(route.Handler, ".")+1:]
+	}
+	_, params := openAPIPath(route.Path)
+	op := Operation{
+		Summary:     doc.Summary,
+		OperationID: strings.ToLower(route.Method) + strings.NewReplacer("/", "_", ":", "", "*", "", ".", "_").Replace(route.Path),
+		Tags:        []string{routeTag(route.Path)},
+		Parameters:  params,
+		Responses:   make(map[string]any),
+	}
+	if doc.Query != nil {
+		op.Parameters = append(op.Parameters, b.parameters(doc.Query, "query")...)
+	}
+	switch {
+	case doc.Form != nil:
+		ctype := "application/x-www-form-urlencoded"
+		if doc.Multipart {
+			ctype = "multipart/form-data"
+		}
+		body := map[string]any{ctype: map[string]any{"schema": b.schema(reflect.TypeOf(doc.Form), "form")}}
+		if doc.JSONBody {
+			body["application/json"] = map[string]any{"schema": b.schema(reflect.TypeOf(doc.Form), "json")}
+		}
+		op.RequestBody = map[string]any{
+			"required": true,
+			"content":  body,
+		}
+	case doc.Binary:
+		op.RequestBody = map[string]any{
+			"required": true,
+			"content": map[string]any{"application/octet-stream": map[string]any{
+				"schema": map[string]any{"type": "string", "format": "binary"},
+			}},
+		}
+	}
+
+	// responses: JSON API mirrors respond only with JSON while pages provide
+	// JSON representation of their data when it is requested via Accept header
+	content := make(map[string]any)
+	if !api && !doc.JSON {
+		content["text/html"] = map[string]any{"schema": map[string]any{"type": "string"}}
+	}
+	if api || doc.Data != nil {
+		content["application/json"] = map[string]any{"schema": b.envelope(doc.Data)}
+	} else if doc.JSON {
+		content["application/json"] = map[string]any{"schema": map[string]any{"type": "object"}}
+	}
+	op.Responses["200"] = map[string]any{"description": "successful response", "content": content}
+	if perm, ok := permissions[key]; ok {
+		op.Permission = perm
+		op.Security = []map[string][]string{{"cookieAuth": {}}}
+		op.Responses["401"] = map[string]any{"description": "user is not logged in, pages redirect to login form"}
+		op.Responses["403"] = map[string]any{"description": fmt.Sprintf("user does not have %s permission", perm)}
+	}
+	op.Responses["default"] = map[string]any{
+		"description": "error, JSON clients get error envelope",
+		"content":     map[string]any{"application/json": map[string]any{"schema": b.envelope(nil)}},
+	}
+	return op
+}
+
+// helper function to build OpenAPI specification of given routes
+func openAPISpec(routes gin.RoutesInfo) OpenAPI {
+	permissions := make(map[string]string)
+	for _, route := range authorizedRoutes() {
+		permissions[fmt.Sprintf("%s %s", route.Method, route.Path)] = route.Permission
+	}
+	b := &schemaBuilder{schemas: make(map[string]any)}
+	base := oreConfig.Config.Frontend.WebServer.Base
+	if base == "" {
+		base = "/"
+	}
+	spec := OpenAPI{
+		OpenAPI: "3.0.3",
+		Info: map[string]string{
+			"title":       "OreCast Frontend API",
+			"description": "OreCast web pages and their JSON representation, see /docs/api",
+			"version":     "v1",
+		},
+		Servers: []map[string]string{{"url": base}},
+		Paths:   make(map[string]map[string]Operation),
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path == routes[j].Path {
+			return routes[i].Method < routes[j].Method
+		}
+		return routes[i].Path < routes[j].Path
+	})
+	tags := make(map[string]bool)
+	for _, route := range routes {
+		// static files are not part of the API
+		if route.Method == "HEAD" || strings.HasSuffix(route.Path, "/*filepath") {
+			continue
+		}
+		path, _ := openAPIPath(route.Path)
+		if _, ok := spec.Paths[path]; !ok {
+			spec.Paths[path] = make(map[string]Operation)
+		}
+		op := b.operation(route, permissions)
+		spec.Paths[path][strings.ToLower(route.Method)] = op
+		tags[op.Tags[0]] = true
+	}
+	var names []string
+	for tag := range tags {
+		names = append(names, tag)
+	}
+	sort.Strings(names)
+	for _, tag := range names {
+		spec.Tags = append(spec.Tags, map[string]string{"name": tag})
+	}
+	spec.Components = map[string]any{
+		"schemas": b.schemas,
+		"securitySchemes": map[string]any{
+			"cookieAuth": map[string]string{"type": "apiKey", "in": "cookie", "name": sessionCookie},
+		},
+	}
+	return spec
+}
+
+// OpenAPIHandler provides access to GET /openapi.json end-point
+func OpenAPIHandler(r *gin.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, openAPISpec(r.Routes()))
+	}
+}
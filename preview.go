@@ -0,0 +1,296 @@
+package main
+
+// object preview module
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+// The preview is made from first bytes of the object which are obtained via
+// ranged S3 read, therefore objects are never downloaded in full (except
+// images which are read up to PreviewImageSize to make their thumbnails).
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	mhtml "github.com/gomarkdown/markdown/html"
+)
+
+// preview limits
+const (
+	previewMaxRows   = 100              // maximum number of table rows shown in preview
+	previewThumbnail = 320              // maximum width or height of image thumbnails
+	previewMaxPixels = 50 * 1000 * 1000 // maximum number of pixels of decoded images
+)
+
+// Preview represents object preview on web UI
+type Preview struct {
+	Kind      string        `json:"kind"`              // preview kind: table, json, markdown, image, las, text or none
+	Header    []string      `json:"header,omitempty"`  // table header
+	Rows      [][]string    `json:"rows,omitempty"`    // table rows
+	Text      string        `json:"text,omitempty"`    // text content
+	HTML      template.HTML `json:"html,omitempty"`    // rendered markdown content
+	Image     template.URL  `json:"image,omitempty"`   // thumbnail data url
+	LAS       *LASHeader    `json:"las,omitempty"`     // LAS well-log header
+	Truncated bool          `json:"truncated"`         // preview is made from part of the object
+	Message   string        `json:"message,omitempty"` // explanation why preview is not available
+}
+
+// LASEntry represents single line of LAS header section, e.g.
+// STRT.M        1670.0000 : START DEPTH
+type LASEntry struct {
+	Mnemonic    string `json:"mnemonic"`
+	Unit        string `json:"unit"`
+	Value       string `json:"value"`
+	Description string `json:"description"`
+}
+
+// LASHeader represents header and curves of LAS well-log file
+type LASHeader struct {
+	Version    []LASEntry `json:"version"`
+	Well       []LASEntry `json:"well"`
+	Curves     []LASEntry `json:"curves"`
+	Parameters []LASEntry `json:"parameters"`
+	Rows       [][]string `json:"rows"`
+}
+
+// helper function to determine preview kind of the object
+func previewKind(name, contentType string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv", ".tsv":
+		return "table"
+	case ".json", ".geojson":
+		return "json"
+	case ".md", ".markdown":
+		return "markdown"
+	case ".png", ".jpg", ".jpeg", ".gif":
+		return "image"
+	case ".las":
+		return "las"
+	}
+	if strings.HasPrefix(contentType, "image/") {
+		return "image"
+	}
+	return "text"
+}
+
+// helper function to build preview of the object from its first bytes
+func makePreview(name, contentType string, data []byte, truncated bool) Preview {
+	preview := Preview{Kind: previewKind(name, contentType), Truncated: truncated}
+	if preview.Kind != "image" && !utf8.Valid(trimPartialRune(data)) {
+		preview.Kind = "none"
+		preview.Message = "binary content can not be previewed, please download the object"
+		return preview
+	}
+	var err error
+	switch preview.Kind {
+	case "table":
+		comma := ','
+		if strings.ToLower(filepath.Ext(name)) == ".tsv" {
+			comma = '\t'
+		}
+		preview.Header, preview.Rows, err = previewTable(data, comma, truncated)
+	case "json":
+		var out bytes.Buffer
+		if err = json.Indent(&out, data, "", "  "); err == nil {
+			preview.Text = out.String()
+		} else if truncated {
+			// truncated JSON can not be parsed, show it as is
+			preview.Kind = "text"
+			preview.Text = string(trimPartialRune(data))
+			err = nil
+		}
+	case "markdown":
+		// user content may contain arbitrary HTML, therefore we skip it
+		flags := mhtml.CommonFlags | mhtml.SkipHTML | mhtml.Safelink
+		preview.HTML = template.HTML(renderMarkdown(data, flags))
+	case "image":
+		if truncated {
+			preview.Kind = "none"
+			preview.Message = "image is too large for preview, please download the object"
+			return preview
+		}
+		preview.Image, err = thumbnail(data)
+	case "las":
+		var las LASHeader
+		las, err = previewLAS(data, truncated)
+		preview.LAS = &las
+	default:
+		preview.Text = string(trimPartialRune(data))
+	}
+	if err != nil {
+		preview.Kind = "none"
+		preview.Message = fmt.Sprintf("unable to preview the object: %v", err)
+	}
+	return preview
+}
+
+// helper function to trim partial UTF-8 character at the end of truncated data
+func trimPartialRune(data []byte) []byte {
+	for i := 0; i < utf8.UTFMax && len(data) > 0; i++ {
+		r, size := utf8.DecodeLastRune(data)
+		if r != utf8.RuneError || size != 1 {
+			break
+		}
+		data = data[:len(data)-1]
+	}
+	return data
+}
+
+// helper function to drop last (possibly incomplete) line of truncated data
+func completeLines(data []byte, truncated bool) []byte {
+	if !truncated {
+		return data
+	}
+	if idx := bytes.LastIndexByte(data, '\n'); idx >= 0 {
+		return data[:idx+1]
+	}
+	return data
+}
+
+// helper function to parse CSV/TSV data into table header and rows
+func previewTable(data []byte, comma rune, truncated bool) ([]string, [][]string, error) {
+	reader := csv.NewReader(bytes.NewReader(completeLines(data, truncated)))
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.Comment = '#'
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+	var rows [][]string
+	for len(rows) < previewMaxRows {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return header, rows, err
+		}
+		rows = append(rows, row)
+	}
+	return header, rows, nil
+}
+
+// helper function to parse LAS header line, see LAS 2.0 specification
+func parseLASEntry(line string) LASEntry {
+	var entry LASEntry
+	if idx := strings.LastIndex(line, ":"); idx >= 0 {
+		entry.Description = strings.TrimSpace(line[idx+1:])
+		line = line[:idx]
+	}
+	idx := strings.Index(line, ".")
+	if idx < 0 {
+		entry.Mnemonic = strings.TrimSpace(line)
+		return entry
+	}
+	entry.Mnemonic = strings.TrimSpace(line[:idx])
+	line = line[idx+1:]
+	if idx := strings.IndexAny(line, " \t"); idx >= 0 {
+		entry.Unit = line[:idx]
+		entry.Value = strings.TrimSpace(line[idx:])
+	} else {
+		entry.Unit = line
+	}
+	return entry
+}
+
+// helper function to parse header sections, curves and first data rows of LAS file
+func previewLAS(data []byte, truncated bool) (LASHeader, error) {
+	var las LASHeader
+	var section byte
+	scanner := bufio.NewScanner(bytes.NewReader(completeLines(data, truncated)))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "~") {
+			if len(line) > 1 {
+				section = strings.ToUpper(line[1:2])[0]
+			}
+			continue
+		}
+		switch section {
+		case 'V':
+			las.Version = append(las.Version, parseLASEntry(line))
+		case 'W':
+			las.Well = append(las.Well, parseLASEntry(line))
+		case 'C':
+			las.Curves = append(las.Curves, parseLASEntry(line))
+		case 'P':
+			las.Parameters = append(las.Parameters, parseLASEntry(line))
+		case 'A':
+			if len(las.Rows) < previewMaxRows {
+				las.Rows = append(las.Rows, strings.Fields(line))
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return las, err
+	}
+	if len(las.Version) == 0 && len(las.Curves) == 0 {
+		return las, fmt.Errorf("no LAS header sections found")
+	}
+	return las, nil
+}
+
+// helper function to make PNG thumbnail of the image, it is encoded as data url
+func thumbnail(data []byte) (template.URL, error) {
+	// small compressed image may declare huge dimensions, we check them
+	// before the image is decoded to avoid allocation of its pixels
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return "", fmt.Errorf("empty image")
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > previewMaxPixels {
+		return "", fmt.Errorf("image of %dx%d pixels is too large for preview", cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return "", fmt.Errorf("empty image")
+	}
+	scale := 1.0
+	if width > previewThumbnail || height > previewThumbnail {
+		scale = float64(previewThumbnail) / float64(max(width, height))
+	}
+	twidth := max(1, int(float64(width)*scale))
+	theight := max(1, int(float64(height)*scale))
+	thumb := image.NewRGBA(image.Rect(0, 0, twidth, theight))
+	// nearest neighbour scaling is good enough for thumbnails
+	for y := 0; y < theight; y++ {
+		for x := 0; x < twidth; x++ {
+			sx := bounds.Min.X + int(float64(x)/scale)
+			sy := bounds.Min.Y + int(float64(y)/scale)
+			thumb.Set(x, y, color.RGBAModel.Convert(img.At(sx, sy)))
+		}
+	}
+	var out bytes.Buffer
+	if err := png.Encode(&out, thumb); err != nil {
+		return "", err
+	}
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(out.Bytes())), nil
+}
@@ -0,0 +1,256 @@
+package main
+
+// object preview tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestPreviewTable tests parsing of CSV and TSV previews
+func TestPreviewTable(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		comma     rune
+		truncated bool
+		header    []string
+		rows      [][]string
+		wantErr   bool
+	}{
+		{
+			name:   "csv",
+			data:   "# comment\nhole,depth\nDH-1,1.5\nDH-2,\"2,5\"\n",
+			comma:  ',',
+			header: []string{"hole", "depth"},
+			rows:   [][]string{{"DH-1", "1.5"}, {"DH-2", "2,5"}},
+		},
+		{
+			name:   "tsv with ragged rows",
+			data:   "hole\tdepth\nDH-1\t1.5\textra\nDH-2\n",
+			comma:  '\t',
+			header: []string{"hole", "depth"},
+			rows:   [][]string{{"DH-1", "1.5", "extra"}, {"DH-2"}},
+		},
+		{
+			name:      "truncated drops partial line",
+			data:      "hole,depth\nDH-1,1.5\nDH-2,2.",
+			comma:     ',',
+			truncated: true,
+			header:    []string{"hole", "depth"},
+			rows:      [][]string{{"DH-1", "1.5"}},
+		},
+		{
+			name:   "lazy quotes",
+			data:   "name\na \"quoted\" value\n",
+			comma:  ',',
+			header: []string{"name"},
+			rows:   [][]string{{`a "quoted" value`}},
+		},
+		{
+			name:    "empty",
+			data:    "",
+			comma:   ',',
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, rows, err := previewTable([]byte(tt.data), tt.comma, tt.truncated)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(header, tt.header) {
+				t.Errorf("got header %q, want %q", header, tt.header)
+			}
+			if !reflect.DeepEqual(rows, tt.rows) {
+				t.Errorf("got rows %q, want %q", rows, tt.rows)
+			}
+		})
+	}
+
+	// number of rows is limited
+	var data strings.Builder
+	data.WriteString("n\n")
+	for i := 0; i < 2*previewMaxRows; i++ {
+		fmt.Fprintf(&data, "%d\n", i)
+	}
+	if _, rows, _ := previewTable([]byte(data.String()), ',', false); len(rows) != previewMaxRows {
+		t.Errorf("got %d rows, want %d", len(rows), previewMaxRows)
+	}
+}
+
+// lasExample provides header of LAS 2.0 file
+const lasExample = `~VERSION INFORMATION
+ VERS.                  2.0 :   CWLS LOG ASCII STANDARD -VERSION 2.0
+ WRAP.                   NO :   ONE LINE PER DEPTH STEP
+~WELL INFORMATION
+#MNEM.UNIT       DATA        DESCRIPTION
+ STRT.M        1670.0000 : START DEPTH
+ WELL.      DH-1 : WELL NAME
+ NULL.               -999.25 :
+~CURVE INFORMATION
+ DEPT.M                      :  1  DEPTH
+ GR  .GAPI                   :  2  GAMMA RAY
+~PARAMETER INFORMATION
+ BHT .DEGC   35.5000 : BOTTOM HOLE TEMPERATURE
+~A  DEPTH     GR
+1670.000   120.5
+1670.125   118.0
+`
+
+// TestPreviewLAS tests parsing of LAS well-log headers
+func TestPreviewLAS(t *testing.T) {
+	las, err := previewLAS([]byte(lasExample), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantWell := []LASEntry{
+		{Mnemonic: "STRT", Unit: "M", Value: "1670.0000", Description: "START DEPTH"},
+		{Mnemonic: "WELL", Unit: "", Value: "DH-1", Description: "WELL NAME"},
+		{Mnemonic: "NULL", Unit: "", Value: "-999.25", Description: ""},
+	}
+	if !reflect.DeepEqual(las.Well, wantWell) {
+		t.Errorf("got well section %+v, want %+v", las.Well, wantWell)
+	}
+	wantCurves := []LASEntry{
+		{Mnemonic: "DEPT", Unit: "M", Description: "1  DEPTH"},
+		{Mnemonic: "GR", Unit: "GAPI", Description: "2  GAMMA RAY"},
+	}
+	if !reflect.DeepEqual(las.Curves, wantCurves) {
+		t.Errorf("got curves %+v, want %+v", las.Curves, wantCurves)
+	}
+	if len(las.Version) != 2 || las.Version[0].Value != "2.0" {
+		t.Errorf("unexpected version section %+v", las.Version)
+	}
+	if len(las.Parameters) != 1 || las.Parameters[0].Value != "35.5000" {
+		t.Errorf("unexpected parameters section %+v", las.Parameters)
+	}
+	wantRows := [][]string{{"1670.000", "120.5"}, {"1670.125", "118.0"}}
+	if !reflect.DeepEqual(las.Rows, wantRows) {
+		t.Errorf("got rows %q, want %q", las.Rows, wantRows)
+	}
+
+	// truncated file keeps complete lines only
+	data := lasExample[:strings.LastIndex(lasExample, "118.0")+3]
+	las, err = previewLAS([]byte(data), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(las.Rows) != 1 {
+		t.Errorf("got rows %q of truncated file", las.Rows)
+	}
+
+	if _, err := previewLAS([]byte("depth,gr\n1,2\n"), false); err == nil {
+		t.Error("file without LAS sections is accepted")
+	}
+}
+
+// helper function to encode PNG image of given size
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// helper function to change dimensions declared by PNG header, the image
+// data is kept intact
+func patchPNGSize(data []byte, width, height uint32) []byte {
+	out := append([]byte{}, data...)
+	// PNG signature (8 bytes) is followed by IHDR length, type and data
+	ihdr := out[8+8 : 8+8+13]
+	binary.BigEndian.PutUint32(ihdr[0:4], width)
+	binary.BigEndian.PutUint32(ihdr[4:8], height)
+	crc := crc32.ChecksumIEEE(out[8+4 : 8+8+13])
+	binary.BigEndian.PutUint32(out[8+8+13:], crc)
+	return out
+}
+
+// helper function to read base64 encoded data
+func base64Reader(data string) io.Reader {
+	return base64.NewDecoder(base64.StdEncoding, strings.NewReader(data))
+}
+
+// TestThumbnail tests thumbnails of images
+func TestThumbnail(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		width  int
+		height int
+		err    string
+	}{
+		{"small", testPNG(t, 10, 20), 10, 20, ""},
+		{"scaled", testPNG(t, 640, 160), 320, 80, ""},
+		{"huge dimensions", patchPNGSize(testPNG(t, 1, 1), 100000, 100000), 0, 0, "too large for preview"},
+		{"not an image", []byte("plain text"), 0, 0, "unknown format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url, err := thumbnail(tt.data)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			prefix := "data:image/png;base64,"
+			if !strings.HasPrefix(string(url), prefix) {
+				t.Fatalf("unexpected thumbnail url %.40s", url)
+			}
+			cfg, err := png.DecodeConfig(base64Reader(strings.TrimPrefix(string(url), prefix)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Width != tt.width || cfg.Height != tt.height {
+				t.Errorf("got thumbnail %dx%d, want %dx%d", cfg.Width, cfg.Height, tt.width, tt.height)
+			}
+		})
+	}
+}
+
+// TestMakePreview tests preview kinds of objects
+func TestMakePreview(t *testing.T) {
+	tests := []struct {
+		name      string
+		ctype     string
+		data      []byte
+		truncated bool
+		kind      string
+	}{
+		{"data.csv", "", []byte("a,b\n1,2\n"), false, "table"},
+		{"data.json", "", []byte(`{"a":1}`), false, "json"},
+		{"data.json", "", []byte(`{"a":`), true, "text"},
+		{"data.json", "", []byte(`{"a":`), false, "none"},
+		{"README.md", "", []byte("# title"), false, "markdown"},
+		{"well.las", "", []byte(lasExample), false, "las"},
+		{"photo", "image/png", testPNG(t, 4, 4), false, "image"},
+		{"photo.png", "", testPNG(t, 4, 4), true, "none"},
+		{"notes.txt", "", []byte("caf\xc3"), true, "text"},
+		{"blob.bin", "", []byte{0xff, 0xfe, 0x00, 0x81}, false, "none"},
+	}
+	for _, tt := range tests {
+		p := makePreview(tt.name, tt.ctype, tt.data, tt.truncated)
+		if p.Kind != tt.kind {
+			t.Errorf("%s: got preview kind %s, want %s (%s)", tt.name, p.Kind, tt.kind, p.Message)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package main
+
+// provenance module
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+// Lineage of datasets is defined by parent links of DataBookkeeping records,
+// every derived dataset points to dataset it was produced from by its
+// processing step. The lineage graph is directed acyclic graph from parent
+// to child datasets; it is rendered as layered SVG graph on provenance page
+// and it is exported as GraphViz DOT or W3C PROV-JSON documents. Parents
+// which are not registered in DataBookkeeping are kept as missing nodes.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// lineage graph layout in pixels
+const (
+	lineageNodeWidth  = 240
+	lineageNodeHeight = 64
+	lineageColumnGap  = 80
+	lineageRowGap     = 24
+)
+
+// LineageNode represents dataset in lineage graph
+type LineageNode struct {
+	Dataset              string   `json:"dataset"`
+	Site                 string   `json:"site"`
+	Processing           string   `json:"processing"`
+	MetaId               string   `json:"meta_id"`
+	CreateBy             string   `json:"create_by"`
+	CreationDate         int64    `json:"creation_date"`
+	LastModifiedBy       string   `json:"last_modified_by"`
+	LastModificationDate int64    `json:"last_modification_date"`
+	Parent               string   `json:"parent,omitempty"`
+	Children             []string `json:"children,omitempty"`
+	Missing              bool     `json:"missing,omitempty"` // parent which is not registered in DataBookkeeping
+	Layer                int      `json:"layer"`             // distance from the root of the lineage
+	X                    int      `json:"-"`                 // position of the node on the graph
+	Y                    int      `json:"-"`
+}
+
+// Created returns creation time of the dataset in human readable form
+func (n LineageNode) Created() string {
+	return lineageTime(n.CreationDate)
+}
+
+// Modified returns last modification time of the dataset in human readable form
+func (n LineageNode) Modified() string {
+	return lineageTime(n.LastModificationDate)
+}
+
+// helper function to format time of lineage node
+func lineageTime(ts int64) string {
+	if ts == 0 {
+		return ""
+	}
+	return time.Unix(ts, 0).UTC().Format("2006-01-02 15:04:05 UTC")
+}
+
+// LineageEdge represents derivation of child dataset from its parent
+type LineageEdge struct {
+	Parent string `json:"parent"`
+	Child  string `json:"child"`
+	Path   string `json:"-"` // SVG path of the edge
+}
+
+// Lineage represents lineage graph of datasets
+type Lineage struct {
+	Dataset string        `json:"dataset,omitempty"` // dataset whose lineage is provided, empty for all datasets
+	Nodes   []LineageNode `json:"nodes"`
+	Edges   []LineageEdge `json:"edges"`
+	Width   int           `json:"-"` // size of the graph
+	Height  int           `json:"-"`
+}
+
+// helper function to build lineage graph of DataBookkeeping records, with
+// given dataset the graph is limited to its ancestors and descendants
+func buildLineage(records []DBSRecord, dataset string) (Lineage, error) {
+	nodes := make(map[string]*LineageNode)
+	for _, r := range records {
+		if r.Dataset == "" {
+			continue
+		}
+		// dataset may have several records, e.g. one per file
+		if n, ok := nodes[r.Dataset]; ok {
+			if n.Parent == "" {
+				n.Parent = r.Parent
+			}
+			continue
+		}
+		nodes[r.Dataset] = &LineageNode{
+			Dataset:              r.Dataset,
+			Site:                 r.Site,
+			Processing:           r.Processing,
+			MetaId:               r.MetaId,
+			CreateBy:             r.CreateBy,
+			CreationDate:         r.CreationDate,
+			LastModifiedBy:       r.LastModifiedBy,
+			LastModificationDate: r.LastModificationdate,
+			Parent:               r.Parent,
+		}
+	}
+	var names []string
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		n := nodes[name]
+		if n.Parent == "" || n.Parent == n.Dataset {
+			n.Parent = ""
+			continue
+		}
+		p, ok := nodes[n.Parent]
+		if !ok {
+			p = &LineageNode{Dataset: n.Parent, Missing: true}
+			nodes[n.Parent] = p
+		}
+		p.Children = append(p.Children, n.Dataset)
+	}
+
+	// selected dataset limits the graph to its ancestors and descendants
+	keep := nodes
+	if dataset != "" {
+		if _, ok := nodes[dataset]; !ok {
+			return Lineage{Dataset: dataset}, fmt.Errorf("dataset %s is not found", dataset)
+		}
+		keep = make(map[string]*LineageNode)
+		for name := dataset; name != ""; name = nodes[name].Parent {
+			if _, ok := keep[name]; ok {
+				break // parent links form a cycle
+			}
+			keep[name] = nodes[name]
+		}
+		queue := []string{dataset}
+		for len(queue) > 0 {
+			n := nodes[queue[0]]
+			queue = queue[1:]
+			for _, child := range n.Children {
+				if _, ok := keep[child]; !ok {
+					keep[child] = nodes[child]
+					queue = append(queue, child)
+				}
+			}
+		}
+	}
+
+	graph := Lineage{Dataset: dataset}
+	for _, n := range keep {
+		if n.Parent != "" && keep[n.Parent] != nil {
+			graph.Edges = append(graph.Edges, LineageEdge{Parent: n.Parent, Child: n.Dataset})
+		}
+		var children []string
+		for _, child := range n.Children {
+			if keep[child] != nil {
+				children = append(children, child)
+			}
+		}
+		n.Children = children
+	}
+	layoutLineage(keep)
+	for _, n := range keep {
+		graph.Nodes = append(graph.Nodes, *n)
+		if x := n.X + lineageNodeWidth + lineageColumnGap/2; x > graph.Width {
+			graph.Width = x
+		}
+		if y := n.Y + lineageNodeHeight + lineageRowGap; y > graph.Height {
+			graph.Height = y
+		}
+	}
+	sort.Slice(graph.Nodes, func(i, j int) bool {
+		a, b := graph.Nodes[i], graph.Nodes[j]
+		if a.Layer != b.Layer {
+			return a.Layer < b.Layer
+		}
+		return a.Y < b.Y
+	})
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		a, b := graph.Edges[i], graph.Edges[j]
+		if a.Parent != b.Parent {
+			return a.Parent < b.Parent
+		}
+		return a.Child < b.Child
+	})
+	for i, e := range graph.Edges {
+		p, c := keep[e.Parent], keep[e.Child]
+		x1, y1 := p.X+lineageNodeWidth, p.Y+lineageNodeHeight/2
+		x2, y2 := c.X, c.Y+lineageNodeHeight/2
+		mid := (x1 + x2) / 2
+		graph.Edges[i].Path = fmt.Sprintf("M%d,%d C%d,%d %d,%d %d,%d", x1, y1, mid, y1, mid, y2, x2, y2)
+	}
+	return graph, nil
+}
+
+// helper function to place lineage nodes, nodes are placed in columns by
+// their distance from the root and ordered within columns by position of
+// their parents to avoid crossing of edges
+func layoutLineage(nodes map[string]*LineageNode) {
+	var names []string
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	layer := func(n *LineageNode) int {
+		depth := 0
+		seen := map[string]bool{n.Dataset: true}
+		for p := nodes[n.Parent]; p != nil && !seen[p.Dataset]; p = nodes[p.Parent] {
+			seen[p.Dataset] = true
+			depth++
+		}
+		return depth
+	}
+	var columns [][]*LineageNode
+	for _, name := range names {
+		n := nodes[name]
+		n.Layer = layer(n)
+		for len(columns) <= n.Layer {
+			columns = append(columns, nil)
+		}
+		columns[n.Layer] = append(columns[n.Layer], n)
+	}
+	for i, column := range columns {
+		if i > 0 {
+			sort.SliceStable(column, func(a, b int) bool {
+				return nodes[column[a].Parent].Y < nodes[column[b].Parent].Y
+			})
+		}
+		// nodes are kept at the level of their parents if there is room
+		y := lineageRowGap
+		for _, n := range column {
+			if p := nodes[n.Parent]; i > 0 && p.Y > y {
+				y = p.Y
+			}
+			n.X = lineageColumnGap/2 + i*(lineageNodeWidth+lineageColumnGap)
+			n.Y = y
+			y += lineageNodeHeight + lineageRowGap
+		}
+	}
+}
+
+// helper function to quote GraphViz DOT string
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// helper function to write lineage graph in GraphViz DOT format
+func lineageDOT(w io.Writer, graph Lineage) error {
+	var b strings.Builder
+	b.WriteString("digraph lineage {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box, style=rounded, fontname=\"Helvetica\"];\n")
+	for _, n := range graph.Nodes {
+		label := n.Dataset
+		attrs := ""
+		if n.Missing {
+			label += "\nnot registered"
+			attrs = ", style=\"rounded,dashed\""
+		} else {
+			label += fmt.Sprintf("\nprocessing: %s\nsite: %s", n.Processing, n.Site)
+			if created := n.Created(); created != "" {
+				label += "\ncreated: " + created
+			}
+		}
+		fmt.Fprintf(&b, "  %s [label=%s%s];\n", dotQuote(n.Dataset), dotQuote(label), attrs)
+	}
+	for _, e := range graph.Edges {
+		fmt.Fprintf(&b, "  %s -> %s;\n", dotQuote(e.Parent), dotQuote(e.Child))
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// provPrefix defines namespace of OreCast identifiers in PROV documents
+const provPrefix = "urn:orecast:"
+
+// helper function to format time of PROV document
+func provTime(ts int64) string {
+	return time.Unix(ts, 0).UTC().Format(time.RFC3339)
+}
+
+// helper function to build W3C PROV-JSON document of lineage graph, see
+// https://www.w3.org/Submission/prov-json/
+//
+// Datasets are entities, processing steps which produced derived datasets
+// are activities which used parent datasets and users who created datasets
+// are agents.
+func lineageProv(graph Lineage) map[string]any {
+	entityID := func(name string) string {
+		return "orecast:dataset" + name
+	}
+	activityID := func(name string) string {
+		return "orecast:processing" + name
+	}
+	agentID := func(user string) string {
+		return "orecast:user/" + user
+	}
+	entities := make(map[string]any)
+	activities := make(map[string]any)
+	agents := make(map[string]any)
+	generated := make(map[string]any)
+	used := make(map[string]any)
+	derived := make(map[string]any)
+	attributed := make(map[string]any)
+	associated := make(map[string]any)
+	for _, n := range graph.Nodes {
+		entity := map[string]any{
+			"prov:type":  "orecast:Dataset",
+			"prov:label": n.Dataset,
+		}
+		if n.Missing {
+			entity["orecast:registered"] = false
+			entities[entityID(n.Dataset)] = entity
+			continue
+		}
+		entity["orecast:site"] = n.Site
+		entity["orecast:meta_id"] = n.MetaId
+		entity["orecast:processing"] = n.Processing
+		entities[entityID(n.Dataset)] = entity
+
+		activity := map[string]any{
+			"prov:type":  "orecast:Processing",
+			"prov:label": n.Processing,
+		}
+		if n.CreationDate > 0 {
+			activity["prov:endTime"] = provTime(n.CreationDate)
+		}
+		activities[activityID(n.Dataset)] = activity
+		gen := map[string]any{
+			"prov:entity":   entityID(n.Dataset),
+			"prov:activity": activityID(n.Dataset),
+		}
+		if n.CreationDate > 0 {
+			gen["prov:time"] = provTime(n.CreationDate)
+		}
+		generated["_:gen"+n.Dataset] = gen
+		if n.Parent != "" {
+			used["_:use"+n.Dataset] = map[string]any{
+				"prov:activity": activityID(n.Dataset),
+				"prov:entity":   entityID(n.Parent),
+			}
+			derived["_:der"+n.Dataset] = map[string]any{
+				"prov:generatedEntity": entityID(n.Dataset),
+				"prov:usedEntity":      entityID(n.Parent),
+				"prov:activity":        activityID(n.Dataset),
+			}
+		}
+		if n.CreateBy != "" {
+			agents[agentID(n.CreateBy)] = map[string]any{
+				"prov:type":  "prov:Person",
+				"prov:label": n.CreateBy,
+			}
+			attributed["_:att"+n.Dataset] = map[string]any{
+				"prov:entity": entityID(n.Dataset),
+				"prov:agent":  agentID(n.CreateBy),
+			}
+			associated["_:assoc"+n.Dataset] = map[string]any{
+				"prov:activity": activityID(n.Dataset),
+				"prov:agent":    agentID(n.CreateBy),
+			}
+		}
+	}
+	doc := map[string]any{
+		"prefix": map[string]string{"orecast": provPrefix},
+		"entity": entities,
+	}
+	for key, val := range map[string]map[string]any{
+		"activity":          activities,
+		"agent":             agents,
+		"wasGeneratedBy":    generated,
+		"used":              used,
+		"wasDerivedFrom":    derived,
+		"wasAttributedTo":   attributed,
+		"wasAssociatedWith": associated,
+	} {
+		if len(val) > 0 {
+			doc[key] = val
+		}
+	}
+	return doc
+}
+
+// helper function to write lineage graph as W3C PROV-JSON document
+func lineagePROVJSON(w io.Writer, graph Lineage) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(lineageProv(graph))
+}
@@ -0,0 +1,156 @@
+package main
+
+// provenance tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// helper function to get edges of lineage graph as parent->child strings
+func lineageEdges(graph Lineage) []string {
+	var edges []string
+	for _, e := range graph.Edges {
+		edges = append(edges, e.Parent+"->"+e.Child)
+	}
+	return edges
+}
+
+// helper function to get layers of lineage graph nodes, missing nodes are marked by ?
+func lineageLayers(graph Lineage) map[string]int {
+	layers := make(map[string]int)
+	for _, n := range graph.Nodes {
+		name := n.Dataset
+		if n.Missing {
+			name += "?"
+		}
+		layers[name] = n.Layer
+	}
+	return layers
+}
+
+// TestBuildLineage tests lineage graphs of DataBookkeeping records
+func TestBuildLineage(t *testing.T) {
+	records := []DBSRecord{
+		{Dataset: "/raw", Site: "Cornell"},
+		{Dataset: "/calib", Parent: "/raw"},
+		{Dataset: "/calib", Parent: "/other"}, // another record of the same dataset
+		{Dataset: "/assay", Parent: "/raw"},
+		{Dataset: "/model", Parent: "/calib"},
+		{Dataset: "/derived", Parent: "/lost"},
+		{Dataset: "/self", Parent: "/self"},
+		{Dataset: "/loop1", Parent: "/loop2"},
+		{Dataset: "/loop2", Parent: "/loop1"},
+		{Dataset: ""},
+	}
+	tests := []struct {
+		name    string
+		dataset string
+		edges   []string
+		layers  map[string]int
+		wantErr bool
+	}{
+		{
+			name:  "all datasets",
+			edges: []string{"/calib->/model", "/loop1->/loop2", "/loop2->/loop1", "/lost->/derived", "/raw->/assay", "/raw->/calib"},
+			layers: map[string]int{
+				"/raw": 0, "/calib": 1, "/assay": 1, "/model": 2,
+				"/lost?": 0, "/derived": 1, "/self": 0, "/loop1": 1, "/loop2": 1,
+			},
+		},
+		{
+			name:    "ancestors and descendants",
+			dataset: "/calib",
+			edges:   []string{"/calib->/model", "/raw->/calib"},
+			layers:  map[string]int{"/raw": 0, "/calib": 1, "/model": 2},
+		},
+		{
+			name:    "root",
+			dataset: "/raw",
+			edges:   []string{"/calib->/model", "/raw->/assay", "/raw->/calib"},
+			layers:  map[string]int{"/raw": 0, "/calib": 1, "/assay": 1, "/model": 2},
+		},
+		{
+			name:    "missing parent",
+			dataset: "/derived",
+			edges:   []string{"/lost->/derived"},
+			layers:  map[string]int{"/lost?": 0, "/derived": 1},
+		},
+		{
+			name:    "self parent",
+			dataset: "/self",
+			edges:   nil,
+			layers:  map[string]int{"/self": 0},
+		},
+		{
+			name:    "cycle",
+			dataset: "/loop1",
+			edges:   []string{"/loop1->/loop2", "/loop2->/loop1"},
+			layers:  map[string]int{"/loop1": 1, "/loop2": 1},
+		},
+		{
+			name:    "unknown dataset",
+			dataset: "/unknown",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			graph, err := buildLineage(records, tt.dataset)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := lineageEdges(graph); !reflect.DeepEqual(got, tt.edges) {
+				t.Errorf("got edges %v, want %v", got, tt.edges)
+			}
+			if got := lineageLayers(graph); !reflect.DeepEqual(got, tt.layers) {
+				t.Errorf("got layers %v, want %v", got, tt.layers)
+			}
+			for _, e := range graph.Edges {
+				if e.Path == "" {
+					t.Errorf("edge %s->%s has no path", e.Parent, e.Child)
+				}
+			}
+		})
+	}
+}
+
+// TestBuildLineageLayout tests that nodes of lineage graph do not overlap
+func TestBuildLineageLayout(t *testing.T) {
+	records := []DBSRecord{
+		{Dataset: "/a"},
+		{Dataset: "/b"},
+		{Dataset: "/a1", Parent: "/a"},
+		{Dataset: "/a2", Parent: "/a"},
+		{Dataset: "/b1", Parent: "/b"},
+		{Dataset: "/a11", Parent: "/a1"},
+	}
+	graph, err := buildLineage(records, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	positions := make(map[[2]int]string)
+	for _, n := range graph.Nodes {
+		pos := [2]int{n.X, n.Y}
+		if other, ok := positions[pos]; ok {
+			t.Errorf("nodes %s and %s overlap", n.Dataset, other)
+		}
+		positions[pos] = n.Dataset
+		if n.X+lineageNodeWidth > graph.Width || n.Y+lineageNodeHeight > graph.Height {
+			t.Errorf("node %s is outside of the graph", n.Dataset)
+		}
+	}
+	// children are listed in the order of their names
+	for _, n := range graph.Nodes {
+		if !sort.StringsAreSorted(n.Children) {
+			t.Errorf("children of %s are not sorted: %v", n.Dataset, n.Children)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+// role based access control module
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	oreConfig "github.com/OreCast/common/config"
+	"github.com/gin-gonic/gin"
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+// list of permissions used by OreCast end-points
+const (
+	PermRead         = "Read"         // read access to sites, storage, meta-data and datasets
+	PermDataWrite    = "DataWrite"    // upload data, create meta-data and dataset records
+	PermDataDelete   = "DataDelete"   // delete data and meta-data records
+	PermStorageAdmin = "StorageAdmin" // create and delete site buckets
+	PermSiteAdmin    = "SiteAdmin"    // register and manage sites
+	PermAdmin        = "Admin"        // full access to OreCast
+)
+
+// list of roles used by OreCast
+const (
+	RoleViewer      = "viewer"
+	RoleDataManager = "data-manager"
+	RoleSiteAdmin   = "site-admin"
+	RoleAdmin       = "admin"
+)
+
+// rolePermissions defines permissions granted to each role
+var rolePermissions = map[string][]string{
+	RoleViewer:      {PermRead},
+	RoleDataManager: {PermRead, PermDataWrite, PermDataDelete},
+	RoleSiteAdmin:   {PermRead, PermDataWrite, PermDataDelete, PermStorageAdmin, PermSiteAdmin},
+	RoleAdmin:       {PermRead, PermDataWrite, PermDataDelete, PermStorageAdmin, PermSiteAdmin, PermAdmin},
+}
+
+// UserPolicy represents user roles, global and per-site ones
+type UserPolicy struct {
+	Roles []string            `json:"roles"`
+	Sites map[string][]string `json:"sites"`
+}
+
+// Policy represents local policy file
+type Policy struct {
+	DefaultRoles []string              `json:"default_roles"`
+	Users        map[string]UserPolicy `json:"users"`
+}
+
+// _policy holds local policy
+var _policy Policy
+
+// helper function to load local policy file
+func initPolicy() error {
+	_policy = Policy{DefaultRoles: []string{RoleViewer}}
+	if frontendConfig.PolicyFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(frontendConfig.PolicyFile)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &_policy); err != nil {
+		return err
+	}
+	if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
+		log.Printf("loaded policy for %d users from %s", len(_policy.Users), frontendConfig.PolicyFile)
+	}
+	return nil
+}
+
+// RoleClaims represents roles claims of the token issued by Authz service
+type RoleClaims struct {
+	Login string              `json:"login"`
+	Roles []string            `json:"roles"`
+	Sites map[string][]string `json:"sites"`
+	jwt.RegisteredClaims
+}
+
+// helper function to extract roles from user token claims
+func tokenRoles(token *UserToken) UserPolicy {
+	var policy UserPolicy
+	if token == nil || token.AccessToken == "" {
+		return policy
+	}
+	var jwtKey = []byte(oreConfig.Config.Authz.ClientId)
+	claims := &RoleClaims{}
+	_, err := jwt.ParseWithClaims(token.AccessToken, claims, func(token *jwt.Token) (any, error) {
+		return jwtKey, nil
+	})
+	if err != nil {
+		log.Println("WARNING: unable to parse token claims", err)
+		return policy
+	}
+	policy.Roles = claims.Roles
+	policy.Sites = claims.Sites
+	return policy
+}
+
+// helper function to get policy of the user who made given request, it combines
+// roles from token claims and local policy file
+func userPolicy(c *gin.Context) UserPolicy {
+	if val, ok := c.Get("policy"); ok {
+		if policy, ok := val.(UserPolicy); ok {
+			return policy
+		}
+	}
+	policy := UserPolicy{Sites: make(map[string][]string)}
+	var user string
+	if val, ok := c.Get("user"); ok {
+		user = fmt.Sprintf("%v", val)
+	}
+	if val, ok := c.Get("token"); ok {
+		if token, ok := val.(*UserToken); ok {
+			tpolicy := tokenRoles(token)
+			policy.Roles = append(policy.Roles, tpolicy.Roles...)
+			for site, roles := range tpolicy.Sites {
+				policy.Sites[site] = append(policy.Sites[site], roles...)
+			}
+		}
+	}
+	if upolicy, ok := _policy.Users[user]; ok {
+		policy.Roles = append(policy.Roles, upolicy.Roles...)
+		for site, roles := range upolicy.Sites {
+			policy.Sites[site] = append(policy.Sites[site], roles...)
+		}
+	}
+	if len(policy.Roles) == 0 && user != "" {
+		policy.Roles = _policy.DefaultRoles
+	}
+	c.Set("policy", policy)
+	return policy
+}
+
+// Permissions returns set of permissions granted by the policy for given site,
+// empty site name implies global permissions only
+func (p UserPolicy) Permissions(site string) map[string]bool {
+	perms := make(map[string]bool)
+	var roles []string
+	roles = append(roles, p.Roles...)
+	if site != "" {
+		roles = append(roles, p.Sites[site]...)
+	}
+	for _, role := range roles {
+		for _, perm := range rolePermissions[role] {
+			perms[perm] = true
+		}
+	}
+	return perms
+}
+
+// errSiteMismatch reports request which names different sites in its url
+// query and body
+var errSiteMismatch = errors.New("site of url query does not match site of request body")
+
+// helper function to get site name of given request, the site is taken from
+// the source handlers bind it from. Form bindings prefer body values over url
+// query, therefore request which names different sites in its query and body
+// is rejected, otherwise permissions would be checked for one site while the
+// handler acts on another one.
+func requestSite(c *gin.Context) (string, error) {
+	if site := c.Param("site"); site != "" {
+		return site, nil
+	}
+	site := c.Query("site")
+	// we only look-up site in url-encoded forms and JSON bodies since parsing
+	// of multipart forms would consume request body which should be streamed
+	// by handlers, such handlers check permissions of the site they bind
+	var bodySite string
+	switch {
+	case c.Request.Method == "POST" && c.ContentType() == "application/x-www-form-urlencoded":
+		bodySite = c.PostForm("site")
+	case (c.Request.Method == "POST" || c.Request.Method == "PUT") && c.ContentType() == "application/json":
+		bodySite = jsonBodySite(c)
+	}
+	if bodySite == "" {
+		return site, nil
+	}
+	if site != "" && site != bodySite {
+		return "", fmt.Errorf("%w: %q != %q", errSiteMismatch, site, bodySite)
+	}
+	return bodySite, nil
+}
+
+// maxSiteBody defines size of JSON request body inspected for site of the request
+const maxSiteBody = 1 << 20
+
+// bodyReader restores request body which was read before its handler
+type bodyReader struct {
+	io.Reader
+	io.Closer
+}
+
+// helper function to get site field of JSON request body, the body is
+// buffered and restored for handlers and site is kept in request context
+func jsonBodySite(c *gin.Context) string {
+	if site, ok := c.Get("body_site"); ok {
+		return site.(string)
+	}
+	var site string
+	if c.Request.Body != nil {
+		data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxSiteBody+1))
+		if err == nil && len(data) <= maxSiteBody {
+			var rec struct {
+				Site string `json:"site"`
+			}
+			if err := json.Unmarshal(data, &rec); err == nil {
+				site = rec.Site
+			}
+		}
+		c.Request.Body = bodyReader{io.MultiReader(bytes.NewReader(data), c.Request.Body), c.Request.Body}
+	}
+	c.Set("body_site", site)
+	return site
+}
+
+// helper function to get permissions of the user who made given request
+func userPermissions(c *gin.Context, site string) map[string]bool {
+	return userPolicy(c).Permissions(site)
+}
+
+// helper function to check that user has given permission at the site which
+// is bound by the handler from its form, it responds with error page and
+// returns false if permission is missing
+func sitePermission(c *gin.Context, site, perm string) bool {
+	if userPermissions(c, site)[perm] {
+		return true
+	}
+	user, _ := c.Get("user")
+	log.Printf("WARNING: user %v is not allowed to %s %s at site %s, required permission %s", user, c.Request.Method, c.Request.URL.Path, site, perm)
+	errorPage(c, http.StatusForbidden, fmt.Sprintf("you are not allowed to access site %s", site), fmt.Errorf("missing %s permission", perm))
+	return false
+}
+
+// RequirePermission provides middleware which checks that user has given permission
+func RequirePermission(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		site, err := requestSite(c)
+		if err != nil {
+			errorPage(c, http.StatusBadRequest, "ambiguous site of the request", err)
+			c.Abort()
+			return
+		}
+		if userPermissions(c, site)[perm] {
+			c.Next()
+			return
+		}
+		user, _ := c.Get("user")
+		log.Printf("WARNING: user %v is not allowed to %s %s, required permission %s", user, c.Request.Method, c.Request.URL.Path, perm)
+		if wantJSON(c) {
+			apiError(c, http.StatusForbidden, fmt.Sprintf("you are not allowed to access %s", c.Request.URL.Path), fmt.Errorf("missing %s permission", perm))
+			c.Abort()
+			return
+		}
+		tmpl := makeTmpl(c, "Access denied")
+		top := tmplPage("top.tmpl", tmpl)
+		bottom := tmplPage("bottom.tmpl", tmpl)
+		// request path is escaped by errorTmpl along with other messages
+		msg := fmt.Sprintf("you are not allowed to access %s", c.Request.URL.Path)
+		content := errorTmpl(c, msg, fmt.Errorf("missing %s permission", perm))
+		c.Data(http.StatusForbidden, "text/html; charset=utf-8", []byte(top+content+bottom))
+		c.Abort()
+	}
+}
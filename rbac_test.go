@@ -0,0 +1,361 @@
+package main
+
+// role based access control tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/OreCast/Frontend/client"
+	oreConfig "github.com/OreCast/common/config"
+	"github.com/gin-gonic/gin"
+)
+
+// helper function to set policy where alice is admin of site A only, other
+// users get default viewer role
+func testPolicy(t *testing.T) {
+	t.Helper()
+	if oreConfig.Config == nil {
+		oreConfig.Config = &oreConfig.OreCastConfig{}
+	}
+	policy := _policy
+	t.Cleanup(func() { _policy = policy })
+	_policy = Policy{
+		DefaultRoles: []string{RoleViewer},
+		Users: map[string]UserPolicy{
+			"alice": {Sites: map[string][]string{"A": {RoleSiteAdmin}}},
+		},
+	}
+}
+
+// helper function to create router of given authorized routes for the user
+func testRouter(user string, routes ...Route) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	for _, route := range routes {
+		r.Handle(route.Method, route.Path, RequirePermission(route.Permission), route.Handler)
+	}
+	return r
+}
+
+// helper function to point clients of OreCast services to fake service which
+// accepts all calls and counts them
+func countingServices(t *testing.T) *atomic.Int32 {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	t.Cleanup(srv.Close)
+	services := _services
+	t.Cleanup(func() { _services = services })
+	_services = client.New(client.Config{
+		DiscoveryURL:       srv.URL,
+		DataManagementURL:  srv.URL,
+		MetaDataURL:        srv.URL,
+		DataBookkeepingURL: srv.URL,
+		AuthzURL:           srv.URL,
+	})
+	return &calls
+}
+
+// helper function to make request with url-encoded form
+func formRequest(method, target string, form url.Values) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	return req
+}
+
+// helper function to make request with JSON body
+func jsonRequest(method, target, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	return req
+}
+
+// helper function to make request with multipart form
+func multipartRequest(t *testing.T, target string, fields map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for key, val := range fields {
+		if err := writer.WriteField(key, val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writer.Close()
+	req := httptest.NewRequest("POST", target, &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Accept", "application/json")
+	return req
+}
+
+// TestRequestSite tests sources of the site of the request
+func TestRequestSite(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     *http.Request
+		site    string
+		wantErr bool
+	}{
+		{"query", httptest.NewRequest("GET", "/x?site=A", nil), "A", false},
+		{"form body", formRequest("POST", "/x", url.Values{"site": {"B"}}), "B", false},
+		{"form body and query", formRequest("POST", "/x?site=A", url.Values{"site": {"A"}}), "A", false},
+		{"query of form without site", formRequest("POST", "/x?site=A", url.Values{"bucket": {"b"}}), "A", false},
+		{"form body mismatches query", formRequest("POST", "/x?site=A", url.Values{"site": {"B"}}), "", true},
+		{"json body", jsonRequest("POST", "/x", `{"site":"B"}`), "B", false},
+		{"json body and query", jsonRequest("PUT", "/x?site=A", `{"site":"A"}`), "A", false},
+		{"query of json without site", jsonRequest("POST", "/x?site=A", `{"name":"d"}`), "A", false},
+		{"json body mismatches query", jsonRequest("POST", "/x?site=A", `{"site":"B"}`), "", true},
+		{"none", httptest.NewRequest("GET", "/x", nil), "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = tt.req
+			site, err := requestSite(c)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, errSiteMismatch) {
+				t.Errorf("unexpected error %v", err)
+			}
+			if site != tt.site {
+				t.Errorf("got site %q, want %q", site, tt.site)
+			}
+		})
+	}
+}
+
+// TestRequirePermissionSite tests that permissions are checked against site
+// which handler acts on
+func TestRequirePermissionSite(t *testing.T) {
+	testPolicy(t)
+	var bound string
+	handler := func(c *gin.Context) {
+		var form CreateBucketForm
+		c.ShouldBind(&form)
+		bound = form.Site
+		c.String(http.StatusOK, form.Site)
+	}
+	routes := []Route{
+		{"POST", "/storage/create", PermStorageAdmin, handler},
+		{"GET", "/storage/:site/create", PermStorageAdmin, handler},
+	}
+	tests := []struct {
+		name   string
+		user   string
+		req    *http.Request
+		status int
+	}{
+		{"granted site", "alice", formRequest("POST", "/storage/create", url.Values{"site": {"A"}}), http.StatusOK},
+		{"granted site in query", "alice", formRequest("POST", "/storage/create?site=A", url.Values{"bucket": {"b"}}), http.StatusOK},
+		{"other site", "alice", formRequest("POST", "/storage/create", url.Values{"site": {"B"}}), http.StatusForbidden},
+		{"other site in query", "alice", formRequest("POST", "/storage/create?site=B", nil), http.StatusForbidden},
+		{"forged body site", "alice", formRequest("POST", "/storage/create?site=A", url.Values{"site": {"B"}}), http.StatusBadRequest},
+		{"path site", "alice", httptest.NewRequest("GET", "/storage/A/create", nil), http.StatusOK},
+		{"other path site", "alice", httptest.NewRequest("GET", "/storage/B/create", nil), http.StatusForbidden},
+		{"viewer", "bob", formRequest("POST", "/storage/create", url.Values{"site": {"A"}}), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bound = ""
+			w := httptest.NewRecorder()
+			testRouter(tt.user, routes...).ServeHTTP(w, tt.req)
+			if w.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status != http.StatusOK && bound != "" {
+				t.Errorf("handler is called for site %s", bound)
+			}
+		})
+	}
+}
+
+// TestRequirePermissionJSONSite tests that JSON body names the site of the
+// request and is still available to the handler
+func TestRequirePermissionJSONSite(t *testing.T) {
+	testPolicy(t)
+	var bound string
+	handler := func(c *gin.Context) {
+		var form DatasetForm
+		c.ShouldBindJSON(&form)
+		bound = form.Site
+		c.String(http.StatusOK, form.Site)
+	}
+	route := Route{"POST", "/api/dataset", PermDataWrite, handler}
+	tests := []struct {
+		name   string
+		req    *http.Request
+		status int
+	}{
+		{"granted site", jsonRequest("POST", "/api/dataset", `{"site":"A"}`), http.StatusOK},
+		{"other site", jsonRequest("POST", "/api/dataset", `{"site":"B"}`), http.StatusForbidden},
+		{"forged body site", jsonRequest("POST", "/api/dataset?site=A", `{"site":"B"}`), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bound = ""
+			w := httptest.NewRecorder()
+			testRouter("alice", route).ServeHTTP(w, tt.req)
+			if w.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status == http.StatusOK && bound != "A" {
+				t.Errorf("handler bound site %q from restored body", bound)
+			}
+			if tt.status != http.StatusOK && bound != "" {
+				t.Errorf("handler is called for site %s", bound)
+			}
+		})
+	}
+}
+
+// TestStorageHandlersSite tests that bucket handlers check permissions of the
+// site of multipart forms which are not inspected by middleware
+func TestStorageHandlersSite(t *testing.T) {
+	testPolicy(t)
+	calls := countingServices(t)
+	routes := []Route{
+		{"POST", "/storage/create", PermStorageAdmin, S3CreatePostHandler},
+		{"POST", "/storage/delete", PermStorageAdmin, S3DeletePostHandler},
+	}
+	for _, path := range []string{"/storage/create", "/storage/delete"} {
+		req := multipartRequest(t, path+"?site=A", map[string]string{"site": "B", "bucket": "data"})
+		w := httptest.NewRecorder()
+		testRouter("alice", routes...).ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: got status %d, want %d", path, w.Code, http.StatusForbidden)
+		}
+	}
+	if n := calls.Load(); n != 0 {
+		t.Errorf("DataManagement service is called %d times for forbidden site", n)
+	}
+
+	// granted site reaches DataManagement service
+	req := multipartRequest(t, "/storage/delete?site=A", map[string]string{"site": "A", "bucket": "data"})
+	w := httptest.NewRecorder()
+	testRouter("alice", routes...).ServeHTTP(w, req)
+	if w.Code != http.StatusOK || calls.Load() != 1 {
+		t.Errorf("got status %d and %d calls of DataManagement service", w.Code, calls.Load())
+	}
+}
+
+// TestSiteHandlersSite tests that site administration handlers check
+// permissions of the site they bind from multipart forms
+func TestSiteHandlersSite(t *testing.T) {
+	testPolicy(t)
+	calls := countingServices(t)
+	routes := []Route{
+		{"POST", "/site/edit", PermSiteAdmin, SiteEditPostHandler},
+		{"POST", "/site/credentials", PermSiteAdmin, SiteCredentialsPostHandler},
+		{"POST", "/site/delete", PermSiteAdmin, SiteDeletePostHandler},
+	}
+	fields := map[string]string{
+		"site":          "B",
+		"confirm":       "B",
+		"endpoint":      "evil.example.com",
+		"access_key":    "key",
+		"access_secret": "secret",
+	}
+	for _, route := range routes {
+		req := multipartRequest(t, route.Path+"?site=A", fields)
+		w := httptest.NewRecorder()
+		testRouter("alice", routes...).ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: got status %d, want %d", route.Path, w.Code, http.StatusForbidden)
+		}
+	}
+	if n := calls.Load(); n != 0 {
+		t.Errorf("OreCast services are called %d times for forbidden site", n)
+	}
+
+	// granted site reaches Discovery service
+	req := multipartRequest(t, "/site/delete?site=A", map[string]string{"site": "A", "confirm": "A"})
+	w := httptest.NewRecorder()
+	testRouter("alice", routes...).ServeHTTP(w, req)
+	if w.Code != http.StatusOK || calls.Load() == 0 {
+		t.Errorf("got status %d and %d calls of OreCast services", w.Code, calls.Load())
+	}
+}
+
+// TestMetaHandlersSite tests that meta-data handlers check permissions of the
+// site they bind from multipart forms
+func TestMetaHandlersSite(t *testing.T) {
+	testPolicy(t)
+	calls := countingServices(t)
+	store, err := NewHistoryStore(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	history := _history
+	t.Cleanup(func() {
+		_history = history
+		store.db.Close()
+	})
+	_history = store
+	rev := Revision{MetaID: "123", Site: "B", Action: "create", Record: MetaData{Site: "B", Bucket: "data"}}
+	if _, err := store.Add(rev); err != nil {
+		t.Fatal(err)
+	}
+	routes := []Route{
+		{"POST", "/meta/upload", PermDataWrite, MetaUploadPostHandler},
+		{"POST", "/meta/delete", PermDataDelete, MetaDeletePostHandler},
+		{"POST", "/meta/revert", PermDataWrite, MetaRevertPostHandler},
+	}
+	fields := map[string]string{
+		"id":          "123",
+		"site":        "B",
+		"bucket":      "data",
+		"description": "forged record",
+		"confirm":     "true",
+		"revision":    "1",
+	}
+	for _, route := range routes {
+		req := multipartRequest(t, route.Path+"?site=A", fields)
+		w := httptest.NewRecorder()
+		testRouter("alice", routes...).ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: got status %d, want %d", route.Path, w.Code, http.StatusForbidden)
+		}
+	}
+	if n := calls.Load(); n != 0 {
+		t.Errorf("OreCast services are called %d times for forbidden site", n)
+	}
+}
+
+// TestDataRegistrationSite tests that dataset is registered only at the site
+// user is permitted to write to
+func TestDataRegistrationSite(t *testing.T) {
+	testPolicy(t)
+	calls := countingServices(t)
+	route := Route{"POST", "/data/registration", PermDataWrite, DataRegistrationPostHandler}
+	fields := map[string]string{"dataset": "/a/b/c", "site": "B", "meta_id": "123"}
+	req := multipartRequest(t, "/data/registration?site=A", fields)
+	w := httptest.NewRecorder()
+	testRouter("alice", route).ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if n := calls.Load(); n != 0 {
+		t.Errorf("OreCast services are called %d times for forbidden site", n)
+	}
+}
@@ -0,0 +1,509 @@
+package main
+
+// project schema module
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+// Projects register JSON Schemas of their meta-data attributes, e.g. drill-hole
+// campaign may require commodity, drillhole_id, depth_from, depth_to and crs.
+// The schemas are used to generate meta-data record forms and to validate
+// records before they are posted to MetaData service. We support flat objects
+// with the following JSON Schema keywords: type (string, number, integer,
+// boolean and array of them), title, description, required, enum, default,
+// minimum, maximum, minLength, maxLength, pattern and format (date, date-time).
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JSONSchema represents supported subset of JSON Schema
+type JSONSchema struct {
+	Type        string                 `json:"type,omitempty"`
+	Title       string                 `json:"title,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Properties  map[string]*JSONSchema `json:"properties,omitempty"`
+	Required    []string               `json:"required,omitempty"`
+	Items       *JSONSchema            `json:"items,omitempty"`
+	Enum        []any                  `json:"enum,omitempty"`
+	Default     any                    `json:"default,omitempty"`
+	Minimum     *float64               `json:"minimum,omitempty"`
+	Maximum     *float64               `json:"maximum,omitempty"`
+	MinLength   *int                   `json:"minLength,omitempty"`
+	MaxLength   *int                   `json:"maxLength,omitempty"`
+	Pattern     string                 `json:"pattern,omitempty"`
+	Format      string                 `json:"format,omitempty"`
+
+	order []string // order of properties in schema document
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface, it keeps order of
+// properties which defines order of form fields
+func (s *JSONSchema) UnmarshalJSON(data []byte) error {
+	type schema JSONSchema
+	var out schema
+	if err := json.Unmarshal(data, &out); err != nil {
+		return err
+	}
+	*s = JSONSchema(out)
+	var props struct {
+		Properties json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(data, &props); err != nil || len(props.Properties) == 0 {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(props.Properties))
+	depth := 0
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch t := token.(type) {
+		case json.Delim:
+			if t == '{' || t == '[' {
+				depth++
+			} else {
+				depth--
+			}
+		case string:
+			if depth == 1 {
+				s.order = append(s.order, t)
+				// skip property schema
+				var skip json.RawMessage
+				if err := dec.Decode(&skip); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Fields returns names of schema properties in order of schema document
+func (s *JSONSchema) Fields() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range s.order {
+		if _, ok := s.Properties[name]; ok && !seen[name] {
+			names = append(names, name)
+			seen[name] = true
+		}
+	}
+	// properties of schemas built in Go code have no order
+	var rest []string
+	for name := range s.Properties {
+		if !seen[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	return append(names, rest...)
+}
+
+// helper function to check if field is required by the schema
+func (s *JSONSchema) isRequired(name string) bool {
+	for _, r := range s.Required {
+		if r == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Check verifies that schema is supported by meta-data forms
+func (s *JSONSchema) Check() error {
+	if s.Type != "object" {
+		return errors.New("schema should describe object, please use \"type\": \"object\"")
+	}
+	if len(s.Properties) == 0 {
+		return errors.New("schema does not define any properties")
+	}
+	for _, name := range s.Required {
+		if _, ok := s.Properties[name]; !ok {
+			return fmt.Errorf("required property %s is not defined", name)
+		}
+	}
+	for name, prop := range s.Properties {
+		if prop == nil {
+			return fmt.Errorf("property %s has no schema", name)
+		}
+		if err := prop.checkProperty(true); err != nil {
+			return fmt.Errorf("property %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// helper function to check schema of single property
+func (s *JSONSchema) checkProperty(allowArray bool) error {
+	switch s.Type {
+	case "string", "number", "integer", "boolean":
+	case "array":
+		if !allowArray {
+			return errors.New("nested arrays are not supported")
+		}
+		if s.Items == nil {
+			return errors.New("array should define its items")
+		}
+		if err := s.Items.checkProperty(false); err != nil {
+			return err
+		}
+	case "":
+		return errors.New("type is not defined")
+	default:
+		return fmt.Errorf("type %s is not supported", s.Type)
+	}
+	if s.Pattern != "" {
+		if _, err := regexp.Compile(s.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+	return nil
+}
+
+// helper function to convert form value into value of given property type
+func (s *JSONSchema) parseValue(val string) (any, error) {
+	switch s.Type {
+	case "number":
+		return strconv.ParseFloat(val, 64)
+	case "integer":
+		return strconv.ParseInt(val, 10, 64)
+	case "boolean":
+		return val == "true" || val == "on" || val == "1", nil
+	case "array":
+		var items []any
+		for _, v := range strings.Split(val, ",") {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				continue
+			}
+			item, err := s.Items.parseValue(v)
+			if err != nil {
+				return nil, fmt.Errorf("item %q: %w", v, err)
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	}
+	return val, nil
+}
+
+// helper function to validate value against property schema
+func (s *JSONSchema) validateValue(val any) error {
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if fmt.Sprintf("%v", e) == fmt.Sprintf("%v", val) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("should be one of %v", s.Enum)
+		}
+	}
+	switch v := val.(type) {
+	case string:
+		if s.MinLength != nil && len([]rune(v)) < *s.MinLength {
+			return fmt.Errorf("should be at least %d characters long", *s.MinLength)
+		}
+		if s.MaxLength != nil && len([]rune(v)) > *s.MaxLength {
+			return fmt.Errorf("should be at most %d characters long", *s.MaxLength)
+		}
+		if s.Pattern != "" {
+			if re, err := regexp.Compile(s.Pattern); err == nil && !re.MatchString(v) {
+				return fmt.Errorf("should match pattern %s", s.Pattern)
+			}
+		}
+		switch s.Format {
+		case "date":
+			if _, err := time.Parse("2006-01-02", v); err != nil {
+				return errors.New("should be date in YYYY-MM-DD format")
+			}
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339, v); err != nil {
+				return errors.New("should be date and time in RFC 3339 format")
+			}
+		}
+	case float64, int64:
+		num, _ := strconv.ParseFloat(fmt.Sprintf("%v", v), 64)
+		if s.Minimum != nil && num < *s.Minimum {
+			return fmt.Errorf("should be greater than or equal to %v", *s.Minimum)
+		}
+		if s.Maximum != nil && num > *s.Maximum {
+			return fmt.Errorf("should be less than or equal to %v", *s.Maximum)
+		}
+	case []any:
+		for _, item := range v {
+			if err := s.Items.validateValue(item); err != nil {
+				return fmt.Errorf("item %v %w", item, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ParseForm converts form values of schema properties into meta-data
+// attributes and validates them, errors are reported per field
+func (s *JSONSchema) ParseForm(value func(name string) string) (map[string]any, map[string]string) {
+	attrs := make(map[string]any)
+	errs := make(map[string]string)
+	for _, name := range s.Fields() {
+		prop := s.Properties[name]
+		val := strings.TrimSpace(value(name))
+		if val == "" {
+			if prop.Type == "boolean" {
+				attrs[name] = false
+			} else if s.isRequired(name) {
+				errs[name] = "this field is required"
+			}
+			continue
+		}
+		parsed, err := prop.parseValue(val)
+		if err != nil {
+			errs[name] = fmt.Sprintf("should be %s", prop.Type)
+			continue
+		}
+		if err := prop.validateValue(parsed); err != nil {
+			errs[name] = err.Error()
+			continue
+		}
+		attrs[name] = parsed
+	}
+	return attrs, errs
+}
+
+// SchemaField represents form field generated from schema property
+type SchemaField struct {
+	Name        string   // property name
+	Label       string   // field label
+	Description string   // field hint
+	Input       string   // input type: text, number, checkbox, date or select
+	Step        string   // step of number input
+	Options     []string // options of select input
+	Required    bool     // field is required
+	Value       string   // current value
+	Checked     bool     // current value of checkbox
+	Error       string   // validation error of the field
+}
+
+// FormFields returns form fields of schema properties with given attribute
+// values and validation errors
+func (s *JSONSchema) FormFields(attrs map[string]any, errs map[string]string) []SchemaField {
+	var fields []SchemaField
+	for _, name := range s.Fields() {
+		prop := s.Properties[name]
+		field := SchemaField{
+			Name:        name,
+			Label:       prop.Title,
+			Description: prop.Description,
+			Input:       "text",
+			Required:    s.isRequired(name),
+			Error:       errs[name],
+		}
+		if field.Label == "" {
+			field.Label = name
+		}
+		val, ok := attrs[name]
+		if !ok {
+			val = prop.Default
+		}
+		switch prop.Type {
+		case "number":
+			field.Input = "number"
+			field.Step = "any"
+		case "integer":
+			field.Input = "number"
+			field.Step = "1"
+		case "boolean":
+			field.Input = "checkbox"
+			field.Checked = val == true
+		case "array":
+			if prop.Description == "" {
+				field.Description = "comma separated list"
+			}
+		case "string":
+			switch prop.Format {
+			case "date":
+				field.Input = "date"
+			}
+		}
+		if len(prop.Enum) > 0 {
+			field.Input = "select"
+			for _, e := range prop.Enum {
+				field.Options = append(field.Options, fmt.Sprintf("%v", e))
+			}
+		}
+		switch v := val.(type) {
+		case nil:
+		case []any:
+			var items []string
+			for _, item := range v {
+				items = append(items, fmt.Sprintf("%v", item))
+			}
+			field.Value = strings.Join(items, ", ")
+		default:
+			field.Value = fmt.Sprintf("%v", v)
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// ProjectSchema represents JSON Schema registered by the project
+type ProjectSchema struct {
+	Project     string          `json:"project"`
+	Site        string          `json:"site,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Schema      json.RawMessage `json:"schema"`
+	UpdatedBy   string          `json:"updated_by,omitempty"`
+	Updated     int64           `json:"updated"`
+}
+
+// Parse parses and checks JSON Schema of the project
+func (p ProjectSchema) Parse() (*JSONSchema, error) {
+	var schema JSONSchema
+	if err := json.Unmarshal(p.Schema, &schema); err != nil {
+		return nil, err
+	}
+	if err := schema.Check(); err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// projectName defines allowed project names, they are used as file names
+var projectName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// SchemaStore keeps JSON Schemas of projects as files of local directory
+type SchemaStore struct {
+	Dir string
+	mu  sync.RWMutex
+}
+
+// _schemas holds JSON Schemas of projects
+var _schemas *SchemaStore
+
+// helper function to initialize store of project schemas
+func initSchemas() error {
+	_schemas = &SchemaStore{Dir: frontendConfig.SchemaDir}
+	return os.MkdirAll(frontendConfig.SchemaDir, 0755)
+}
+
+// helper function to get file name of project schema
+func (s *SchemaStore) path(project string) (string, error) {
+	if !projectName.MatchString(project) {
+		return "", fmt.Errorf("invalid project name %q", project)
+	}
+	return filepath.Join(s.Dir, project+".json"), nil
+}
+
+// Get returns schema of given project
+func (s *SchemaStore) Get(project string) (ProjectSchema, error) {
+	var ps ProjectSchema
+	fname, err := s.path(project)
+	if err != nil {
+		return ps, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ps, fmt.Errorf("project %s has no registered schema", project)
+		}
+		return ps, err
+	}
+	err = json.Unmarshal(data, &ps)
+	return ps, err
+}
+
+// List returns schemas of all projects ordered by project name
+func (s *SchemaStore) List() ([]ProjectSchema, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	files, err := filepath.Glob(filepath.Join(s.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var schemas []ProjectSchema
+	for _, fname := range files {
+		data, err := os.ReadFile(fname)
+		if err != nil {
+			return nil, err
+		}
+		var ps ProjectSchema
+		if err := json.Unmarshal(data, &ps); err != nil {
+			return nil, fmt.Errorf("%s: %w", fname, err)
+		}
+		schemas = append(schemas, ps)
+	}
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i].Project < schemas[j].Project })
+	return schemas, nil
+}
+
+// Save stores schema of the project, the schema is checked before it is stored
+func (s *SchemaStore) Save(ps ProjectSchema) error {
+	fname, err := s.path(ps.Project)
+	if err != nil {
+		return err
+	}
+	if _, err := ps.Parse(); err != nil {
+		return err
+	}
+	ps.Updated = time.Now().Unix()
+	data, err := json.MarshalIndent(ps, "", "  ")
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// write to temporary file first, therefore readers never see partial schema
+	tmp := fname + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fname)
+}
+
+// helper function to get parsed JSON Schema of given project
+func projectSchema(project string) (*JSONSchema, error) {
+	ps, err := _schemas.Get(project)
+	if err != nil {
+		return nil, err
+	}
+	return ps.Parse()
+}
+
+// exampleSchema provides starting point of new project schema
+const exampleSchema = `{
+  "type": "object",
+  "properties": {
+    "commodity": {"type": "string", "title": "Commodity", "enum": ["Cu", "Au", "Li", "Ni"]},
+    "drillhole_id": {"type": "string", "title": "Drill-hole ID", "pattern": "^DH-[0-9]+$"},
+    "depth_from": {"type": "number", "title": "Depth from (m)", "minimum": 0},
+    "depth_to": {"type": "number", "title": "Depth to (m)", "minimum": 0},
+    "crs": {"type": "string", "title": "Coordinate reference system", "default": "EPSG:4326"}
+  },
+  "required": ["commodity", "drillhole_id", "depth_from", "depth_to", "crs"]
+}`
+
+// helper function to save project schema, it reports invalid JSON documents
+// before they reach the store
+func saveProjectSchema(ps ProjectSchema) error {
+	if !json.Valid(ps.Schema) {
+		return errors.New("schema is not valid JSON document")
+	}
+	return _schemas.Save(ps)
+}
@@ -0,0 +1,175 @@
+package main
+
+// project schema tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// helper function to parse JSON Schema document
+func parseSchema(t *testing.T, doc string) *JSONSchema {
+	t.Helper()
+	var schema JSONSchema
+	if err := json.Unmarshal([]byte(doc), &schema); err != nil {
+		t.Fatal(err)
+	}
+	return &schema
+}
+
+// TestSchemaCheck tests checks of supported JSON Schemas
+func TestSchemaCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		err  string
+	}{
+		{"example", exampleSchema, ""},
+		{"array", `{"type":"object","properties":{"tags":{"type":"array","items":{"type":"string"}}}}`, ""},
+		{"not object", `{"type":"array","items":{"type":"string"}}`, "should describe object"},
+		{"no properties", `{"type":"object"}`, "does not define any properties"},
+		{"unknown required", `{"type":"object","properties":{"a":{"type":"string"}},"required":["b"]}`, "required property b"},
+		{"no type", `{"type":"object","properties":{"a":{}}}`, "type is not defined"},
+		{"unsupported type", `{"type":"object","properties":{"a":{"type":"object"}}}`, "type object is not supported"},
+		{"null property", `{"type":"object","properties":{"a":null}}`, "has no schema"},
+		{"array without items", `{"type":"object","properties":{"a":{"type":"array"}}}`, "should define its items"},
+		{"nested array", `{"type":"object","properties":{"a":{"type":"array","items":{"type":"array","items":{"type":"string"}}}}}`, "nested arrays"},
+		{"invalid pattern", `{"type":"object","properties":{"a":{"type":"string","pattern":"(["}}}`, "invalid pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parseSchema(t, tt.doc).Check()
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+// TestSchemaFields tests that fields follow order of schema document
+func TestSchemaFields(t *testing.T) {
+	schema := parseSchema(t, exampleSchema)
+	want := []string{"commodity", "drillhole_id", "depth_from", "depth_to", "crs"}
+	if got := schema.Fields(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got fields %v, want %v", got, want)
+	}
+}
+
+// TestSchemaValidateValue tests validation of values against property schemas
+func TestSchemaValidateValue(t *testing.T) {
+	schema := parseSchema(t, `{"type":"object","properties":{
+		"commodity": {"type":"string","enum":["Cu","Au"]},
+		"hole": {"type":"string","pattern":"^DH-[0-9]+$","minLength":4,"maxLength":6},
+		"date": {"type":"string","format":"date"},
+		"time": {"type":"string","format":"date-time"},
+		"depth": {"type":"number","minimum":0,"maximum":100},
+		"count": {"type":"integer","minimum":1},
+		"level": {"type":"integer","enum":[1,2,3]},
+		"tags": {"type":"array","items":{"type":"string","maxLength":3}}
+	}}`)
+	tests := []struct {
+		field string
+		value any
+		err   string
+	}{
+		{"commodity", "Cu", ""},
+		{"commodity", "Fe", "should be one of"},
+		{"hole", "DH-1", ""},
+		{"hole", "DH-", "at least 4"},
+		{"hole", "DH-12345", "at most 6"},
+		{"hole", "XX-12", "should match pattern"},
+		{"date", "2024-01-31", ""},
+		{"date", "31/01/2024", "YYYY-MM-DD"},
+		{"time", "2024-01-31T10:00:00Z", ""},
+		{"time", "2024-01-31", "RFC 3339"},
+		{"depth", 0.0, ""},
+		{"depth", 100.0, ""},
+		{"depth", -0.5, "greater than or equal to 0"},
+		{"depth", 100.5, "less than or equal to 100"},
+		{"count", int64(1), ""},
+		{"count", int64(0), "greater than or equal to 1"},
+		{"level", int64(2), ""},
+		{"level", int64(4), "should be one of"},
+		{"tags", []any{"a", "abc"}, ""},
+		{"tags", []any{"a", "abcd"}, "item abcd should be at most 3"},
+	}
+	for _, tt := range tests {
+		err := schema.Properties[tt.field].validateValue(tt.value)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%s=%v: unexpected error %v", tt.field, tt.value, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s=%v: got error %v, want %q", tt.field, tt.value, err, tt.err)
+		}
+	}
+}
+
+// TestSchemaParseForm tests conversion of form values into meta-data attributes
+func TestSchemaParseForm(t *testing.T) {
+	schema := parseSchema(t, `{"type":"object","properties":{
+		"commodity": {"type":"string","enum":["Cu","Au"]},
+		"depth": {"type":"number","minimum":0},
+		"count": {"type":"integer"},
+		"public": {"type":"boolean"},
+		"tags": {"type":"array","items":{"type":"integer"}},
+		"note": {"type":"string"}
+	},"required":["commodity","depth"]}`)
+	tests := []struct {
+		name  string
+		form  map[string]string
+		attrs map[string]any
+		errs  map[string]string
+	}{
+		{
+			name: "valid",
+			form: map[string]string{"commodity": "Cu", "depth": " 12.5 ", "count": "3", "public": "on", "tags": "1, 2,,3"},
+			attrs: map[string]any{
+				"commodity": "Cu", "depth": 12.5, "count": int64(3), "public": true,
+				"tags": []any{int64(1), int64(2), int64(3)},
+			},
+			errs: map[string]string{},
+		},
+		{
+			name:  "missing required",
+			form:  map[string]string{"note": "x"},
+			attrs: map[string]any{"public": false, "note": "x"},
+			errs:  map[string]string{"commodity": "this field is required", "depth": "this field is required"},
+		},
+		{
+			name:  "invalid values",
+			form:  map[string]string{"commodity": "Fe", "depth": "deep", "count": "1.5", "tags": "1,x"},
+			attrs: map[string]any{"public": false},
+			errs: map[string]string{
+				"commodity": "should be one of [Cu Au]",
+				"depth":     "should be number",
+				"count":     "should be integer",
+				"tags":      "should be array",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attrs, errs := schema.ParseForm(func(name string) string { return tt.form[name] })
+			if !reflect.DeepEqual(attrs, tt.attrs) {
+				t.Errorf("got attributes %v, want %v", attrs, tt.attrs)
+			}
+			if !reflect.DeepEqual(errs, tt.errs) {
+				t.Errorf("got errors %v, want %v", errs, tt.errs)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"embed"
+	"expvar"
 	"fmt"
 	"io/fs"
 	"log"
@@ -35,6 +36,9 @@ func makeTmpl(c *gin.Context, title string) TmplRecord {
 	if user, ok := c.Get("user"); ok {
 		tmpl["User"] = user
 	}
+	tmpl["Flashes"] = popFlashes(c)
+	site, _ := requestSite(c)
+	tmpl["Perms"] = userPermissions(c, site)
 	tmpl["Base"] = oreConfig.Config.Frontend.WebServer.Base
 	tmpl["ServerInfo"] = oreConfig.Info()
 	tmpl["Top"] = tmplPage("top.tmpl", tmpl)
@@ -43,6 +47,93 @@ func makeTmpl(c *gin.Context, title string) TmplRecord {
 	return tmpl
 }
 
+// Route represents authorized end-point along with permission required to access it
+type Route struct {
+	Method     string
+	Path       string
+	Permission string
+	Handler    gin.HandlerFunc
+}
+
+// helper function which defines all end-points which require user authorization
+func authorizedRoutes() []Route {
+	return []Route{
+		// GET methods
+		{"GET", "/datasets", PermRead, DatasetsHandler},
+		{"GET", "/dataset/*dataset", PermRead, DatasetHandler},
+
+		{"GET", "/meta", PermRead, MetaDataHandler},
+		{"GET", "/meta/record/:mid/:site", PermRead, MetaRecordHandler},
+		{"GET", "/meta/:site", PermRead, MetaSiteHandler},
+		{"GET", "/meta/:site/upload", PermDataWrite, MetaUploadHandler},
+		{"GET", "/meta/:site/delete", PermDataDelete, MetaDeleteHandler},
+		{"GET", "/meta/:site/import", PermDataWrite, MetaImportHandler},
+		{"GET", "/meta/:site/export", PermRead, MetaExportHandler},
+
+		{"GET", "/sites", PermRead, SitesHandler},
+		{"GET", "/site/:site", PermRead, SitesHandler},
+		{"GET", "/site/registration", PermSiteAdmin, SiteRegistrationHandler},
+		{"GET", "/site/:site/edit", PermSiteAdmin, SiteEditHandler},
+		{"GET", "/site/:site/credentials", PermSiteAdmin, SiteCredentialsHandler},
+		{"GET", "/site/:site/delete", PermSiteAdmin, SiteDeleteHandler},
+
+		{"GET", "/data/registration", PermDataWrite, DataRegistrationHandler},
+		{"GET", "/data/:site/upload", PermDataWrite, DataUploadHandler},
+		{"GET", "/data/:site/delete", PermDataDelete, DataDeleteHandler},
+
+		{"GET", "/storage/:site", PermRead, SiteBucketsHandler},
+		{"GET", "/storage/:site/:bucket", PermRead, BucketObjectsHandler},
+		{"GET", "/storage/:site/:bucket/*object", PermRead, ObjectHandler},
+		{"GET", "/storage/:site/create", PermStorageAdmin, S3CreateHandler},
+		{"GET", "/storage/:site/upload", PermDataWrite, S3UploadHandler},
+		{"GET", "/storage/:site/delete", PermStorageAdmin, S3DeleteHandler},
+		{"GET", "/storage/:site/upload/resumable/:id", PermDataWrite, ResumableStatusHandler},
+
+		{"GET", "/analytics", PermRead, AnalyticsHandler},
+		{"GET", "/discovery", PermRead, DiscoveryHandler},
+		{"GET", "/provenance", PermRead, ProvenanceHandler},
+		{"GET", "/project", PermRead, ProjectHandler},
+		{"GET", "/project/:page", PermRead, ProjectHandler},
+		{"GET", "/project/schemas", PermRead, ProjectSchemasHandler},
+		{"GET", "/project/schema/:project", PermRead, ProjectSchemaHandler},
+		{"GET", "/debug/vars", PermAdmin, gin.WrapH(expvar.Handler())},
+
+		// POST methods
+		{"POST", "/project/registration", PermAdmin, ProjectRegistrationPostHandler},
+		{"POST", "/project/schema", PermAdmin, ProjectSchemaPostHandler},
+
+		{"POST", "/site/registration", PermSiteAdmin, SiteRegistrationPostHandler},
+		{"POST", "/site/edit", PermSiteAdmin, SiteEditPostHandler},
+		{"POST", "/site/credentials", PermSiteAdmin, SiteCredentialsPostHandler},
+		{"POST", "/site/delete", PermSiteAdmin, SiteDeletePostHandler},
+
+		{"POST", "/data/registration", PermDataWrite, DataRegistrationPostHandler},
+		{"POST", "/datasets/queries", PermRead, DatasetQueryPostHandler},
+		{"POST", "/datasets/queries/delete", PermRead, DatasetQueryDeletePostHandler},
+
+		{"POST", "/storage/create", PermStorageAdmin, S3CreatePostHandler},
+		{"POST", "/storage/upload", PermDataWrite, S3UploadPostHandler},
+		{"POST", "/storage/delete", PermStorageAdmin, S3DeletePostHandler},
+		{"POST", "/storage/:site/upload/resumable", PermDataWrite, ResumableCreateHandler},
+		{"POST", "/storage/:site/upload/resumable/:id/complete", PermDataWrite, ResumableCompleteHandler},
+
+		{"POST", "/meta/upload", PermDataWrite, MetaUploadPostHandler},
+		{"POST", "/meta/delete", PermDataDelete, MetaDeletePostHandler},
+		{"POST", "/meta/revert", PermDataWrite, MetaRevertPostHandler},
+		{"POST", "/meta/:site/import", PermDataWrite, MetaImportPostHandler},
+
+		{"POST", "/data/upload", PermDataWrite, DataUploadPostHandler},
+		{"POST", "/data/delete", PermDataDelete, DataDeletePostHandler},
+		{"POST", "/data/copy", PermDataWrite, DataCopyPostHandler},
+
+		// PUT methods
+		{"PUT", "/storage/:site/upload/resumable/:id/:part", PermDataWrite, ResumablePartHandler},
+
+		// DELETE methods
+		{"DELETE", "/storage/:site/upload/resumable/:id", PermDataWrite, ResumableAbortHandler},
+	}
+}
+
 // helper function which sets gin router and defines all our server end-points
 func setupRouter() *gin.Engine {
 	// Disable Console Color
@@ -61,6 +152,7 @@ func setupRouter() *gin.Engine {
 	r.GET("/login", LoginHandler)
 	r.GET("/logout", LogoutHandler)
 	r.GET("/user/registration", UserRegistryHandler)
+	r.GET("/openapi.json", OpenAPIHandler(r))
 
 	// captcha access
 	r.GET("/captcha/:file", CaptchaHandler())
@@ -69,55 +161,20 @@ func setupRouter() *gin.Engine {
 	r.POST("/login", LoginPostHandler)
 	r.POST("/user/registration", UserRegistryPostHandler)
 
-	// all other methods ahould be authorized
+	// all other methods ahould be authorized and each of them requires
+	// specific permission, see rbac.go
 	authorized.Use(AuthMiddleware())
-	{
-		// GET methods
-		authorized.GET("/datasets", DatasetHandler)
-		authorized.GET("/dataset/:dataset", DatasetHandler)
-
-		authorized.GET("/meta", MetaDataHandler)
-		authorized.GET("/meta/record/:mid/:site", MetaRecordHandler)
-		authorized.GET("/meta/:site", MetaSiteHandler)
-		authorized.GET("/meta/:site/upload", MetaUploadHandler)
-		authorized.GET("/meta/:site/delete", MetaDeleteHandler)
-
-		authorized.GET("/sites", SitesHandler)
-		authorized.GET("/site/:site", SitesHandler)
-		authorized.GET("/site/registration", SiteRegistrationHandler)
-
-		authorized.GET("/data/registration", DataRegistrationHandler)
-		authorized.GET("/data/:site/upload", DataUploadHandler)
-		authorized.GET("/data/:site/delete", DataDeleteHandler)
-
-		authorized.GET("/storage/:site", SiteBucketsHandler)
-		authorized.GET("/storage/:site/:bucket", BucketObjectsHandler)
-		authorized.GET("/storage/:site/create", S3CreateHandler)
-		authorized.GET("/storage/:site/upload", S3UploadHandler)
-		authorized.GET("/storage/:site/delete", S3DeleteHandler)
-
-		authorized.GET("/analytics", AnalyticsHandler)
-		authorized.GET("/discovery", DiscoveryHandler)
-		authorized.GET("/provenance", ProvenanceHandler)
-		authorized.GET("/project", ProjectHandler)
-		authorized.GET("/project/:page", ProjectHandler)
-
-		// POST methods
-		authorized.POST("/project/registration", ProjectRegistrationPostHandler)
-
-		authorized.POST("/site/registration", SiteRegistrationPostHandler)
-
-		authorized.POST("/data/registration", DataRegistrationPostHandler)
-
-		authorized.POST("/storage/create", S3CreatePostHandler)
-		authorized.POST("/storage/upload", S3UploadPostHandler)
-		authorized.POST("/storage/delete", S3DeletePostHandler)
-
-		authorized.POST("/meta/upload", MetaUploadPostHandler)
-		authorized.POST("/meta/delete", MetaDeletePostHandler)
+	for _, route := range authorizedRoutes() {
+		authorized.Handle(route.Method, route.Path, RequirePermission(route.Permission), route.Handler)
+	}
 
-		authorized.POST("/data/upload", DataUploadPostHandler)
-		authorized.POST("/data/delete", DataDeletePostHandler)
+	// JSON API mirror of authorized pages, see api.go
+	api := r.Group(apiPrefix)
+	api.Use(AuthMiddleware())
+	for _, route := range authorizedRoutes() {
+		if apiPaths[route.Path] {
+			api.Handle(route.Method, route.Path, RequirePermission(route.Permission), route.Handler)
+		}
 	}
 
 	// static files
@@ -136,6 +193,27 @@ func setupRouter() *gin.Engine {
 
 // Server defines our HTTP server
 func Server() {
+	if err := initSessions(); err != nil {
+		log.Fatal("ERROR: unable to initialize session store ", err)
+	}
+	if err := initPolicy(); err != nil {
+		log.Fatal("ERROR: unable to load policy file ", err)
+	}
+	if err := initSchemas(); err != nil {
+		log.Fatal("ERROR: unable to initialize project schemas ", err)
+	}
+	if err := initHistory(); err != nil {
+		log.Fatal("ERROR: unable to open meta-data history file ", err)
+	}
+	if err := initQueries(); err != nil {
+		log.Fatal("ERROR: unable to open dataset queries file ", err)
+	}
+	if err := initUploads(); err != nil {
+		log.Fatal("ERROR: unable to open resumable uploads file ", err)
+	}
+	initServices()
+	go expireUploads()
+	_accessLog.fname = frontendConfig.AccessLog
 	r := setupRouter()
 	sport := fmt.Sprintf(":%d", oreConfig.Config.Frontend.WebServer.Port)
 	log.Printf("Start HTTP server %s", sport)
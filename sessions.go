@@ -0,0 +1,477 @@
+package main
+
+// sessions module
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	oreConfig "github.com/OreCast/common/config"
+	"github.com/gin-gonic/gin"
+	"github.com/gomodule/redigo/redis"
+	bolt "go.etcd.io/bbolt"
+)
+
+// sessionCookie defines name of the cookie which holds signed session id
+const sessionCookie = "orecast_session"
+
+// ErrNoSession is returned when session is not found or expired
+var ErrNoSession = errors.New("no valid session")
+
+// Session represents user session stored on server side
+type Session struct {
+	ID         string     `json:"id"`
+	User       string     `json:"user"`
+	Token      *UserToken `json:"token"`
+	Flashes    []string   `json:"flashes"`
+	Created    time.Time  `json:"created"`
+	LastAccess time.Time  `json:"last_access"`
+}
+
+// AddFlash adds flash message to the session, it will be shown on next page
+func (s *Session) AddFlash(msg string) {
+	s.Flashes = append(s.Flashes, msg)
+}
+
+// Expired checks if session reached its idle or absolute timeout
+func (s *Session) Expired(idle, maxAge time.Duration) bool {
+	now := time.Now()
+	if maxAge > 0 && now.After(s.Created.Add(maxAge)) {
+		return true
+	}
+	if idle > 0 && now.After(s.LastAccess.Add(idle)) {
+		return true
+	}
+	return false
+}
+
+// SessionStore defines interface of session backends
+type SessionStore interface {
+	Get(id string) (*Session, error)
+	Save(s *Session, ttl time.Duration) error
+	Delete(id string) error
+	Purge(expired func(s *Session) bool) error
+}
+
+// MemoryStore keeps sessions in memory of the server
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+}
+
+// NewMemoryStore creates new instance of MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string]Session)}
+}
+
+// Get implements SessionStore Get API
+func (m *MemoryStore) Get(id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.sessions[id]; ok {
+		return &s, nil
+	}
+	return nil, ErrNoSession
+}
+
+// Save implements SessionStore Save API
+func (m *MemoryStore) Save(s *Session, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[s.ID] = *s
+	return nil
+}
+
+// Delete implements SessionStore Delete API
+func (m *MemoryStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+// Purge implements SessionStore Purge API
+func (m *MemoryStore) Purge(expired func(s *Session) bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, s := range m.sessions {
+		if expired(&s) {
+			delete(m.sessions, id)
+		}
+	}
+	return nil
+}
+
+// sessionBucket defines name of BoltDB bucket used by FileStore
+var sessionBucket = []byte("sessions")
+
+// FileStore keeps sessions in BoltDB file
+type FileStore struct {
+	db *bolt.DB
+}
+
+// NewFileStore creates new instance of FileStore
+func NewFileStore(fname string) (*FileStore, error) {
+	db, err := bolt.Open(fname, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(sessionBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &FileStore{db: db}, nil
+}
+
+// Get implements SessionStore Get API
+func (f *FileStore) Get(id string) (*Session, error) {
+	var data []byte
+	err := f.db.View(func(tx *bolt.Tx) error {
+		if val := tx.Bucket(sessionBucket).Get([]byte(id)); val != nil {
+			data = append(data, val...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, ErrNoSession
+	}
+	var s Session
+	err = json.Unmarshal(data, &s)
+	return &s, err
+}
+
+// Save implements SessionStore Save API
+func (f *FileStore) Save(s *Session, ttl time.Duration) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return f.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionBucket).Put([]byte(s.ID), data)
+	})
+}
+
+// Delete implements SessionStore Delete API
+func (f *FileStore) Delete(id string) error {
+	return f.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionBucket).Delete([]byte(id))
+	})
+}
+
+// Purge implements SessionStore Purge API
+func (f *FileStore) Purge(expired func(s *Session) bool) error {
+	return f.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(sessionBucket)
+		var ids [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			var s Session
+			if err := json.Unmarshal(v, &s); err != nil || expired(&s) {
+				ids = append(ids, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := bucket.Delete(id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RedisStore keeps sessions in redis-compatible key-value store
+type RedisStore struct {
+	pool   *redis.Pool
+	prefix string
+}
+
+// NewRedisStore creates new instance of RedisStore
+func NewRedisStore(addr string) *RedisStore {
+	pool := &redis.Pool{
+		MaxIdle:     10,
+		IdleTimeout: 240 * time.Second,
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", addr)
+		},
+	}
+	return &RedisStore{pool: pool, prefix: "orecast:session:"}
+}
+
+// Get implements SessionStore Get API
+func (r *RedisStore) Get(id string) (*Session, error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+	data, err := redis.Bytes(conn.Do("GET", r.prefix+id))
+	if err == redis.ErrNil {
+		return nil, ErrNoSession
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s Session
+	err = json.Unmarshal(data, &s)
+	return &s, err
+}
+
+// Save implements SessionStore Save API
+func (r *RedisStore) Save(s *Session, ttl time.Duration) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	conn := r.pool.Get()
+	defer conn.Close()
+	if ttl > 0 {
+		_, err = conn.Do("SET", r.prefix+s.ID, data, "EX", int64(ttl.Seconds())+1)
+	} else {
+		_, err = conn.Do("SET", r.prefix+s.ID, data)
+	}
+	return err
+}
+
+// Delete implements SessionStore Delete API
+func (r *RedisStore) Delete(id string) error {
+	conn := r.pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("DEL", r.prefix+id)
+	return err
+}
+
+// Purge implements SessionStore Purge API, redis expires keys on its own
+func (r *RedisStore) Purge(expired func(s *Session) bool) error {
+	return nil
+}
+
+// SessionManager manages user sessions and their cookies
+type SessionManager struct {
+	Store       SessionStore
+	Secret      []byte
+	IdleTimeout time.Duration
+	MaxAge      time.Duration
+}
+
+// _sessions holds session manager used by all end-points
+var _sessions *SessionManager
+
+// helper function to initialize session manager from frontend configuration
+func initSessions() error {
+	var store SessionStore
+	var err error
+	switch frontendConfig.SessionBackend {
+	case "memory":
+		store = NewMemoryStore()
+	case "file", "bolt", "boltdb":
+		store, err = NewFileStore(frontendConfig.SessionFile)
+		if err != nil {
+			return err
+		}
+	case "redis":
+		store = NewRedisStore(frontendConfig.SessionRedis)
+	default:
+		return fmt.Errorf("unsupported session backend %s", frontendConfig.SessionBackend)
+	}
+	if frontendConfig.SessionSecret == "" {
+		return errors.New("empty session secret")
+	}
+	_sessions = &SessionManager{
+		Store:       store,
+		Secret:      []byte(frontendConfig.SessionSecret),
+		IdleTimeout: time.Duration(frontendConfig.SessionIdleTimeout) * time.Second,
+		MaxAge:      time.Duration(frontendConfig.SessionMaxAge) * time.Second,
+	}
+	go _sessions.cleanup()
+	return nil
+}
+
+// helper function to periodically remove expired sessions from the store
+func (m *SessionManager) cleanup() {
+	interval := m.IdleTimeout
+	if interval <= 0 || interval > time.Hour {
+		interval = time.Hour
+	}
+	for {
+		time.Sleep(interval)
+		if err := m.Store.Purge(m.expired); err != nil {
+			log.Println("ERROR: unable to purge expired sessions", err)
+		}
+	}
+}
+
+// helper function to check if given session is expired
+func (m *SessionManager) expired(s *Session) bool {
+	return s.Expired(m.IdleTimeout, m.MaxAge)
+}
+
+// helper function to sign session id
+func (m *SessionManager) sign(id string) string {
+	mac := hmac.New(sha256.New, m.Secret)
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// helper function to verify signed cookie value and extract session id from it
+func (m *SessionManager) verify(value string) (string, error) {
+	arr := strings.Split(value, ".")
+	if len(arr) != 2 {
+		return "", errors.New("malformed session cookie")
+	}
+	if !hmac.Equal([]byte(m.sign(arr[0])), []byte(arr[1])) {
+		return "", errors.New("invalid session cookie signature")
+	}
+	return arr[0], nil
+}
+
+// helper function to set session cookie
+func (m *SessionManager) setCookie(c *gin.Context, s *Session) {
+	maxAge := int(time.Until(s.Created.Add(m.MaxAge)).Seconds())
+	value := fmt.Sprintf("%s.%s", s.ID, m.sign(s.ID))
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookie, value, maxAge, "/", "", c.Request.TLS != nil, true)
+}
+
+// New creates new session for given user and sets its cookie, any existing
+// session of the request is invalidated
+func (m *SessionManager) New(c *gin.Context, user string, token *UserToken) (*Session, error) {
+	m.Destroy(c)
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	s := &Session{
+		ID:         hex.EncodeToString(buf),
+		User:       user,
+		Token:      token,
+		Created:    now,
+		LastAccess: now,
+	}
+	if err := m.Store.Save(s, m.MaxAge); err != nil {
+		return nil, err
+	}
+	m.setCookie(c, s)
+	c.Set("session", s)
+	return s, nil
+}
+
+// Load loads session of given request, it returns ErrNoSession if session
+// does not exist, its cookie is invalid or session is expired
+func (m *SessionManager) Load(c *gin.Context) (*Session, error) {
+	if val, ok := c.Get("session"); ok {
+		if s, ok := val.(*Session); ok {
+			return s, nil
+		}
+	}
+	value, err := c.Cookie(sessionCookie)
+	if err != nil || value == "" {
+		return nil, ErrNoSession
+	}
+	id, err := m.verify(value)
+	if err != nil {
+		log.Printf("WARNING: %v, remote %s", err, c.ClientIP())
+		return nil, ErrNoSession
+	}
+	s, err := m.Store.Get(id)
+	if err != nil {
+		if err != ErrNoSession {
+			log.Println("ERROR: unable to load session", err)
+		}
+		return nil, ErrNoSession
+	}
+	if m.expired(s) {
+		m.Store.Delete(id)
+		return nil, ErrNoSession
+	}
+	s.LastAccess = time.Now()
+	if err := m.Save(s); err != nil {
+		log.Println("ERROR: unable to save session", err)
+	}
+	c.Set("session", s)
+	return s, nil
+}
+
+// Save stores given session in session store
+func (m *SessionManager) Save(s *Session) error {
+	return m.Store.Save(s, time.Until(s.Created.Add(m.MaxAge)))
+}
+
+// Destroy invalidates session of given request on server side and removes its cookie
+func (m *SessionManager) Destroy(c *gin.Context) {
+	if value, err := c.Cookie(sessionCookie); err == nil {
+		if id, err := m.verify(value); err == nil {
+			if err := m.Store.Delete(id); err != nil {
+				log.Println("ERROR: unable to delete session", err)
+			}
+		}
+	}
+	c.Set("session", nil)
+	c.SetCookie(sessionCookie, "", -1, "/", "", c.Request.TLS != nil, true)
+}
+
+// helper function to load session of the request (if any) and set its user in
+// gin context, it is used by end-points which do not require authorization
+func sessionUser(c *gin.Context) string {
+	s, err := _sessions.Load(c)
+	if err != nil {
+		return ""
+	}
+	c.Set("user", s.User)
+	c.Set("token", s.Token)
+	if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
+		log.Printf("user from session: '%s'", s.User)
+	}
+	return s.User
+}
+
+// helper function to add flash message to the session of given request
+func addFlash(c *gin.Context, msg string) {
+	s, err := _sessions.Load(c)
+	if err != nil {
+		return
+	}
+	s.AddFlash(msg)
+	if err := _sessions.Save(s); err != nil {
+		log.Println("ERROR: unable to save session", err)
+	}
+}
+
+// helper function to pop flash messages from the session of given request
+func popFlashes(c *gin.Context) []string {
+	val, ok := c.Get("session")
+	if !ok {
+		return nil
+	}
+	s, ok := val.(*Session)
+	if !ok || s == nil || len(s.Flashes) == 0 {
+		return nil
+	}
+	flashes := s.Flashes
+	s.Flashes = nil
+	if err := _sessions.Save(s); err != nil {
+		log.Println("ERROR: unable to save session", err)
+	}
+	return flashes
+}
@@ -0,0 +1,324 @@
+package main
+
+// sessions tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeRedis implements minimal subset of redis protocol (GET, SET, DEL)
+// used by RedisStore
+type fakeRedis struct {
+	mu   sync.Mutex
+	data map[string]string
+	ttl  map[string]string
+}
+
+// helper function to start fake redis server
+func startFakeRedis(t *testing.T) (*fakeRedis, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	srv := &fakeRedis{data: make(map[string]string), ttl: make(map[string]string)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+	return srv, ln.Addr().String()
+}
+
+// helper function to serve redis connection
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(rd)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		var reply string
+		switch strings.ToUpper(args[0]) {
+		case "GET":
+			if val, ok := f.data[args[1]]; ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(val), val)
+			} else {
+				reply = "$-1\r\n"
+			}
+		case "SET":
+			f.data[args[1]] = args[2]
+			if len(args) == 5 && strings.ToUpper(args[3]) == "EX" {
+				f.ttl[args[1]] = args[4]
+			}
+			reply = "+OK\r\n"
+		case "DEL":
+			n := 0
+			for _, key := range args[1:] {
+				if _, ok := f.data[key]; ok {
+					delete(f.data, key)
+					n++
+				}
+			}
+			reply = fmt.Sprintf(":%d\r\n", n)
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		f.mu.Unlock()
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+// helper function to read redis command sent as array of bulk strings
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("unexpected command %q", line)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	var args []string
+	for i := 0; i < n; i++ {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+// TestSessionSignVerify tests signing and verification of session cookies
+func TestSessionSignVerify(t *testing.T) {
+	m := &SessionManager{Secret: []byte("secret")}
+	other := &SessionManager{Secret: []byte("other")}
+	id := "abc123"
+	valid := id + "." + m.sign(id)
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{"valid", valid, false},
+		{"no signature", id, true},
+		{"empty signature", id + ".", true},
+		{"extra part", valid + ".x", true},
+		{"wrong signature", id + "." + other.sign(id), true},
+		{"tampered id", "abc124." + m.sign(id), true},
+		{"empty", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := m.verify(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && got != id {
+				t.Errorf("got id %q, want %q", got, id)
+			}
+		})
+	}
+	if m.sign(id) == other.sign(id) {
+		t.Error("signatures of different secrets are equal")
+	}
+}
+
+// TestSessionExpired tests idle and absolute session timeouts
+func TestSessionExpired(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name       string
+		created    time.Time
+		lastAccess time.Time
+		idle       time.Duration
+		maxAge     time.Duration
+		want       bool
+	}{
+		{"fresh", now, now, time.Minute, time.Hour, false},
+		{"idle", now.Add(-10 * time.Minute), now.Add(-2 * time.Minute), time.Minute, time.Hour, true},
+		{"too old", now.Add(-2 * time.Hour), now, time.Minute, time.Hour, true},
+		{"no idle timeout", now.Add(-10 * time.Minute), now.Add(-5 * time.Minute), 0, time.Hour, false},
+		{"no max age", now.Add(-48 * time.Hour), now, time.Minute, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Session{Created: tt.created, LastAccess: tt.lastAccess}
+			if got := s.Expired(tt.idle, tt.maxAge); got != tt.want {
+				t.Errorf("Expired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSessionStores tests all session store backends
+func TestSessionStores(t *testing.T) {
+	fstore, err := NewFileStore(filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fstore.db.Close() })
+	redisSrv, addr := startFakeRedis(t)
+	stores := []struct {
+		name  string
+		store SessionStore
+		purge bool
+	}{
+		{"memory", NewMemoryStore(), true},
+		{"file", fstore, true},
+		{"redis", NewRedisStore(addr), false},
+	}
+	for _, tt := range stores {
+		t.Run(tt.name, func(t *testing.T) {
+			store := tt.store
+			if _, err := store.Get("missing"); err != ErrNoSession {
+				t.Fatalf("got error %v for missing session, want %v", err, ErrNoSession)
+			}
+			now := time.Now().Truncate(time.Second)
+			s := &Session{ID: "s1", User: "alice", Created: now, LastAccess: now}
+			s.AddFlash("welcome")
+			if err := store.Save(s, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			got, err := store.Get("s1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.User != "alice" || len(got.Flashes) != 1 || !got.Created.Equal(now) {
+				t.Errorf("unexpected session %+v", got)
+			}
+			old := &Session{ID: "s2", User: "bob", Created: now.Add(-2 * time.Hour), LastAccess: now}
+			if err := store.Save(old, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			err = store.Purge(func(s *Session) bool { return s.Expired(0, time.Hour) })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.Get("s2"); tt.purge && err != ErrNoSession {
+				t.Errorf("expired session is not purged, error %v", err)
+			}
+			if _, err := store.Get("s1"); err != nil {
+				t.Errorf("valid session is purged, error %v", err)
+			}
+			if err := store.Delete("s1"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.Get("s1"); err != ErrNoSession {
+				t.Errorf("got error %v for deleted session, want %v", err, ErrNoSession)
+			}
+		})
+	}
+	// redis store relies on key expiration instead of purging
+	redisSrv.mu.Lock()
+	defer redisSrv.mu.Unlock()
+	if ttl := redisSrv.ttl["orecast:session:s1"]; ttl != "3601" {
+		t.Errorf("redis session expiration %q, want 3601", ttl)
+	}
+}
+
+// TestSessionManager tests creation, loading and destruction of sessions via cookies
+func TestSessionManager(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := &SessionManager{
+		Store:       NewMemoryStore(),
+		Secret:      []byte("secret"),
+		IdleTimeout: time.Minute,
+		MaxAge:      time.Hour,
+	}
+	// helper function to create gin context with given cookie
+	request := func(cookie *http.Cookie) (*gin.Context, *httptest.ResponseRecorder) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		if cookie != nil {
+			c.Request.AddCookie(cookie)
+		}
+		return c, w
+	}
+
+	c, w := request(nil)
+	s, err := m.New(c, "alice", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) == 0 || cookies[len(cookies)-1].Name != sessionCookie {
+		t.Fatalf("session cookie is not set, cookies %v", cookies)
+	}
+	cookie := cookies[len(cookies)-1]
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("unexpected cookie attributes %+v", cookie)
+	}
+
+	c, _ = request(cookie)
+	got, err := m.Load(c)
+	if err != nil || got.ID != s.ID || got.User != "alice" {
+		t.Fatalf("unable to load session: %v %+v", err, got)
+	}
+
+	// tampered cookie is rejected
+	c, _ = request(&http.Cookie{Name: sessionCookie, Value: s.ID + ".forged"})
+	if _, err := m.Load(c); err != ErrNoSession {
+		t.Errorf("tampered cookie is accepted, error %v", err)
+	}
+
+	// idle session is removed from the store
+	s.LastAccess = time.Now().Add(-2 * time.Minute)
+	m.Store.Save(s, time.Hour)
+	c, _ = request(cookie)
+	if _, err := m.Load(c); err != ErrNoSession {
+		t.Errorf("idle session is accepted, error %v", err)
+	}
+	if _, err := m.Store.Get(s.ID); err != ErrNoSession {
+		t.Errorf("idle session is kept in the store, error %v", err)
+	}
+
+	// destroyed session can not be loaded anymore
+	c, w = request(nil)
+	s, _ = m.New(c, "bob", nil)
+	cookies = w.Result().Cookies()
+	cookie = cookies[len(cookies)-1]
+	c, _ = request(cookie)
+	m.Destroy(c)
+	if _, err := m.Store.Get(s.ID); err != ErrNoSession {
+		t.Errorf("destroyed session is kept in the store, error %v", err)
+	}
+}
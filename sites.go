@@ -1,43 +1,26 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"log"
+	"strings"
+	"time"
 
+	"github.com/OreCast/Frontend/client"
 	oreConfig "github.com/OreCast/common/config"
+	"github.com/gin-gonic/gin"
 	cryptoutils "github.com/vkuznet/cryptoutils"
 )
 
 // Site represents Site object returned from discovery service
-type Site struct {
-	Name         string `json:"name" form:"name" binding:"required"`
-	URL          string `json:"url" form:"url" binding:"required"`
-	Endpoint     string `json:"endpoint" form:"endpoint" binding:"required"`
-	AccessKey    string `json:"access_key" form:"access_key" binding:"required"`
-	AccessSecret string `json:"access_secret" form:"access_secret" binding:"required"`
-	UseSSL       bool   `json:"use_ssl" form:"use_ssl"`
-	Description  string `json:"description" form:"description"`
-}
+type Site = client.Site
 
 // helper function to fetch sites info from discovery service
-func getSites() []Site {
-	var out []Site
-	rurl := fmt.Sprintf("%s/sites", oreConfig.Config.Services.DiscoveryURL)
-	resp, err := httpGet(rurl)
-	if err != nil {
-		log.Println("ERROR:", err)
-		return out
-	}
-	defer resp.Body.Close()
-	var results []Site
-	dec := json.NewDecoder(resp.Body)
-	if err := dec.Decode(&results); err != nil {
-		log.Println("ERROR:", err)
-		return out
-	}
-	return results
+func getSites(c *gin.Context) ([]Site, error) {
+	sites, err := _services.Discovery.Sites(serviceContext(c))
+	return sites, serviceError(c, err)
 }
 
 // SiteObject represents site object
@@ -46,78 +29,60 @@ type SiteObject struct {
 	Datasets []string
 }
 
-// DiscoveryRecord represents structure of data discovery record
-type DiscoveryRecord struct {
-	Name         string `json:"name"`
-	URL          string `json:"url"`
-	Endpoint     string `json:"endpoint""`
-	AccessKey    string `json:"access_key"`
-	AccessSecret string `json:"access_secret"`
-	UseSSL       bool   `json:"use_ssl"`
-}
-
-func site(site, bucket string) SiteObject {
-	surl := fmt.Sprintf("%s/sites", oreConfig.Config.Services.DiscoveryURL)
-	if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
-		log.Println("query", surl)
+// helper function to obtain S3 storage record of given site with decrypted credentials
+func siteStorage(c *gin.Context, site string) (S3, error) {
+	var s3 S3
+	rec, err := _services.Discovery.Site(serviceContext(c), site)
+	if err != nil {
+		serviceError(c, err)
+		log.Printf("ERROR: unable to get site %s from DataDiscovery service, error %v", site, err)
+		return s3, err
 	}
-	resp, err := httpGet(surl)
-	var siteObj SiteObject
+	log.Printf("INFO: found %s in DataDiscovery records, will access its s3 via %s", rec.Name, rec.URL)
+	s3, err = siteS3(rec)
 	if err != nil {
-		log.Printf("ERROR: unable to contact DataDiscovery service %s, error %v", surl, err)
-		return siteObj
+		return s3, err
+	}
+	if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
+		log.Printf("### will access %s with ssl=%v", s3.Endpoint, s3.UseSSL)
 	}
-	// read data discovery content
-	var records []DiscoveryRecord
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	return s3, nil
+}
+
+// helper function to obtain S3 storage of Discovery site record with decrypted credentials
+func siteS3(rec Site) (S3, error) {
+	var s3 S3
+	akey, err := cryptoutils.HexDecrypt(rec.AccessKey, oreConfig.Config.Encryption.Secret, oreConfig.Config.Encryption.Cipher)
 	if err != nil {
-		log.Printf("ERROR: unable to read DataDiscovery response, error %v", err)
-		return siteObj
+		log.Printf("ERROR: unable to decrypt data discovery access key, error %v", err)
+		return s3, err
 	}
-	err = json.Unmarshal(body, &records)
+	apwd, err := cryptoutils.HexDecrypt(rec.AccessSecret, oreConfig.Config.Encryption.Secret, oreConfig.Config.Encryption.Cipher)
 	if err != nil {
-		log.Printf("ERROR: unable to unmarshal DataDiscovery response, error %v", err)
-		return siteObj
+		log.Printf("ERROR: unable to decrypt data discovery acess secret, error %v", err)
+		return s3, err
 	}
-	if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
-		log.Printf("site records %+v", records)
+	s3 = S3{
+		Endpoint:     rec.Endpoint,
+		AccessKey:    string(akey),
+		AccessSecret: string(apwd),
+		UseSSL:       rec.UseSSL,
 	}
+	return s3, nil
+}
 
-	for _, rec := range records {
-		if rec.Name == site {
-			log.Printf("INFO: found %s in DataDiscovery records, will access its s3 via %s", rec.Name, rec.URL)
-			// bingo: we got desired site, now we can query its s3 storage for datasets
-			log.Println("###", rec.AccessKey, oreConfig.Config.Encryption.Secret, oreConfig.Config.Encryption.Cipher)
-			akey, err := cryptoutils.HexDecrypt(rec.AccessKey, oreConfig.Config.Encryption.Secret, oreConfig.Config.Encryption.Cipher)
-			if err != nil {
-				log.Printf("ERROR: unable to decrypt data discovery access key, error %v", err)
-				return siteObj
-
-			}
-			apwd, err := cryptoutils.HexDecrypt(rec.AccessSecret, oreConfig.Config.Encryption.Secret, oreConfig.Config.Encryption.Cipher)
-			if err != nil {
-				log.Printf("ERROR: unable to decrypt data discovery acess secret, error %v", err)
-				return siteObj
-
-			}
-			s3 := S3{
-				Endpoint:     rec.Endpoint,
-				AccessKey:    string(akey),
-				AccessSecret: string(apwd),
-				UseSSL:       rec.UseSSL,
-			}
-			if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
-				log.Printf("### will access %+v", s3)
-			}
-			obj := SiteObject{
-				Name:     site,
-				Datasets: datasets(s3, bucket),
-			}
-			return obj
-		}
+func site(c *gin.Context, site, bucket string) SiteObject {
+	var siteObj SiteObject
+	s3, err := siteStorage(c, site)
+	if err != nil {
+		return siteObj
+	}
+	// bingo: we got desired site, now we can query its s3 storage for datasets
+	obj := SiteObject{
+		Name:     site,
+		Datasets: datasets(s3, bucket),
 	}
-	return siteObj
+	return obj
 }
 
 // helper function to encrypt site attributes
@@ -136,3 +101,151 @@ func encryptSiteObject(site Site) (Site, error) {
 	}
 	return site, nil
 }
+
+// storageVerifyTimeout defines deadline of storage access check
+const storageVerifyTimeout = 10 * time.Second
+
+// helper function to check that S3 storage is accessible with its credentials
+func verifyStorage(ctx context.Context, s3 S3) error {
+	minioClient, err := s3Client(s3)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, storageVerifyTimeout)
+	defer cancel()
+	_, err = minioClient.ListBuckets(ctx)
+	return err
+}
+
+// SiteForm represents site edit form, site credentials are changed only by
+// SiteCredentialsForm
+type SiteForm struct {
+	Site        string `form:"site" json:"site" binding:"required"`
+	URL         string `form:"url" json:"url"`
+	Endpoint    string `form:"endpoint" json:"endpoint"`
+	UseSSL      bool   `form:"use_ssl" json:"use_ssl"`
+	Description string `form:"description" json:"description"`
+}
+
+// SiteCredentialsForm represents form to rotate S3 credentials of the site
+type SiteCredentialsForm struct {
+	Site         string `form:"site" json:"site" binding:"required"`
+	AccessKey    string `form:"access_key" json:"access_key"`
+	AccessSecret string `form:"access_secret" json:"access_secret"`
+}
+
+// SiteDeleteForm represents site deregistration form
+type SiteDeleteForm struct {
+	Site    string `form:"site" json:"site" binding:"required"`
+	Confirm string `form:"confirm" json:"confirm"` // name of the site typed by the user
+}
+
+// helper function to update site record with edit form, the storage should
+// stay accessible with current credentials if its endpoint is changed
+func editSite(c *gin.Context, form SiteForm) (Site, map[string]string, error) {
+	errs := make(map[string]string)
+	rec, err := _services.Discovery.Site(serviceContext(c), form.Site)
+	if err = serviceError(c, err); err != nil {
+		return rec, errs, err
+	}
+	if form.URL == "" {
+		errs["url"] = "this field is required"
+	}
+	if form.Endpoint == "" {
+		errs["endpoint"] = "this field is required"
+	} else if strings.Contains(form.Endpoint, "/") {
+		errs["endpoint"] = "endpoint should be host:port of S3 storage without scheme and path"
+	}
+	if len(errs) > 0 {
+		return rec, errs, nil
+	}
+	if form.Endpoint != rec.Endpoint || form.UseSSL != rec.UseSSL {
+		s3, err := siteS3(rec)
+		if err != nil {
+			return rec, errs, err
+		}
+		s3.Endpoint, s3.UseSSL = form.Endpoint, form.UseSSL
+		if err := verifyStorage(c.Request.Context(), s3); err != nil {
+			errs["endpoint"] = fmt.Sprintf("storage is not accessible with site credentials: %v", err)
+			return rec, errs, nil
+		}
+	}
+	rec.URL = form.URL
+	rec.Endpoint = form.Endpoint
+	rec.UseSSL = form.UseSSL
+	rec.Description = form.Description
+	err = _services.Discovery.UpdateSite(serviceContext(c), rec)
+	return rec, errs, serviceError(c, err)
+}
+
+// helper function to rotate S3 credentials of the site, new credentials are
+// stored only if storage is accessible with them, i.e. old credentials keep
+// working until new ones are verified
+func rotateSiteCredentials(c *gin.Context, form SiteCredentialsForm) (map[string]string, error) {
+	errs := make(map[string]string)
+	if form.AccessKey == "" {
+		errs["access_key"] = "this field is required"
+	}
+	if form.AccessSecret == "" {
+		errs["access_secret"] = "this field is required"
+	}
+	if len(errs) > 0 {
+		return errs, nil
+	}
+	rec, err := _services.Discovery.Site(serviceContext(c), form.Site)
+	if err = serviceError(c, err); err != nil {
+		return errs, err
+	}
+	s3 := S3{Endpoint: rec.Endpoint, AccessKey: form.AccessKey, AccessSecret: form.AccessSecret, UseSSL: rec.UseSSL}
+	if err := verifyStorage(c.Request.Context(), s3); err != nil {
+		errs["access_key"] = fmt.Sprintf("storage is not accessible with new credentials, current credentials are kept: %v", err)
+		return errs, nil
+	}
+	rec.AccessKey = form.AccessKey
+	rec.AccessSecret = form.AccessSecret
+	rec, err = encryptSiteObject(rec)
+	if err != nil {
+		return errs, err
+	}
+	err = _services.Discovery.UpdateSite(serviceContext(c), rec)
+	return errs, serviceError(c, err)
+}
+
+// SiteImpact represents resources which become orphaned if site is deregistered
+type SiteImpact struct {
+	Site        string   `json:"site"`
+	Buckets     []string `json:"buckets"`
+	Datasets    []string `json:"datasets"`
+	MetaRecords int      `json:"meta_records"`
+	Warnings    []string `json:"warnings,omitempty"` // checks which could not be done
+}
+
+// helper function to find buckets, datasets and meta-data records of the
+// site which become orphaned once site is deregistered
+func siteImpact(c *gin.Context, site string) SiteImpact {
+	impact := SiteImpact{Site: site, Buckets: []string{}, Datasets: []string{}}
+	if buckets, err := getBuckets(c, site); err == nil {
+		for _, b := range buckets {
+			impact.Buckets = append(impact.Buckets, b.Name)
+		}
+	} else {
+		impact.Warnings = append(impact.Warnings, fmt.Sprintf("unable to list buckets of the site: %v", err))
+	}
+	if records, err := getDatasets(c, ""); err == nil {
+		var selected []DBSRecord
+		for _, r := range records {
+			if r.Site == site {
+				selected = append(selected, r)
+			}
+		}
+		impact.Datasets = append(impact.Datasets, datasetNames(selected)...)
+	} else {
+		impact.Warnings = append(impact.Warnings, fmt.Sprintf("unable to list datasets of the site: %v", err))
+	}
+	if records, err := metadata(c, site); err == nil {
+		impact.MetaRecords = len(records)
+	} else if !errors.Is(err, client.ErrNotFound) {
+		impact.Warnings = append(impact.Warnings, fmt.Sprintf("unable to list meta-data records of the site: %v", err))
+	}
+	return impact
+}
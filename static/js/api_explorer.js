@@ -0,0 +1,164 @@
+// API explorer renders OpenAPI specification of OreCast frontend and allows
+// to try its end-points from the browser using current user session
+function ApiExplorer(base, tag) {
+    var root = document.getElementById(tag);
+    fetch(base + '/openapi.json', {credentials: 'same-origin'})
+        .then(function(resp) { return resp.json(); })
+        .then(function(spec) { renderSpec(spec, base, root); })
+        .catch(function(err) {
+            root.textContent = 'unable to load OpenAPI specification: ' + err;
+        });
+}
+
+// helper function to create DOM element with given class and text
+function apiElement(name, cls, text) {
+    var el = document.createElement(name);
+    if (cls) {
+        el.className = cls;
+    }
+    if (text) {
+        el.textContent = text;
+    }
+    return el;
+}
+
+// helper function to resolve $ref of the schema
+function apiSchema(spec, schema) {
+    if (schema && schema['$ref']) {
+        var name = schema['$ref'].split('/').pop();
+        return spec.components.schemas[name];
+    }
+    return schema;
+}
+
+// helper function to render all operations grouped by their tags
+function renderSpec(spec, base, root) {
+    root.textContent = '';
+    var groups = {};
+    Object.keys(spec.paths).forEach(function(path) {
+        var ops = spec.paths[path];
+        Object.keys(ops).forEach(function(method) {
+            var op = ops[method];
+            var tag = op.tags[0];
+            if (!groups[tag]) {
+                groups[tag] = [];
+            }
+            groups[tag].push({path: path, method: method, op: op});
+        });
+    });
+    spec.tags.forEach(function(t) {
+        var ops = groups[t.name] || [];
+        root.appendChild(apiElement('h3', '', t.name));
+        ops.forEach(function(entry) {
+            root.appendChild(renderOperation(spec, base, entry));
+        });
+    });
+}
+
+// helper function to render single operation with its try-out form
+function renderOperation(spec, base, entry) {
+    var op = entry.op;
+    var box = apiElement('div', 'box');
+    box.style.marginBottom = '8px';
+    var header = apiElement('div', '');
+    header.style.cursor = 'pointer';
+    header.appendChild(apiElement('span', 'label label-primary', entry.method.toUpperCase()));
+    header.appendChild(apiElement('code', '', ' ' + entry.path + ' '));
+    header.appendChild(apiElement('span', 'hint', op.summary + (op['x-permission'] ? ' (requires ' + op['x-permission'] + ' permission)' : '')));
+    box.appendChild(header);
+
+    var form = apiElement('form', 'form hide');
+    var inputs = [];
+    (op.parameters || []).forEach(function(p) {
+        var item = apiElement('div', 'form-item');
+        item.appendChild(apiElement('label', '', p.name + ' (' + p.in + ')' + (p.required ? ' *' : '')));
+        var input = apiElement('input', 'input');
+        input.name = p.name;
+        item.appendChild(input);
+        form.appendChild(item);
+        inputs.push({param: p, input: input});
+    });
+    var body = null;
+    var ctype = '';
+    if (op.requestBody) {
+        ctype = Object.keys(op.requestBody.content)[0];
+        var schema = apiSchema(spec, op.requestBody.content[ctype].schema);
+        if (schema && schema.properties) {
+            Object.keys(schema.properties).forEach(function(name) {
+                var prop = schema.properties[name];
+                var item = apiElement('div', 'form-item');
+                item.appendChild(apiElement('label', '', name + ' (body)'));
+                var input = apiElement('input', 'input');
+                input.name = name;
+                if (prop.format == 'binary') {
+                    input.type = 'file';
+                }
+                item.appendChild(input);
+                form.appendChild(item);
+                inputs.push({body: true, input: input});
+            });
+        } else {
+            body = apiElement('textarea', 'input');
+            body.rows = 4;
+            var item = apiElement('div', 'form-item');
+            item.appendChild(apiElement('label', '', 'request body (' + ctype + ')'));
+            item.appendChild(body);
+            form.appendChild(item);
+        }
+    }
+    var button = apiElement('button', 'button button-small', 'Try it');
+    form.appendChild(button);
+    var output = apiElement('pre', '');
+    output.style.maxHeight = '400px';
+    output.style.overflow = 'auto';
+    form.appendChild(output);
+    box.appendChild(form);
+
+    header.onclick = function() {
+        form.className = form.className == 'form hide' ? 'form' : 'form hide';
+    };
+    form.onsubmit = function(e) {
+        e.preventDefault();
+        var path = entry.path;
+        var query = new URLSearchParams();
+        var data = ctype == 'multipart/form-data' ? new FormData() : new URLSearchParams();
+        inputs.forEach(function(i) {
+            if (i.body) {
+                if (i.input.type == 'file') {
+                    if (i.input.files.length > 0) {
+                        data.append(i.input.name, i.input.files[0]);
+                    }
+                } else if (i.input.value != '') {
+                    data.append(i.input.name, i.input.value);
+                }
+            } else if (i.param.in == 'path') {
+                var val = i.input.value;
+                if (i.param.name != 'object') {
+                    val = encodeURIComponent(val);
+                }
+                path = path.replace('{' + i.param.name + '}', val);
+            } else if (i.input.value != '') {
+                query.append(i.param.name, i.input.value);
+            }
+        });
+        var url = base + path + (query.toString() ? '?' + query.toString() : '');
+        var opts = {method: entry.method.toUpperCase(), credentials: 'same-origin', headers: {'Accept': 'application/json'}};
+        if (op.requestBody) {
+            opts.body = body ? body.value : data;
+        }
+        output.textContent = opts.method + ' ' + url + '\n...';
+        fetch(url, opts).then(function(resp) {
+            return resp.text().then(function(text) {
+                try {
+                    text = JSON.stringify(JSON.parse(text), null, 2);
+                } catch (err) {
+                    // pages without JSON representation respond with HTML
+                }
+                output.textContent = opts.method + ' ' + url + '\n' + resp.status + ' ' + resp.statusText + '\n\n' + text;
+            });
+        }).catch(function(err) {
+            output.textContent = opts.method + ' ' + url + '\n' + err;
+        });
+    };
+    return box;
+}
@@ -0,0 +1,95 @@
+// interactive dataset lineage graph, see provenance.tmpl
+(function() {
+    var svg = document.getElementById('lineage-graph');
+    if (!svg) {
+        return;
+    }
+    var base = svg.getAttribute('data-base') || '';
+    var nodes = svg.querySelectorAll('.lineage-node');
+    var edges = svg.querySelectorAll('.lineage-edge');
+
+    // helper function to collect ancestors and descendants of the dataset
+    function lineage(dataset) {
+        var parents = {};
+        var children = {};
+        edges.forEach(function(e) {
+            var p = e.getAttribute('data-parent');
+            var c = e.getAttribute('data-child');
+            parents[c] = p;
+            (children[p] = children[p] || []).push(c);
+        });
+        var keep = {};
+        for (var d = dataset; d && !keep[d]; d = parents[d]) {
+            keep[d] = true;
+        }
+        var queue = [dataset];
+        while (queue.length > 0) {
+            (children[queue.shift()] || []).forEach(function(c) {
+                if (!keep[c]) {
+                    keep[c] = true;
+                    queue.push(c);
+                }
+            });
+        }
+        return keep;
+    }
+
+    // helper function to escape text shown in details panel
+    function escape(text) {
+        var div = document.createElement('div');
+        div.textContent = text || '';
+        return div.innerHTML;
+    }
+
+    // helper function to show details of the dataset
+    function details(node) {
+        var panel = document.getElementById('lineage-details');
+        var dataset = node.getAttribute('data-dataset');
+        var html = '<b>' + escape(dataset) + '</b>';
+        if (node.classList.contains('missing')) {
+            html += '<div class="hint">dataset is not registered in DataBookkeeping</div>';
+        } else {
+            var site = node.getAttribute('data-site');
+            var meta = node.getAttribute('data-meta');
+            html += '<div>processing: ' + escape(node.getAttribute('data-processing')) + '</div>';
+            html += '<div>site: <a href="' + base + '/site/' + encodeURIComponent(site) + '">' + escape(site) + '</a></div>';
+            if (meta) {
+                html += '<div>meta-data: <a href="' + base + '/meta/record/' + encodeURIComponent(meta) + '/' + encodeURIComponent(site) + '">' + escape(meta) + '</a></div>';
+            }
+            html += '<div>parent: ' + escape(node.getAttribute('data-parent') || 'none') + '</div>';
+            html += '<div>created: ' + escape(node.getAttribute('data-created')) + ' by ' + escape(node.getAttribute('data-user')) + '</div>';
+            html += '<div>modified: ' + escape(node.getAttribute('data-modified')) + '</div>';
+        }
+        if (!node.classList.contains('missing')) {
+            html += '<div><a href="' + base + '/dataset' + encodeURI(dataset) + '">dataset details</a></div>';
+        }
+        html += '<div><a href="' + base + '/provenance?dataset=' + encodeURIComponent(dataset) + '">show lineage of this dataset</a></div>';
+        panel.innerHTML = html;
+        panel.className = 'round show';
+    }
+
+    // helper function to highlight lineage of selected dataset
+    function select(node) {
+        var dataset = node.getAttribute('data-dataset');
+        var keep = lineage(dataset);
+        nodes.forEach(function(n) {
+            var d = n.getAttribute('data-dataset');
+            n.classList.toggle('selected', d === dataset);
+            n.classList.toggle('dimmed', !keep[d]);
+        });
+        edges.forEach(function(e) {
+            var related = keep[e.getAttribute('data-parent')] && keep[e.getAttribute('data-child')];
+            e.classList.toggle('dimmed', !related);
+        });
+        details(node);
+    }
+
+    nodes.forEach(function(node) {
+        node.addEventListener('click', function() {
+            select(node);
+        });
+        node.addEventListener('dblclick', function() {
+            load(base + '/provenance?dataset=' + encodeURIComponent(node.getAttribute('data-dataset')));
+        });
+    });
+})();
@@ -0,0 +1,153 @@
+// resumable upload of large files, see uploads.go for protocol description
+var uploadAborted = false;
+
+// helper function to build resumable upload url
+function uploadUrl(base, site, id, suffix) {
+    var url = base + '/storage/' + encodeURIComponent(site) + '/upload/resumable';
+    if (id) {
+        url += '/' + id;
+    }
+    if (suffix) {
+        url += '/' + suffix;
+    }
+    return url;
+}
+
+// helper function to show upload progress
+function uploadProgress(done, total, msg) {
+    var bar = document.getElementById('upload-progress');
+    var status = document.getElementById('upload-status');
+    if (bar) {
+        bar.max = total;
+        bar.value = done;
+    }
+    if (status) {
+        var pct = total > 0 ? Math.floor(100 * done / total) : 0;
+        status.innerHTML = pct + '% (' + done + ' of ' + total + ' bytes) ' + (msg || '');
+    }
+}
+
+// helper function to perform fetch call and decode its JSON response
+async function uploadCall(url, opts) {
+    var resp = await fetch(url, opts);
+    var data = await resp.json();
+    if (!resp.ok || data.status != 'ok') {
+        throw new Error(data.error || resp.statusText);
+    }
+    return data;
+}
+
+// helper function to upload single part with retries and jittered backoff
+async function uploadPart(url, blob) {
+    var delay = 1000;
+    for (var attempt = 1; ; attempt++) {
+        try {
+            return await uploadCall(url, {method: 'PUT', body: blob});
+        } catch (err) {
+            if (attempt >= 5 || uploadAborted) {
+                throw err;
+            }
+            uploadProgress(0, 0, 'retry ' + attempt + ': ' + err.message);
+            await new Promise(r => setTimeout(r, delay + Math.random() * delay));
+            delay *= 2;
+        }
+    }
+}
+
+// ResumableUpload uploads file selected in upload form in parts, the upload
+// can be resumed later (e.g. after page reload) for the same file
+async function ResumableUpload(base, site) {
+    var form = document.getElementById('upload-form');
+    var file = form.elements['file'].files[0];
+    if (!file) {
+        alert('Please select a file');
+        return;
+    }
+    var bucket = form.elements['bucket'].value;
+    var object = form.elements['object'].value || file.name;
+    var key = 'orecast-upload:' + [site, bucket, object, file.size, file.lastModified].join(':');
+    uploadAborted = false;
+    ShowTag('upload-panel');
+    try {
+        // check if we have upload to resume
+        var id = localStorage.getItem(key);
+        var info = null;
+        if (id) {
+            try {
+                info = await uploadCall(uploadUrl(base, site, id));
+            } catch (err) {
+                localStorage.removeItem(key);
+                id = null;
+            }
+        }
+        if (!id) {
+            var params = new URLSearchParams({bucket: bucket, object: object, size: file.size});
+            var created = await uploadCall(uploadUrl(base, site), {method: 'POST', body: params});
+            id = created.id;
+            localStorage.setItem(key, id);
+            info = await uploadCall(uploadUrl(base, site, id));
+        }
+        document.getElementById('upload-id').value = id;
+
+        // find out which parts are already uploaded
+        var done = {};
+        var uploaded = 0;
+        (info.parts || []).forEach(function(p) {
+            var expect = Math.min(info.part_size, file.size - (p.number - 1) * info.part_size);
+            if (p.size == expect) {
+                done[p.number] = true;
+                uploaded += p.size;
+            }
+        });
+        uploadProgress(uploaded, file.size, 'resuming');
+
+        // upload missing parts
+        for (var part = 1; part <= info.nparts; part++) {
+            if (done[part]) {
+                continue;
+            }
+            if (uploadAborted) {
+                uploadProgress(uploaded, file.size, 'paused, submit the same file to resume');
+                return;
+            }
+            var start = (part - 1) * info.part_size;
+            var blob = file.slice(start, Math.min(start + info.part_size, file.size));
+            await uploadPart(uploadUrl(base, site, id, part), blob);
+            uploaded += blob.size;
+            uploadProgress(uploaded, file.size, 'part ' + part + ' of ' + info.nparts);
+        }
+
+        // complete the upload
+        var result = await uploadCall(uploadUrl(base, site, id, 'complete'), {method: 'POST'});
+        localStorage.removeItem(key);
+        uploadProgress(file.size, file.size, 'completed, ETag ' + result.etag);
+    } catch (err) {
+        uploadProgress(0, 0, 'failed: ' + err.message);
+    }
+}
+
+// PauseUpload stops current resumable upload after its current part
+function PauseUpload() {
+    uploadAborted = true;
+}
+
+// AbortUpload cancels current resumable upload and removes its uploaded parts
+async function AbortUpload(base, site) {
+    uploadAborted = true;
+    var id = document.getElementById('upload-id').value;
+    if (!id) {
+        return;
+    }
+    try {
+        await uploadCall(uploadUrl(base, site, id), {method: 'DELETE'});
+        for (var i = localStorage.length - 1; i >= 0; i--) {
+            var key = localStorage.key(i);
+            if (key.startsWith('orecast-upload:') && localStorage.getItem(key) == id) {
+                localStorage.removeItem(key);
+            }
+        }
+        uploadProgress(0, 0, 'aborted');
+    } catch (err) {
+        uploadProgress(0, 0, 'failed to abort: ' + err.message);
+    }
+}
@@ -1,9 +1,23 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
+	"io"
 	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 
 	minio "github.com/minio/minio-go/v7"
 	credentials "github.com/minio/minio-go/v7/pkg/credentials"
@@ -17,14 +31,19 @@ type S3 struct {
 	UseSSL       bool
 }
 
+// helper function to initialize minio client for given S3 storage
+func s3Client(s3 S3) (*minio.Client, error) {
+	return minio.New(s3.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(s3.AccessKey, s3.AccessSecret, ""),
+		Secure: s3.UseSSL,
+	})
+}
+
 func datasets(s3 S3, bucket string) []string {
 	var out []string
 	ctx := context.Background()
 	// Initialize minio client object.
-	minioClient, err := minio.New(s3.Endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(s3.AccessKey, s3.AccessSecret, ""),
-		Secure: s3.UseSSL,
-	})
+	minioClient, err := s3Client(s3)
 	if err != nil {
 		log.Println("ERROR", err)
 		return out
@@ -58,3 +77,540 @@ func datasets(s3 S3, bucket string) []string {
 	}
 	return out
 }
+
+// uploadPartSize defines size of the parts used by multipart uploads of
+// objects with unknown size, it limits memory used by single upload
+const uploadPartSize = 16 * 1024 * 1024
+
+// maxUploadParts defines maximum number of parts of S3 multipart upload
+const maxUploadParts = 10000
+
+// ErrTooLarge is returned when uploaded object exceeds allowed size
+var ErrTooLarge = errors.New("object exceeds maximum allowed size")
+
+// limitReader reads up to limit bytes and returns ErrTooLarge afterwards
+type limitReader struct {
+	reader io.Reader
+	limit  int64
+	size   int64
+}
+
+// Read implements io.Reader interface
+func (r *limitReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.size += int64(n)
+	if r.limit > 0 && r.size > r.limit {
+		return n, ErrTooLarge
+	}
+	return n, err
+}
+
+// etagHash computes S3 ETag of the stream uploaded in parts of given size
+type etagHash struct {
+	partSize int64
+	written  int64
+	whole    hash.Hash
+	part     hash.Hash
+	parts    []byte
+	nparts   int
+}
+
+// newETagHash creates new instance of etagHash
+func newETagHash(partSize int64) *etagHash {
+	return &etagHash{partSize: partSize, whole: md5.New(), part: md5.New()}
+}
+
+// Write implements io.Writer interface
+func (e *etagHash) Write(p []byte) (int, error) {
+	e.whole.Write(p)
+	total := len(p)
+	for len(p) > 0 {
+		n := int64(len(p))
+		if left := e.partSize - e.written; n > left {
+			n = left
+		}
+		e.part.Write(p[:n])
+		e.written += n
+		p = p[n:]
+		if e.written == e.partSize {
+			e.closePart()
+		}
+	}
+	return total, nil
+}
+
+// helper function to finalize current part
+func (e *etagHash) closePart() {
+	e.parts = append(e.parts, e.part.Sum(nil)...)
+	e.nparts++
+	e.part = md5.New()
+	e.written = 0
+}
+
+// ETag returns expected ETag of single part or multipart upload
+func (e *etagHash) ETag(multipart bool) string {
+	if !multipart {
+		return hex.EncodeToString(e.whole.Sum(nil))
+	}
+	parts := e.parts
+	nparts := e.nparts
+	if e.written > 0 || nparts == 0 {
+		parts = append(parts, e.part.Sum(nil)...)
+		nparts++
+	}
+	sum := md5.Sum(parts)
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), nparts)
+}
+
+// helper function to detect content type of the object from its name and first bytes
+func detectContentType(name string, head []byte) string {
+	ctype := http.DetectContentType(head)
+	if ctype == "application/octet-stream" || strings.HasPrefix(ctype, "text/plain") {
+		if etype := mime.TypeByExtension(strings.ToLower(filepath.Ext(name))); etype != "" {
+			return etype
+		}
+	}
+	return ctype
+}
+
+// UploadResult represents result of object upload
+type UploadResult struct {
+	Bucket      string
+	Object      string
+	Size        int64
+	ETag        string
+	ContentType string
+}
+
+// helper function to stream given reader into S3 bucket object, it enforces
+// maximum object size, detects object content type and verifies ETag of
+// uploaded object
+func uploadObject(ctx context.Context, s3 S3, bucket, object string, reader io.Reader, maxSize int64) (UploadResult, error) {
+	result := UploadResult{Bucket: bucket, Object: object}
+	minioClient, err := s3Client(s3)
+	if err != nil {
+		return result, err
+	}
+
+	// peek into the stream to detect its content type
+	buf := bufio.NewReaderSize(reader, 512)
+	head, err := buf.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return result, err
+	}
+	result.ContentType = detectContentType(object, head)
+
+	// compute ETag of the stream while we upload it
+	etag := newETagHash(uploadPartSize)
+	lreader := &limitReader{reader: io.TeeReader(buf, etag), limit: maxSize}
+	opts := minio.PutObjectOptions{
+		ContentType:    result.ContentType,
+		PartSize:       uploadPartSize,
+		SendContentMd5: true,
+	}
+	info, err := minioClient.PutObject(ctx, bucket, object, lreader, -1, opts)
+	if err != nil {
+		if errors.Is(err, ErrTooLarge) || lreader.size > maxSize {
+			return result, ErrTooLarge
+		}
+		return result, err
+	}
+	result.Size = info.Size
+	result.ETag = info.ETag
+
+	// single part uploads have ETag equal to MD5 of the object, multipart
+	// uploads have ETag equal to MD5 of their parts MD5s and number of parts;
+	// other ETags can not be compared but every part is still verified by
+	// storage with its Content-MD5
+	objETag := strings.Trim(info.ETag, "\"")
+	if !comparableETag(ctx, minioClient, bucket, objETag) {
+		return result, nil
+	}
+	expect := etag.ETag(strings.Contains(objETag, "-"))
+	if !strings.EqualFold(objETag, expect) {
+		if err := minioClient.RemoveObject(ctx, bucket, object, minio.RemoveObjectOptions{}); err != nil {
+			log.Printf("ERROR: unable to remove corrupted object %s/%s, error %v", bucket, object, err)
+		}
+		return result, fmt.Errorf("ETag mismatch: object ETag %s, uploaded data ETag %s", objETag, expect)
+	}
+	return result, nil
+}
+
+// etagPattern matches ETag which is MD5 of the object or of its parts
+var etagPattern = regexp.MustCompile(`^[0-9a-fA-F]{32}(-[0-9]+)?$`)
+
+// helper function to check if ETag of uploaded object can be compared with
+// MD5 of uploaded data, objects of encrypted buckets (SSE-KMS, SSE-C) and
+// of some S3 compatible storages have ETag which is not MD5 of their data
+func comparableETag(ctx context.Context, minioClient *minio.Client, bucket, etag string) bool {
+	if !etagPattern.MatchString(etag) {
+		return false
+	}
+	// we compare ETags only if storage confirms that bucket is not encrypted
+	_, err := minioClient.GetBucketEncryption(ctx, bucket)
+	if err == nil {
+		return false
+	}
+	return minio.ToErrorResponse(err).Code == "ServerSideEncryptionConfigurationNotFoundError"
+}
+
+// inlineContentTypes lists content types of objects which are safe to be
+// rendered inline by the browser, other objects are always downloaded as
+// they may carry active content, e.g. HTML or SVG with scripts
+var inlineContentTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+	"image/bmp":  true,
+	"text/plain": true,
+}
+
+// helper function to check if object of given content type can be rendered inline
+func inlineContentType(ctype string) bool {
+	mtype, _, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		return false
+	}
+	return inlineContentTypes[mtype]
+}
+
+// helper function to open S3 object for reading
+func openObject(ctx context.Context, s3 S3, bucket, object string) (*minio.Object, minio.ObjectInfo, error) {
+	var info minio.ObjectInfo
+	minioClient, err := s3Client(s3)
+	if err != nil {
+		return nil, info, err
+	}
+	obj, err := minioClient.GetObject(ctx, bucket, object, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, info, err
+	}
+	info, err = obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, info, err
+	}
+	return obj, info, nil
+}
+
+// helper function to read first size bytes of the object using ranged S3 read
+func readObjectHead(ctx context.Context, s3 S3, bucket, object string, size int64) ([]byte, minio.ObjectInfo, error) {
+	var info minio.ObjectInfo
+	minioClient, err := s3Client(s3)
+	if err != nil {
+		return nil, info, err
+	}
+	info, err = minioClient.StatObject(ctx, bucket, object, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, info, err
+	}
+	if info.Size == 0 {
+		return []byte{}, info, nil
+	}
+	if size > info.Size {
+		size = info.Size
+	}
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(0, size-1); err != nil {
+		return nil, info, err
+	}
+	obj, err := minioClient.GetObject(ctx, bucket, object, opts)
+	if err != nil {
+		return nil, info, err
+	}
+	defer obj.Close()
+	data, err := io.ReadAll(io.LimitReader(obj, size))
+	return data, info, err
+}
+
+// helper function to create time-limited presigned GET url of S3 object
+func presignObject(ctx context.Context, s3 S3, bucket, object string, expires time.Duration) (*url.URL, error) {
+	minioClient, err := s3Client(s3)
+	if err != nil {
+		return nil, err
+	}
+	// make sure that object exists before we sign its url
+	if _, err := minioClient.StatObject(ctx, bucket, object, minio.StatObjectOptions{}); err != nil {
+		return nil, err
+	}
+	params := make(url.Values)
+	params.Set("response-content-disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(object)))
+	return minioClient.PresignedGetObject(ctx, bucket, object, expires, params)
+}
+
+// bulkMaxObjects defines maximum number of objects processed by single bulk operation
+const bulkMaxObjects = 10000
+
+// ObjectResult represents result of operation on individual S3 object
+type ObjectResult struct {
+	Object string `json:"object"`
+	Target string `json:"target,omitempty"`
+	Size   int64  `json:"size"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// helper function to resolve list of objects affected by bulk operation, it
+// combines explicitly provided objects and all objects under given prefix
+func resolveObjects(ctx context.Context, s3 S3, bucket, prefix string, names []string) ([]ObjectResult, error) {
+	var out []ObjectResult
+	minioClient, err := s3Client(s3)
+	if err != nil {
+		return out, err
+	}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		rec := ObjectResult{Object: name, Status: "ok"}
+		info, err := minioClient.StatObject(ctx, bucket, name, minio.StatObjectOptions{})
+		if err != nil {
+			rec.Status = "fail"
+			rec.Error = err.Error()
+		} else {
+			rec.Size = info.Size
+		}
+		out = append(out, rec)
+	}
+	if prefix == "" {
+		return out, nil
+	}
+	objectCh := minioClient.ListObjects(ctx, bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	})
+	for object := range objectCh {
+		if object.Err != nil {
+			return out, object.Err
+		}
+		if seen[object.Key] {
+			continue
+		}
+		seen[object.Key] = true
+		if len(out) >= bulkMaxObjects {
+			return out, fmt.Errorf("bulk operation is limited to %d objects", bulkMaxObjects)
+		}
+		out = append(out, ObjectResult{Object: object.Key, Size: object.Size, Status: "ok"})
+	}
+	return out, nil
+}
+
+// helper function to remove given objects from S3 bucket
+func removeObjects(ctx context.Context, s3 S3, bucket string, objects []ObjectResult) ([]ObjectResult, error) {
+	minioClient, err := s3Client(s3)
+	if err != nil {
+		return objects, err
+	}
+	objectsCh := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(objectsCh)
+		for _, obj := range objects {
+			if obj.Status == "ok" {
+				objectsCh <- minio.ObjectInfo{Key: obj.Object}
+			}
+		}
+	}()
+	failed := make(map[string]string)
+	for rerr := range minioClient.RemoveObjects(ctx, bucket, objectsCh, minio.RemoveObjectsOptions{}) {
+		failed[rerr.ObjectName] = rerr.Err.Error()
+	}
+	var out []ObjectResult
+	for _, obj := range objects {
+		if msg, ok := failed[obj.Object]; ok {
+			obj.Status = "fail"
+			obj.Error = msg
+		} else if obj.Status == "ok" {
+			obj.Status = "deleted"
+		}
+		out = append(out, obj)
+	}
+	return out, nil
+}
+
+// helper function to copy (or move) given objects to another bucket of the same site
+func copyObjects(ctx context.Context, s3 S3, bucket, target string, objects []ObjectResult, move bool) ([]ObjectResult, error) {
+	minioClient, err := s3Client(s3)
+	if err != nil {
+		return objects, err
+	}
+	var out []ObjectResult
+	for _, obj := range objects {
+		if obj.Status != "ok" {
+			out = append(out, obj)
+			continue
+		}
+		src := minio.CopySrcOptions{Bucket: bucket, Object: obj.Object}
+		dst := minio.CopyDestOptions{Bucket: target, Object: obj.Object}
+		obj.Target = fmt.Sprintf("%s/%s", target, obj.Object)
+		if obj.Size > maxCopySize {
+			// large objects are copied by parts via multipart upload
+			_, err = minioClient.ComposeObject(ctx, dst, src)
+		} else {
+			_, err = minioClient.CopyObject(ctx, dst, src)
+		}
+		if err == nil {
+			// copy is verified before its source can be removed
+			info, serr := minioClient.StatObject(ctx, target, obj.Object, minio.StatObjectOptions{})
+			if serr != nil {
+				err = serr
+			} else if info.Size != obj.Size {
+				err = fmt.Errorf("copy has %d bytes, source has %d bytes", info.Size, obj.Size)
+			}
+		}
+		if err != nil {
+			obj.Status = "fail"
+			obj.Error = err.Error()
+			out = append(out, obj)
+			continue
+		}
+		obj.Status = "copied"
+		// source is removed only after its copy is successfully completed
+		if move {
+			if err := minioClient.RemoveObject(ctx, bucket, obj.Object, minio.RemoveObjectOptions{}); err != nil {
+				obj.Status = "fail"
+				obj.Error = fmt.Sprintf("copied but source is not removed: %v", err)
+			} else {
+				obj.Status = "moved"
+			}
+		}
+		out = append(out, obj)
+	}
+	return out, nil
+}
+
+// maxCopySize defines maximum size of object copied by single S3 copy request
+const maxCopySize = 5 * 1024 * 1024 * 1024
+
+// helper function to check which of given objects already exist in target bucket
+func existingObjects(ctx context.Context, s3 S3, bucket string, objects []ObjectResult) map[string]bool {
+	out := make(map[string]bool)
+	minioClient, err := s3Client(s3)
+	if err != nil {
+		return out
+	}
+	for _, obj := range objects {
+		if _, err := minioClient.StatObject(ctx, bucket, obj.Object, minio.StatObjectOptions{}); err == nil {
+			out[obj.Object] = true
+		}
+	}
+	return out
+}
+
+// listing limits used by bucket listings
+const (
+	listingDefaultLimit = 100   // default number of entries per page
+	listingMaxLimit     = 1000  // maximum number of entries per page
+	listingMaxScan      = 10000 // maximum number of keys scanned to fill single page
+)
+
+// ListingParams represents parameters of paginated bucket listing
+type ListingParams struct {
+	Prefix string `form:"prefix"` // folder prefix, e.g. surveys/2023/
+	Filter string `form:"filter"` // case-insensitive sub-string of object name
+	Sort   string `form:"sort"`   // sort key: name, size or modified, size and modified order objects of listed page only
+	Order  string `form:"order"`  // sort order: asc or desc, desc order reverses objects of listed page only
+	Token  string `form:"token"`  // continuation token of the page
+	Limit  int    `form:"limit"`  // number of entries per page
+}
+
+// ObjectListing represents single page of bucket listing
+type ObjectListing struct {
+	Folders   []string
+	Objects   []minio.ObjectInfo
+	NextToken string
+	Scanned   int
+}
+
+// helper function to list single page of bucket objects. Objects are listed
+// using S3 continuation tokens and "/" delimiter, i.e. only objects and folders
+// of the given prefix level are returned. The name filter is applied while
+// listing, therefore we keep fetching pages until the listing page is filled up
+// or we scanned listingMaxScan keys.
+func listObjects(s3 S3, bucket string, params ListingParams) (ObjectListing, error) {
+	var listing ObjectListing
+	minioClient, err := s3Client(s3)
+	if err != nil {
+		return listing, err
+	}
+	if params.Limit <= 0 || params.Limit > listingMaxLimit {
+		params.Limit = listingDefaultLimit
+	}
+	core := minio.Core{Client: minioClient}
+	filter := strings.ToLower(params.Filter)
+	token := params.Token
+	for {
+		// we never ask for more keys than we need to fill the page, this way
+		// continuation token of the last response points to next listing page
+		nkeys := params.Limit - len(listing.Folders) - len(listing.Objects)
+		result, err := core.ListObjectsV2(bucket, params.Prefix, "", token, "/", nkeys)
+		if err != nil {
+			return listing, err
+		}
+		for _, p := range result.CommonPrefixes {
+			listing.Scanned++
+			if filter == "" || strings.Contains(strings.ToLower(strings.TrimPrefix(p.Prefix, params.Prefix)), filter) {
+				listing.Folders = append(listing.Folders, p.Prefix)
+			}
+		}
+		for _, obj := range result.Contents {
+			listing.Scanned++
+			if obj.Key == params.Prefix {
+				// skip folder placeholder object
+				continue
+			}
+			if filter == "" || strings.Contains(strings.ToLower(strings.TrimPrefix(obj.Key, params.Prefix)), filter) {
+				listing.Objects = append(listing.Objects, obj)
+			}
+		}
+		if !result.IsTruncated {
+			listing.NextToken = ""
+			break
+		}
+		listing.NextToken = result.NextContinuationToken
+		token = result.NextContinuationToken
+		if len(listing.Folders)+len(listing.Objects) >= params.Limit || listing.Scanned >= listingMaxScan {
+			break
+		}
+	}
+	sortObjects(listing.Objects, params.Sort, params.Order)
+	if params.Order == "desc" {
+		sort.Sort(sort.Reverse(sort.StringSlice(listing.Folders)))
+	}
+	return listing, nil
+}
+
+// helper function to check if bucket listing has more than one page, S3
+// lists objects in ascending name order only, therefore sorting by size or
+// modified time, as well as descending order, applies to objects of the
+// listed page and not the whole bucket
+func pagedListing(params ListingParams, listing ObjectListing) bool {
+	return listing.NextToken != "" || params.Token != ""
+}
+
+// helper function to get scope of listing sort order, either bucket or page
+func sortScope(params ListingParams, listing ObjectListing) string {
+	byName := params.Sort == "" || params.Sort == "name"
+	if (!byName || params.Order == "desc") && pagedListing(params, listing) {
+		return "page"
+	}
+	return "bucket"
+}
+
+// helper function to sort listed objects by given key and order
+func sortObjects(objects []minio.ObjectInfo, key, order string) {
+	less := func(i, j int) bool { return objects[i].Key < objects[j].Key }
+	switch key {
+	case "size":
+		less = func(i, j int) bool { return objects[i].Size < objects[j].Size }
+	case "modified":
+		less = func(i, j int) bool { return objects[i].LastModified.Before(objects[j].LastModified) }
+	}
+	if order == "desc" {
+		sort.SliceStable(objects, func(i, j int) bool { return less(j, i) })
+		return
+	}
+	sort.SliceStable(objects, less)
+}
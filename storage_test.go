@@ -0,0 +1,353 @@
+package main
+
+// storage tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/OreCast/Frontend/client"
+	oreConfig "github.com/OreCast/common/config"
+	"github.com/vkuznet/cryptoutils"
+)
+
+// helper function to start fake S3 storage which accepts multipart uploads
+// and records its requests
+func fakeS3(t *testing.T) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		mu.Unlock()
+		query := r.URL.Query()
+		w.Header().Set("Content-Type", "application/xml")
+		switch {
+		case query.Has("location"):
+			fmt.Fprint(w, `<LocationConstraint>us-east-1</LocationConstraint>`)
+		case r.Method == "POST" && query.Has("uploads"):
+			fmt.Fprint(w, `<InitiateMultipartUploadResult><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`)
+		case r.Method == "PUT":
+			data, _ := io.ReadAll(r.Body)
+			sum := md5.Sum(data)
+			w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+		case r.Method == "POST" && query.Has("uploadId"):
+			fmt.Fprint(w, `<CompleteMultipartUploadResult><Bucket>data</Bucket><ETag>"fake"</ETag></CompleteMultipartUploadResult>`)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, requests...)
+	}
+}
+
+// helper function to set encryption of site credentials in OreCast configuration
+func testEncryption(t *testing.T) {
+	t.Helper()
+	config := oreConfig.Config
+	t.Cleanup(func() { oreConfig.Config = config })
+	oreConfig.Config = &oreConfig.OreCastConfig{}
+	oreConfig.Config.Encryption.Secret = "secret"
+	oreConfig.Config.Encryption.Cipher = "aes"
+}
+
+// helper function to encrypt site credentials as Discovery service keeps them
+func encryptCredential(t *testing.T, val string) string {
+	t.Helper()
+	enc, err := cryptoutils.HexEncrypt(val, oreConfig.Config.Encryption.Secret, oreConfig.Config.Encryption.Cipher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enc
+}
+
+// helper function to make Discovery record of site with given S3 storage
+func testSite(t *testing.T, name string, srv *httptest.Server) Site {
+	return Site{
+		Name:         name,
+		Endpoint:     strings.TrimPrefix(srv.URL, "http://"),
+		AccessKey:    encryptCredential(t, "key"),
+		AccessSecret: encryptCredential(t, "secret"),
+	}
+}
+
+// helper function to point clients of OreCast services to fake Discovery
+// service with given sites
+func fakeDiscovery(t *testing.T, sites ...Site) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sites" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(sites)
+	}))
+	t.Cleanup(srv.Close)
+	services := _services
+	t.Cleanup(func() { _services = services })
+	_services = client.New(client.Config{
+		DiscoveryURL:       srv.URL,
+		DataManagementURL:  srv.URL,
+		MetaDataURL:        srv.URL,
+		DataBookkeepingURL: srv.URL,
+		AuthzURL:           srv.URL,
+	})
+}
+
+// helper function to make upload request, the form fields precede file content
+func uploadRequest(t *testing.T, target, site, bucket, object, data string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("site", site)
+	writer.WriteField("bucket", bucket)
+	writer.WriteField("object", object)
+	part, err := writer.CreateFormFile("file", "upload.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(part, data)
+	writer.Close()
+	req := httptest.NewRequest("POST", target, &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+// TestUploadSite tests uploads to permitted and forbidden sites and that
+// names of uploaded objects are escaped in upload report
+func TestUploadSite(t *testing.T) {
+	testEncryption(t)
+	testPolicy(t)
+	maxSize := frontendConfig.UploadMaxSize
+	t.Cleanup(func() { frontendConfig.UploadMaxSize = maxSize })
+	frontendConfig.UploadMaxSize = 1024 * 1024
+	srv, requests := fakeS3(t)
+	fakeDiscovery(t, testSite(t, "A", srv), testSite(t, "B", srv))
+	route := Route{"POST", "/storage/upload", PermRead, S3UploadPostHandler}
+
+	object := `<img src=x onerror=alert(1)>.txt`
+	tests := []struct {
+		name   string
+		target string
+		site   string
+		status int
+	}{
+		{"forbidden site", "/storage/upload", "B", http.StatusForbidden},
+		{"forbidden site with granted query", "/storage/upload?site=A", "B", http.StatusForbidden},
+		{"granted site", "/storage/upload", "A", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nreq := len(requests())
+			req := uploadRequest(t, tt.target, tt.site, "data", object, "hole,depth\nDH-1,1.5\n")
+			w := httptest.NewRecorder()
+			testRouter("alice", route).ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if strings.Contains(w.Body.String(), "<img src=x") {
+				t.Error("object name is not escaped")
+			}
+			if tt.status != http.StatusOK && len(requests()) != nreq {
+				t.Errorf("storage is accessed for forbidden site: %v", requests()[nreq:])
+			}
+		})
+	}
+}
+
+// helper function to start fake S3 storage which serves objects of given
+// content types and content
+func objectS3(t *testing.T, ctypes map[string]string, data string) *httptest.Server {
+	t.Helper()
+	modified := time.Now().UTC().Truncate(time.Second)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("location") {
+			fmt.Fprint(w, `<LocationConstraint>us-east-1</LocationConstraint>`)
+			return
+		}
+		ctype, ok := ctypes[path.Base(r.URL.Path)]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Error><Code>NoSuchKey</Code></Error>`)
+			return
+		}
+		w.Header().Set("Content-Type", ctype)
+		w.Header().Set("ETag", `"0123456789abcdef0123456789abcdef"`)
+		http.ServeContent(w, r, "", modified, strings.NewReader(data))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// TestObjectHandlerContentType tests that objects with active content are
+// never rendered inline from frontend origin
+func TestObjectHandlerContentType(t *testing.T) {
+	testEncryption(t)
+	testPolicy(t)
+	accessLog := _accessLog.fname
+	t.Cleanup(func() { _accessLog.fname = accessLog })
+	_accessLog.fname = filepath.Join(t.TempDir(), "access.log")
+	ctypes := map[string]string{
+		"page.html":   "text/html",
+		"image.svg":   "image/svg+xml",
+		"forged.txt":  "text/html; x=text/plain",
+		"upper.txt":   "TEXT/PLAIN; charset=utf-8",
+		"invalid.txt": "text/plain; charset",
+		"photo.png":   "image/png",
+	}
+	srv := objectS3(t, ctypes, "<script>alert(1)</script>")
+	fakeDiscovery(t, testSite(t, "A", srv))
+	route := Route{"GET", "/storage/:site/:bucket/*object", PermRead, ObjectHandler}
+
+	tests := []struct {
+		object      string
+		disposition string
+	}{
+		{"page.html", "attachment"},
+		{"image.svg", "attachment"},
+		{"forged.txt", "attachment"},
+		{"upper.txt", "inline"},
+		{"invalid.txt", "attachment"},
+		{"photo.png", "inline"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.object, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/storage/A/data/"+tt.object+"?inline=true", nil)
+			w := httptest.NewRecorder()
+			testRouter("alice", route).ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+			}
+			header := w.Header()
+			if got := header.Get("Content-Disposition"); !strings.HasPrefix(got, tt.disposition+";") {
+				t.Errorf("got disposition %q, want %s", got, tt.disposition)
+			}
+			if got := header.Get("Content-Type"); got != ctypes[tt.object] {
+				t.Errorf("got content type %q, want %q", got, ctypes[tt.object])
+			}
+			if got := header.Get("X-Content-Type-Options"); got != "nosniff" {
+				t.Errorf("got X-Content-Type-Options %q", got)
+			}
+			if got := header.Get("Content-Security-Policy"); got != "sandbox" {
+				t.Errorf("got Content-Security-Policy %q", got)
+			}
+		})
+	}
+
+	// objects are downloaded unless client asks for inline content
+	req := httptest.NewRequest("GET", "/storage/A/data/photo.png", nil)
+	w := httptest.NewRecorder()
+	testRouter("alice", route).ServeHTTP(w, req)
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="photo.png"` {
+		t.Errorf("got disposition %q", got)
+	}
+	data, err := os.ReadFile(_accessLog.fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), `"action":"download"`); n != len(tests)+1 {
+		t.Errorf("got %d download records, want %d", n, len(tests)+1)
+	}
+}
+
+// TestSortScope tests that sort orders which S3 listing does not provide
+// apply to the listed page of paged listings
+func TestSortScope(t *testing.T) {
+	paged := ObjectListing{NextToken: "next"}
+	tests := []struct {
+		name    string
+		params  ListingParams
+		listing ObjectListing
+		scope   string
+	}{
+		{"default order", ListingParams{}, paged, "bucket"},
+		{"name", ListingParams{Sort: "name", Order: "asc"}, paged, "bucket"},
+		{"name desc", ListingParams{Sort: "name", Order: "desc"}, paged, "page"},
+		{"default sort desc", ListingParams{Order: "desc"}, paged, "page"},
+		{"size", ListingParams{Sort: "size"}, paged, "page"},
+		{"modified desc of last page", ListingParams{Sort: "modified", Order: "desc", Token: "prev"}, ObjectListing{}, "page"},
+		{"name desc of single page", ListingParams{Sort: "name", Order: "desc"}, ObjectListing{}, "bucket"},
+		{"size of single page", ListingParams{Sort: "size"}, ObjectListing{}, "bucket"},
+	}
+	for _, tt := range tests {
+		if got := sortScope(tt.params, tt.listing); got != tt.scope {
+			t.Errorf("%s: got scope %s, want %s", tt.name, got, tt.scope)
+		}
+	}
+}
+
+// TestUploadInvalidatesObjects tests that cached objects of the bucket are
+// dropped after upload, e.g. dataset page shows uploaded object
+func TestUploadInvalidatesObjects(t *testing.T) {
+	testEncryption(t)
+	testPolicy(t)
+	maxSize := frontendConfig.UploadMaxSize
+	t.Cleanup(func() { frontendConfig.UploadMaxSize = maxSize })
+	frontendConfig.UploadMaxSize = 1024 * 1024
+	s3srv, _ := fakeS3(t)
+	var listings atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sites":
+			json.NewEncoder(w).Encode([]Site{testSite(t, "A", s3srv)})
+		case "/storage/A/data":
+			listings.Add(1)
+			fmt.Fprint(w, `{"status":"ok","data":{"objects":[]}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	services := _services
+	t.Cleanup(func() { _services = services })
+	_services = client.New(client.Config{
+		DiscoveryURL:       srv.URL,
+		DataManagementURL:  srv.URL,
+		MetaDataURL:        srv.URL,
+		DataBookkeepingURL: srv.URL,
+		AuthzURL:           srv.URL,
+		CacheTTL:           time.Minute,
+	})
+
+	ctx := context.Background()
+	_services.DataManagement.Objects(ctx, "A", "data")
+	_services.DataManagement.Objects(ctx, "A", "data")
+	if n := listings.Load(); n != 1 {
+		t.Fatalf("objects are listed %d times, want 1", n)
+	}
+	route := Route{"POST", "/storage/upload", PermRead, S3UploadPostHandler}
+	w := httptest.NewRecorder()
+	testRouter("alice", route).ServeHTTP(w, uploadRequest(t, "/storage/upload", "A", "data", "new.csv", "a,b\n"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+	}
+	_services.DataManagement.Objects(ctx, "A", "data")
+	if n := listings.Load(); n != 2 {
+		t.Errorf("objects are listed %d times after upload, want 2", n)
+	}
+}
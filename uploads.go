@@ -0,0 +1,522 @@
+package main
+
+// resumable uploads module
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+// The resumable upload protocol is built on top of S3 multipart uploads:
+// - POST   /storage/:site/upload/resumable                 creates new upload
+// - GET    /storage/:site/upload/resumable/:id             returns upload offset and parts
+// - PUT    /storage/:site/upload/resumable/:id/:part       uploads (or retries) given part
+// - POST   /storage/:site/upload/resumable/:id/complete    completes the upload
+// - DELETE /storage/:site/upload/resumable/:id             aborts the upload
+// The upload id is signed token which holds all information about the upload,
+// therefore clients may resume their uploads at any time until upload is
+// completed or aborted, even after frontend restart. Pending uploads are
+// kept in BoltDB file and uploads which are not completed within upload
+// expire period are aborted to release storage of their parts.
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	oreConfig "github.com/OreCast/common/config"
+	"github.com/gin-gonic/gin"
+	minio "github.com/minio/minio-go/v7"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ResumableUpload represents resumable upload record encoded in upload id
+type ResumableUpload struct {
+	Site     string `json:"site"`
+	Bucket   string `json:"bucket"`
+	Object   string `json:"object"`
+	UploadID string `json:"upload_id"`
+	Size     int64  `json:"size"`
+	PartSize int64  `json:"part_size"`
+	User     string `json:"user"`
+	Created  int64  `json:"created"`
+}
+
+// PendingUpload represents resumable upload kept in upload store along with
+// storage record of its site, the record keeps credentials encrypted as
+// Discovery service does and allows to abort expired upload without user token
+type PendingUpload struct {
+	ResumableUpload
+	Storage Site `json:"storage"`
+}
+
+// ResumableForm represents form to create resumable upload
+type ResumableForm struct {
+	Bucket string `form:"bucket" json:"bucket" binding:"required"`
+	Object string `form:"object" json:"object" binding:"required"`
+	Size   int64  `form:"size" json:"size" binding:"required"`
+}
+
+// UploadPart represents uploaded part of resumable upload
+type UploadPart struct {
+	Number int    `json:"number"`
+	Size   int64  `json:"size"`
+	ETag   string `json:"etag"`
+}
+
+// NParts returns total number of parts of the upload
+func (u ResumableUpload) NParts() int {
+	return int((u.Size + u.PartSize - 1) / u.PartSize)
+}
+
+// PartLength returns expected size of given part
+func (u ResumableUpload) PartLength(part int) int64 {
+	if part == u.NParts() {
+		return u.Size - int64(part-1)*u.PartSize
+	}
+	return u.PartSize
+}
+
+// helper function to encode resumable upload into signed upload id
+func encodeUploadID(u ResumableUpload) (string, error) {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return "", err
+	}
+	val := base64.RawURLEncoding.EncodeToString(data)
+	return fmt.Sprintf("%s.%s", val, _sessions.sign(val)), nil
+}
+
+// helper function to decode signed upload id
+func decodeUploadID(id string) (ResumableUpload, error) {
+	var u ResumableUpload
+	val, err := _sessions.verify(id)
+	if err != nil {
+		return u, errors.New("invalid upload id")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(val)
+	if err != nil {
+		return u, err
+	}
+	err = json.Unmarshal(data, &u)
+	return u, err
+}
+
+// errUploadExpired is returned for resumable uploads which were not completed in time
+var errUploadExpired = errors.New("upload is expired")
+
+// Expired checks if upload is not completed within upload expire period
+func (u ResumableUpload) Expired() bool {
+	return time.Now().Unix() > u.Created+frontendConfig.UploadExpire
+}
+
+// helper function to get HTTP status of resumable upload error
+func uploadStatus(err error) int {
+	if errors.Is(err, errUploadExpired) {
+		return http.StatusGone
+	}
+	return http.StatusBadRequest
+}
+
+// helper function to respond with resumable upload error
+func uploadError(c *gin.Context, status int, err error) {
+	log.Println("ERROR: resumable upload", c.Request.Method, c.Request.URL.Path, err)
+	c.AbortWithStatusJSON(status, gin.H{"status": "fail", "error": err.Error()})
+}
+
+// helper function to load resumable upload from request parameters and
+// initialize S3 client of its site
+func resumableUpload(c *gin.Context) (ResumableUpload, minio.Core, error) {
+	var core minio.Core
+	upload, err := decodeUploadID(c.Param("id"))
+	if err != nil {
+		return upload, core, err
+	}
+	if upload.Site != c.Param("site") {
+		return upload, core, errors.New("upload does not belong to this site")
+	}
+	if user, ok := c.Get("user"); !ok || upload.User != fmt.Sprintf("%v", user) {
+		return upload, core, errors.New("upload does not belong to this user")
+	}
+	if upload.Expired() {
+		// expired upload is aborted in background by expireUploads
+		return upload, core, errUploadExpired
+	}
+	s3, err := siteStorage(c, upload.Site)
+	if err != nil {
+		return upload, core, err
+	}
+	client, err := s3Client(s3)
+	if err != nil {
+		return upload, core, err
+	}
+	core.Client = client
+	return upload, core, nil
+}
+
+// helper function to list all uploaded parts of resumable upload
+func uploadedParts(c *gin.Context, core minio.Core, upload ResumableUpload) ([]UploadPart, error) {
+	var parts []UploadPart
+	marker := 0
+	for {
+		result, err := core.ListObjectParts(c.Request.Context(), upload.Bucket, upload.Object, upload.UploadID, marker, 1000)
+		if err != nil {
+			return parts, err
+		}
+		for _, p := range result.ObjectParts {
+			parts = append(parts, UploadPart{Number: p.PartNumber, Size: p.Size, ETag: p.ETag})
+		}
+		if !result.IsTruncated {
+			break
+		}
+		marker = result.NextPartNumberMarker
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Number < parts[j].Number })
+	return parts, nil
+}
+
+// helper function to calculate offset of the upload, i.e. size of the data
+// uploaded contiguously from the beginning of the file
+func uploadOffset(upload ResumableUpload, parts []UploadPart) int64 {
+	var offset int64
+	for idx, p := range parts {
+		if p.Number != idx+1 || p.Size != upload.PartLength(p.Number) {
+			break
+		}
+		offset += p.Size
+	}
+	return offset
+}
+
+// ResumableCreateHandler provides access to POST /storage/:site/upload/resumable endpoint
+func ResumableCreateHandler(c *gin.Context) {
+	var form ResumableForm
+	if err := c.ShouldBind(&form); err != nil {
+		uploadError(c, http.StatusBadRequest, err)
+		return
+	}
+	if form.Size <= 0 || form.Size > frontendConfig.UploadMaxSize {
+		uploadError(c, http.StatusRequestEntityTooLarge, ErrTooLarge)
+		return
+	}
+	site := c.Param("site")
+	rec, err := _services.Discovery.Site(serviceContext(c), site)
+	if err = serviceError(c, err); err != nil {
+		uploadError(c, serviceStatus(err), err)
+		return
+	}
+	s3, err := siteS3(rec)
+	if err != nil {
+		uploadError(c, http.StatusInternalServerError, err)
+		return
+	}
+	client, err := s3Client(s3)
+	if err != nil {
+		uploadError(c, http.StatusInternalServerError, err)
+		return
+	}
+	core := minio.Core{Client: client}
+	opts := minio.PutObjectOptions{ContentType: detectContentType(form.Object, nil)}
+	uploadID, err := core.NewMultipartUpload(c.Request.Context(), form.Bucket, form.Object, opts)
+	if err != nil {
+		uploadError(c, http.StatusBadRequest, err)
+		return
+	}
+	user, _ := c.Get("user")
+	upload := ResumableUpload{
+		Site:     site,
+		Bucket:   form.Bucket,
+		Object:   form.Object,
+		UploadID: uploadID,
+		Size:     form.Size,
+		PartSize: uploadPartSize,
+		User:     fmt.Sprintf("%v", user),
+		Created:  time.Now().Unix(),
+	}
+	id, err := encodeUploadID(upload)
+	if err != nil {
+		uploadError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if err := _uploads.Add(PendingUpload{ResumableUpload: upload, Storage: rec}); err != nil {
+		log.Println("ERROR: unable to keep resumable upload", err)
+	}
+	if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
+		log.Printf("new resumable upload %+v", upload)
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"status":    "ok",
+		"id":        id,
+		"part_size": upload.PartSize,
+		"parts":     upload.NParts(),
+	})
+}
+
+// ResumableStatusHandler provides access to GET /storage/:site/upload/resumable/:id endpoint
+func ResumableStatusHandler(c *gin.Context) {
+	upload, core, err := resumableUpload(c)
+	if err != nil {
+		uploadError(c, uploadStatus(err), err)
+		return
+	}
+	parts, err := uploadedParts(c, core, upload)
+	if err != nil {
+		uploadError(c, http.StatusNotFound, err)
+		return
+	}
+	c.Header("Upload-Offset", fmt.Sprintf("%d", uploadOffset(upload, parts)))
+	c.Header("Upload-Length", fmt.Sprintf("%d", upload.Size))
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "ok",
+		"bucket":    upload.Bucket,
+		"object":    upload.Object,
+		"size":      upload.Size,
+		"part_size": upload.PartSize,
+		"offset":    uploadOffset(upload, parts),
+		"nparts":    upload.NParts(),
+		"parts":     parts,
+	})
+}
+
+// ResumablePartHandler provides access to PUT /storage/:site/upload/resumable/:id/:part endpoint
+func ResumablePartHandler(c *gin.Context) {
+	upload, core, err := resumableUpload(c)
+	if err != nil {
+		uploadError(c, uploadStatus(err), err)
+		return
+	}
+	part, err := strconv.Atoi(c.Param("part"))
+	if err != nil || part < 1 || part > upload.NParts() {
+		uploadError(c, http.StatusBadRequest, fmt.Errorf("invalid part number %s", c.Param("part")))
+		return
+	}
+	size := upload.PartLength(part)
+	if c.Request.ContentLength != size {
+		msg := fmt.Errorf("part %d should have %d bytes, got %d", part, size, c.Request.ContentLength)
+		uploadError(c, http.StatusBadRequest, msg)
+		return
+	}
+	opts := minio.PutObjectPartOptions{Md5Base64: c.GetHeader("Content-MD5")}
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, size)
+	objPart, err := core.PutObjectPart(c.Request.Context(), upload.Bucket, upload.Object, upload.UploadID, part, body, size, opts)
+	if err != nil {
+		uploadError(c, http.StatusBadGateway, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+		"part":   UploadPart{Number: part, Size: objPart.Size, ETag: objPart.ETag},
+	})
+}
+
+// ResumableCompleteHandler provides access to POST /storage/:site/upload/resumable/:id/complete endpoint
+func ResumableCompleteHandler(c *gin.Context) {
+	upload, core, err := resumableUpload(c)
+	if err != nil {
+		uploadError(c, uploadStatus(err), err)
+		return
+	}
+	parts, err := uploadedParts(c, core, upload)
+	if err != nil {
+		uploadError(c, http.StatusNotFound, err)
+		return
+	}
+	if offset := uploadOffset(upload, parts); offset != upload.Size {
+		msg := fmt.Errorf("upload is incomplete, offset %d of %d bytes", offset, upload.Size)
+		uploadError(c, http.StatusConflict, msg)
+		return
+	}
+	var cparts []minio.CompletePart
+	for _, p := range parts {
+		cparts = append(cparts, minio.CompletePart{PartNumber: p.Number, ETag: p.ETag})
+	}
+	info, err := core.CompleteMultipartUpload(c.Request.Context(), upload.Bucket, upload.Object, upload.UploadID, cparts, minio.PutObjectOptions{})
+	if err != nil {
+		uploadError(c, http.StatusBadGateway, err)
+		return
+	}
+	_services.DataManagement.InvalidateObjects(upload.Site, upload.Bucket)
+	if err := _uploads.Remove(upload.UploadID); err != nil {
+		log.Println("ERROR:", err)
+	}
+	if oreConfig.Config.Frontend.WebServer.Verbose > 0 {
+		log.Printf("completed resumable upload %s/%s/%s etag %s", upload.Site, upload.Bucket, upload.Object, info.ETag)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+		"bucket": upload.Bucket,
+		"object": upload.Object,
+		"size":   upload.Size,
+		"etag":   strings.Trim(info.ETag, "\""),
+	})
+}
+
+// ResumableAbortHandler provides access to DELETE /storage/:site/upload/resumable/:id endpoint
+func ResumableAbortHandler(c *gin.Context) {
+	upload, core, err := resumableUpload(c)
+	if err != nil {
+		uploadError(c, uploadStatus(err), err)
+		return
+	}
+	if err := core.AbortMultipartUpload(c.Request.Context(), upload.Bucket, upload.Object, upload.UploadID); err != nil {
+		uploadError(c, http.StatusBadGateway, err)
+		return
+	}
+	if err := _uploads.Remove(upload.UploadID); err != nil {
+		log.Println("ERROR:", err)
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+//
+// pending resumable uploads
+//
+
+// uploadBucket defines name of BoltDB bucket with pending resumable uploads
+var uploadBucket = []byte("resumable_uploads")
+
+// UploadStore keeps pending resumable uploads in BoltDB file
+type UploadStore struct {
+	db *bolt.DB
+}
+
+// _uploads holds pending resumable uploads
+var _uploads *UploadStore
+
+// helper function to initialize store of pending resumable uploads
+func initUploads() error {
+	var err error
+	_uploads, err = NewUploadStore(frontendConfig.UploadFile)
+	return err
+}
+
+// NewUploadStore creates new instance of UploadStore
+func NewUploadStore(fname string) (*UploadStore, error) {
+	db, err := bolt.Open(fname, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(uploadBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &UploadStore{db: db}, nil
+}
+
+// Add stores pending resumable upload
+func (s *UploadStore) Add(upload PendingUpload) error {
+	if s == nil {
+		return nil
+	}
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(uploadBucket).Put([]byte(upload.UploadID), data)
+	})
+}
+
+// Remove deletes resumable upload which is completed or aborted
+func (s *UploadStore) Remove(uploadID string) error {
+	if s == nil {
+		return nil
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(uploadBucket).Delete([]byte(uploadID))
+	})
+}
+
+// Expired returns pending resumable uploads which are expired
+func (s *UploadStore) Expired() ([]PendingUpload, error) {
+	var uploads []PendingUpload
+	if s == nil {
+		return uploads, nil
+	}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(uploadBucket).ForEach(func(k, v []byte) error {
+			var upload PendingUpload
+			if err := json.Unmarshal(v, &upload); err != nil {
+				return err
+			}
+			if upload.Expired() {
+				uploads = append(uploads, upload)
+			}
+			return nil
+		})
+	})
+	return uploads, err
+}
+
+// uploadExpireInterval defines how often expired resumable uploads are aborted
+const uploadExpireInterval = 10 * time.Minute
+
+// helper function to periodically abort expired resumable uploads, it
+// should run as goroutine
+func expireUploads() {
+	for {
+		abortExpiredUploads(context.Background())
+		time.Sleep(uploadExpireInterval)
+	}
+}
+
+// helper function to abort expired resumable uploads and release storage
+// of their parts, uploads which can not be aborted are retried later
+func abortExpiredUploads(ctx context.Context) {
+	uploads, err := _uploads.Expired()
+	if err != nil {
+		log.Println("ERROR: unable to read resumable uploads", err)
+		return
+	}
+	for _, upload := range uploads {
+		if err := abortUpload(ctx, upload); err != nil {
+			log.Printf("ERROR: unable to abort expired upload %s/%s/%s, error %v",
+				upload.Site, upload.Bucket, upload.Object, err)
+			continue
+		}
+		if err := _uploads.Remove(upload.UploadID); err != nil {
+			log.Println("ERROR:", err)
+		}
+		log.Printf("INFO: aborted expired resumable upload %s/%s/%s of user %s",
+			upload.Site, upload.Bucket, upload.Object, upload.User)
+	}
+}
+
+// helper function to abort S3 multipart upload of resumable upload, it uses
+// storage record kept with the upload since expired uploads are aborted
+// without user token which Discovery service requires
+func abortUpload(ctx context.Context, upload PendingUpload) error {
+	rec := upload.Storage
+	if rec.Endpoint == "" {
+		// uploads kept by previous versions do not have storage record
+		var err error
+		rec, err = _services.Discovery.Site(ctx, upload.Site)
+		if err != nil {
+			return err
+		}
+	}
+	s3, err := siteS3(rec)
+	if err != nil {
+		return err
+	}
+	client, err := s3Client(s3)
+	if err != nil {
+		return err
+	}
+	core := minio.Core{Client: client}
+	err = core.AbortMultipartUpload(ctx, upload.Bucket, upload.Object, upload.UploadID)
+	if minio.ToErrorResponse(err).Code == "NoSuchUpload" {
+		// upload is already completed or aborted
+		return nil
+	}
+	return err
+}
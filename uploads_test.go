@@ -0,0 +1,134 @@
+package main
+
+// resumable uploads tests
+//
+// Copyright (c) 2023 - Valentin Kuznetsov <vkuznet@gmail.com>
+//
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAbortExpiredUploads tests that expired uploads are aborted with storage
+// record kept with them, i.e. without Discovery service which requires user token
+func TestAbortExpiredUploads(t *testing.T) {
+	testEncryption(t)
+	expire := frontendConfig.UploadExpire
+	t.Cleanup(func() { frontendConfig.UploadExpire = expire })
+	frontendConfig.UploadExpire = 60
+
+	store, err := NewUploadStore(filepath.Join(t.TempDir(), "uploads.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploads := _uploads
+	t.Cleanup(func() {
+		_uploads = uploads
+		store.db.Close()
+	})
+	_uploads = store
+	calls := countingServices(t)
+	srv, requests := fakeS3(t)
+
+	storage := testSite(t, "A", srv)
+	now := time.Now().Unix()
+	pending := []PendingUpload{
+		{ResumableUpload{Site: "A", Bucket: "data", Object: "old.las", UploadID: "expired", Created: now - 3600}, storage},
+		{ResumableUpload{Site: "A", Bucket: "data", Object: "new.las", UploadID: "pending", Created: now}, storage},
+	}
+	for _, upload := range pending {
+		if err := store.Add(upload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	abortExpiredUploads(context.Background())
+
+	if n := calls.Load(); n != 0 {
+		t.Errorf("Discovery service is called %d times", n)
+	}
+	var aborted bool
+	for _, req := range requests() {
+		if strings.HasPrefix(req, "DELETE /data/old.las?uploadId=expired") {
+			aborted = true
+		}
+		if strings.Contains(req, "pending") {
+			t.Errorf("pending upload is touched by %s", req)
+		}
+	}
+	if !aborted {
+		t.Errorf("expired upload is not aborted, storage requests %v", requests())
+	}
+	expired, err := store.Expired()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 0 {
+		t.Errorf("aborted upload is kept in the store: %+v", expired)
+	}
+}
+
+// TestResumableUploadForged tests that resumable uploads are accessible only
+// by their owners via signed upload ids
+func TestResumableUploadForged(t *testing.T) {
+	testPolicy(t)
+	sessions := _sessions
+	t.Cleanup(func() { _sessions = sessions })
+	_sessions = &SessionManager{Secret: []byte("secret")}
+	expire := frontendConfig.UploadExpire
+	t.Cleanup(func() { frontendConfig.UploadExpire = expire })
+	frontendConfig.UploadExpire = 60
+	calls := countingServices(t)
+
+	// helper function to make signed upload id
+	uploadID := func(upload ResumableUpload) string {
+		id, err := encodeUploadID(upload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	now := time.Now().Unix()
+	valid := ResumableUpload{Site: "A", Bucket: "data", Object: "a.las", UploadID: "u1", User: "alice", Created: now}
+	forged := valid
+	forged.User = "bob"
+	otherSite := valid
+	otherSite.Site = "B"
+	expired := valid
+	expired.Created = now - 3600
+	// payload of other user's upload with signature of valid one
+	signature := strings.Split(uploadID(valid), ".")[1]
+	tampered := strings.Split(uploadID(forged), ".")[0] + "." + signature
+
+	tests := []struct {
+		name   string
+		id     string
+		status int
+	}{
+		{"tampered payload", tampered, http.StatusBadRequest},
+		{"unsigned", strings.Split(uploadID(forged), ".")[0], http.StatusBadRequest},
+		{"other user", uploadID(forged), http.StatusBadRequest},
+		{"other site", uploadID(otherSite), http.StatusBadRequest},
+		{"expired", uploadID(expired), http.StatusGone},
+	}
+	route := Route{"GET", "/storage/:site/upload/resumable/:id", PermDataWrite, ResumableStatusHandler}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/storage/A/upload/resumable/"+tt.id, nil)
+			w := httptest.NewRecorder()
+			testRouter("alice", route).ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Errorf("got status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+	if n := calls.Load(); n != 0 {
+		t.Errorf("OreCast services are called %d times for forged uploads", n)
+	}
+}
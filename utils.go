@@ -41,6 +41,11 @@ func mdToHTML(fname string) (string, error) {
 		return "", err
 	}
 
+	return renderMarkdown(md, mhtml.CommonFlags), nil
+}
+
+// helper function to render markdown content into HTML with given HTML flags
+func renderMarkdown(md []byte, htmlFlags mhtml.Flags) string {
 	// create markdown parser with extensions
 	extensions := parser.CommonExtensions | parser.AutoHeadingIDs | parser.NoEmptyLineBeforeBlock
 	p := parser.NewWithExtensions(extensions)
@@ -48,12 +53,11 @@ func mdToHTML(fname string) (string, error) {
 
 	// create HTML renderer with extensions
 	//     htmlFlags := mhtml.CommonFlags | mhtml.HrefTargetBlank
-	htmlFlags := mhtml.CommonFlags
 	opts := mhtml.RendererOptions{Flags: htmlFlags}
 	renderer := mhtml.NewRenderer(opts)
 	content := markdown.Render(doc, renderer)
 	//     return html.EscapeString(string(content)), nil
-	return string(content), nil
+	return string(content)
 }
 
 // helper function to get host domain